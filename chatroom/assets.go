@@ -0,0 +1,25 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// embeddedStatic 編譯時內嵌的前端檔案，執行檔不需要從 chatroom/ 目錄啟動
+//
+//go:embed static
+var embeddedStatic embed.FS
+
+// staticFiles 靜態檔案來源：預設使用內嵌檔案，指定目錄時改從磁碟讀取（前端開發時不需要重新編譯）。
+// 第二個回傳值表示檔案是否為內嵌（執行期間不會變動）。
+func staticFiles(dir string) (fs.FS, bool) {
+	if dir != "" {
+		return os.DirFS(dir), false
+	}
+	files, err := fs.Sub(embeddedStatic, "static")
+	if err != nil {
+		panic(err) // "static" 一定存在於內嵌檔案中
+	}
+	return files, true
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"chatroom/config"
+	"chatroom/models"
+	"chatroom/repository"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// runLeaderboard leaderboard 子命令：list、clear、export
+func runLeaderboard(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || isHelp(args[0]) {
+		fmt.Fprintln(stderr, "用法: chatroom leaderboard list|clear|export [flags]")
+		return exitBadArgs
+	}
+
+	switch args[0] {
+	case "list":
+		return runLeaderboardList(args[1:], stdout, stderr)
+	case "clear":
+		return runLeaderboardClear(args[1:], stdout, stderr)
+	case "export":
+		return runLeaderboardExport(args[1:], stdout, stderr)
+	}
+	fmt.Fprintf(stderr, "unknown leaderboard command %q (expected list, clear or export)\n", args[0])
+	return exitBadArgs
+}
+
+// runLeaderboardList 以表格或 JSON 輸出排行榜
+func runLeaderboardList(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("leaderboard list", "[flags]", "輸出排行榜", stderr)
+	limit := fs.Int("n", 0, "只顯示前 N 名，0 表示全部")
+	asJSON := fs.Bool("json", false, "以 JSON 輸出")
+	scope := scopeFlags(fs)
+	loader := newConfigLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage(err)
+	}
+
+	cfg, ok := loadConfig(loader, stderr)
+	if !ok {
+		return exitFailure
+	}
+	store, repo, board, ok := loadLeaderboard(cfg, *scope, stderr)
+	if !ok {
+		return exitFailure
+	}
+	defer store.Close()
+
+	scores := repo.GetAll()
+	if *limit > 0 && *limit < len(scores) {
+		scores = scores[:*limit]
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(scores); err != nil {
+			fmt.Fprintf(stderr, "failed to write leaderboard: %v\n", err)
+			return exitFailure
+		}
+		return exitSuccess
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "RANK\tNICKNAME\t%s\tTIME\n", strings.ToUpper(board.Metric))
+	for i, score := range scores {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%ds\n", i+1, score.Nickname, metricValue(board, score), score.Time)
+	}
+	tw.Flush()
+	return exitSuccess
+}
+
+// runLeaderboardClear 清空排行榜，需要 -yes 確認
+func runLeaderboardClear(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("leaderboard clear", "-yes [flags]", "清空排行榜（請在伺服器停止時執行，否則會被伺服器記憶體中的資料覆寫）", stderr)
+	yes := fs.Bool("yes", false, "確認清空")
+	scope := scopeFlags(fs)
+	loader := newConfigLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage(err)
+	}
+
+	cfg, ok := loadConfig(loader, stderr)
+	if !ok {
+		return exitFailure
+	}
+	store, repo, _, ok := loadLeaderboard(cfg, *scope, stderr)
+	if !ok {
+		return exitFailure
+	}
+	defer store.Close()
+
+	count := len(repo.GetAll())
+	if !*yes {
+		fmt.Fprintf(stderr, "refusing to clear %d scores without -yes\n", count)
+		return exitBadArgs
+	}
+	if err := repo.Clear(); err != nil {
+		fmt.Fprintf(stderr, "failed to clear leaderboard: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintf(stdout, "cleared %d scores\n", count)
+	return exitSuccess
+}
+
+// runLeaderboardExport 將排行榜匯出為 JSON 或 CSV
+func runLeaderboardExport(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("leaderboard export", "[-o file] [-format json|csv] [flags]", "匯出排行榜", stderr)
+	output := fs.String("o", "", "輸出檔案，預設為標準輸出")
+	format := fs.String("format", "json", "輸出格式：json 或 csv")
+	scope := scopeFlags(fs)
+	loader := newConfigLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage(err)
+	}
+	if *format != "json" && *format != "csv" {
+		fmt.Fprintf(stderr, "unknown format %q (expected json or csv)\n", *format)
+		return exitBadArgs
+	}
+
+	cfg, ok := loadConfig(loader, stderr)
+	if !ok {
+		return exitFailure
+	}
+	store, repo, board, ok := loadLeaderboard(cfg, *scope, stderr)
+	if !ok {
+		return exitFailure
+	}
+	defer store.Close()
+	scores := repo.GetAll()
+
+	w := stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to create %s: %v\n", *output, err)
+			return exitFailure
+		}
+		defer file.Close()
+		w = file
+	}
+
+	var err error
+	if *format == "csv" {
+		err = writeScoresCSV(w, board, scores)
+	} else {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(scores)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to export leaderboard: %v\n", err)
+		return exitFailure
+	}
+	if *output != "" {
+		fmt.Fprintf(stdout, "exported %d scores to %s\n", len(scores), *output)
+	}
+	return exitSuccess
+}
+
+// writeScoresCSV 以 CSV 輸出排行榜（含標題列）
+func writeScoresCSV(w io.Writer, board repository.Board, scores []models.GameScore) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"rank", "nickname", "avatar", board.Metric, "time"})
+	for i, score := range scores {
+		cw.Write([]string{
+			strconv.Itoa(i + 1),
+			score.Nickname,
+			score.Avatar,
+			strconv.Itoa(metricValue(board, score)),
+			strconv.Itoa(score.Time),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// metricValue 排行榜主要的成績欄位
+func metricValue(board repository.Board, score models.GameScore) int {
+	if board.Metric == repository.MetricScore {
+		return score.Score
+	}
+	return score.Tries
+}
+
+// scopeFlags 註冊選擇排行榜的參數
+func scopeFlags(fs *flag.FlagSet) *repository.Scope {
+	scope := &repository.Scope{}
+	fs.StringVar(&scope.Board, "board", repository.BoardGuessNumber, "排行榜名稱：guess_number、draw_guess 或 quiz")
+	fs.Func("period", "區間：all_time（預設）、daily 或 weekly", func(value string) error {
+		period, err := repository.ParsePeriod(value)
+		scope.Period = period
+		return err
+	})
+	fs.StringVar(&scope.Room, "room", "", "房間名稱，只適用於分房間的排行榜（quiz），空白表示全站")
+	return scope
+}
+
+// runConfig config 子命令：print
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(stderr, "用法: chatroom config print [-format yaml|env] [flags]")
+		return exitBadArgs
+	}
+
+	fs := newFlagSet("config print", "[-format yaml|env] [flags]", "輸出合併設定檔、環境變數與命令列參數後實際生效的配置", stderr)
+	format := fs.String("format", "yaml", "輸出格式：yaml（可作為 -config 使用）或 env")
+	loader := newConfigLoader(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitUsage(err)
+	}
+
+	cfg, ok := loadConfig(loader, stderr)
+	if !ok {
+		return exitFailure
+	}
+
+	var err error
+	switch *format {
+	case "yaml":
+		err = cfg.WriteYAML(stdout)
+	case "env":
+		err = cfg.WriteEnv(stdout)
+	default:
+		fmt.Fprintf(stderr, "unknown format %q (expected yaml or env)\n", *format)
+		return exitBadArgs
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to print config: %v\n", err)
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+// runCheck 檢查配置、靜態檔案與資料檔，任何一項失敗時回傳非零結束代碼
+func runCheck(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("check", "[flags]", "檢查配置與儲存是否可用（適合部署前或監控腳本使用）", stderr)
+	loader := newConfigLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage(err)
+	}
+
+	failed := 0
+	report := func(name, detail string, err error) {
+		if err != nil {
+			failed++
+			fmt.Fprintf(stdout, "FAIL  %-12s %v\n", name, err)
+			return
+		}
+		fmt.Fprintf(stdout, "ok    %-12s %s\n", name, detail)
+	}
+
+	cfg, ok := loadConfig(loader, stdout)
+	if !ok {
+		report("config", "", fmt.Errorf("see errors above"))
+		return exitFailure
+	}
+	source := "defaults and environment"
+	if path := loader.ConfigPath(); path != "" {
+		source = path
+	}
+	report("config", source, nil)
+
+	staticFS, embedded := staticFiles(cfg.Server.StaticDir)
+	staticSource := cfg.Server.StaticDir
+	if embedded {
+		staticSource = "embedded"
+	}
+	report("static", staticSource, checkStatic(staticFS))
+
+	dataDir := cfg.Storage.DataDir
+	if dataDir == "" {
+		dataDir = "."
+	}
+	detail, err := checkDataDir(dataDir)
+	report("data_dir", detail, err)
+
+	checkStorage(cfg, report)
+
+	detail, err = checkDataDir(cfg.Storage.Path(cfg.Storage.MediaDir))
+	report("media", detail, err)
+
+	if failed > 0 {
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+// checkStorage 開啟儲存並讀取所有資料；資料庫尚未建立時不會建立
+func checkStorage(cfg *config.Config, report func(name, detail string, err error)) {
+	location := cfg.Storage.Path
+	if cfg.Storage.Backend == config.StorageBolt {
+		dbPath := cfg.Storage.Path(cfg.Storage.DatabaseFile)
+		if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+			report("database", dbPath+" (will be created)", nil)
+			return
+		}
+		location = func(string) string { return dbPath }
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		report("storage", "", err)
+		return
+	}
+	defer store.Close()
+
+	if store.db != nil {
+		version, err := store.db.SchemaVersion()
+		report("database", fmt.Sprintf("%s (schema v%d)", location(""), version), err)
+	}
+
+	scores, err := store.leaderboard.Load()
+	report("leaderboard", fmt.Sprintf("%s (%d scores)", location(cfg.Storage.LeaderboardFile), len(scores)), err)
+
+	ids, err := store.boards.List()
+	report("leaderboards", fmt.Sprintf("%d boards", len(ids)), err)
+
+	rooms, err := store.rooms.Load()
+	report("rooms", fmt.Sprintf("%s (%d rooms)", location(cfg.Storage.RoomsFile), len(rooms)), err)
+
+	if store.history != nil {
+		history, err := store.history.LoadAll(0)
+		report("history", fmt.Sprintf("%d rooms", len(history)), err)
+	}
+}
+
+// loadLeaderboard 開啟儲存並載入指定排行榜目前的區間，失敗時輸出錯誤
+func loadLeaderboard(cfg *config.Config, scope repository.Scope, stderr io.Writer) (*storage, repository.LeaderboardRepository, repository.Board, bool) {
+	store, err := openStorage(cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to open storage: %v\n", err)
+		return nil, nil, repository.Board{}, false
+	}
+
+	boards := store.Leaderboards(cfg)
+	scope, board, err := boards.Normalize(scope)
+	if err != nil {
+		store.Close()
+		fmt.Fprintf(stderr, "%v\n", err)
+		return nil, nil, board, false
+	}
+	repo, err := boards.Get(scope)
+	if err == nil {
+		_, err = repo.Load()
+	}
+	if err != nil {
+		store.Close()
+		fmt.Fprintf(stderr, "failed to load leaderboard: %v\n", err)
+		return nil, nil, board, false
+	}
+	return store, repo, board, true
+}
+
+// checkStatic 靜態檔案必須包含 index.html
+func checkStatic(files fs.FS) error {
+	if _, err := fs.Stat(files, "index.html"); err != nil {
+		return fmt.Errorf("index.html not found: %w", err)
+	}
+	return nil
+}
+
+// checkDataDir 資料檔目錄必須可寫入；尚未建立時由 serve 建立
+func checkDataDir(dir string) (string, error) {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return dir + " (will be created)", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+
+	file, err := os.CreateTemp(dir, ".check-*")
+	if err != nil {
+		return "", fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return dir, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"chatroom/models"
+	"chatroom/repository"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCommand 執行子命令並回傳結束代碼與輸出
+func runCommand(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr strings.Builder
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestLeaderboardCommands(t *testing.T) {
+	dir := t.TempDir()
+	repo := repository.NewFileLeaderboardRepository(filepath.Join(dir, "leaderboard.json"))
+	repo.Add(models.GameScore{Nickname: "Alice", Tries: 3, Time: 20})
+	repo.Add(models.GameScore{Nickname: "Bob", Tries: 5, Time: 10})
+
+	code, out, errOut := runCommand(t, "leaderboard", "list", "-data-dir", dir, "-n", "1")
+	if code != exitSuccess || !strings.Contains(out, "Alice") || strings.Contains(out, "Bob") {
+		t.Errorf("list -n 1: code=%d out=%q stderr=%q", code, out, errOut)
+	}
+
+	exported := filepath.Join(dir, "export.json")
+	if code, _, errOut := runCommand(t, "leaderboard", "export", "-data-dir", dir, "-o", exported); code != exitSuccess {
+		t.Fatalf("export failed: code=%d stderr=%q", code, errOut)
+	}
+	data, err := os.ReadFile(exported)
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	var scores []models.GameScore
+	if err := json.Unmarshal(data, &scores); err != nil || len(scores) != 2 {
+		t.Errorf("Expected 2 exported scores, got %d (%v)", len(scores), err)
+	}
+
+	code, out, _ = runCommand(t, "leaderboard", "export", "-data-dir", dir, "-format", "csv")
+	if code != exitSuccess || !strings.HasPrefix(out, "rank,nickname,avatar,tries,time\n1,Alice,,3,20\n") {
+		t.Errorf("csv export: code=%d out=%q", code, out)
+	}
+
+	// 沒有 -yes 時拒絕清空
+	if code, _, _ := runCommand(t, "leaderboard", "clear", "-data-dir", dir); code != exitBadArgs {
+		t.Errorf("clear without -yes should fail with %d, got %d", exitBadArgs, code)
+	}
+	if code, out, _ := runCommand(t, "leaderboard", "clear", "-data-dir", dir, "-yes"); code != exitSuccess || out != "cleared 2 scores\n" {
+		t.Errorf("clear -yes: code=%d out=%q", code, out)
+	}
+	if scores, _ := repository.NewFileLeaderboardRepository(filepath.Join(dir, "leaderboard.json")).Load(); len(scores) != 0 {
+		t.Errorf("Expected empty leaderboard after clear, got %d scores", len(scores))
+	}
+}
+
+func TestLeaderboardBoardFlags(t *testing.T) {
+	dir := t.TempDir()
+	if code, _, errOut := runCommand(t, "leaderboard", "list", "-data-dir", dir, "-board", "chess"); code != exitFailure || !strings.Contains(errOut, "unknown leaderboard") {
+		t.Errorf("unknown board: code=%d stderr=%q", code, errOut)
+	}
+	if code, _, _ := runCommand(t, "leaderboard", "list", "-data-dir", dir, "-period", "monthly"); code != exitBadArgs {
+		t.Errorf("unknown period should fail with %d, got %d", exitBadArgs, code)
+	}
+
+	code, out, errOut := runCommand(t, "leaderboard", "export", "-data-dir", dir, "-board", "quiz", "-period", "daily", "-room", "Lobby", "-format", "csv")
+	if code != exitSuccess || out != "rank,nickname,avatar,score,time\n" {
+		t.Errorf("quiz export: code=%d out=%q stderr=%q", code, out, errOut)
+	}
+}
+
+func TestConfigPrint(t *testing.T) {
+	code, out, errOut := runCommand(t, "config", "print", "-format", "env", "-addr", "127.0.0.1:9000", "-pool.workers=3")
+	if code != exitSuccess {
+		t.Fatalf("config print failed: code=%d stderr=%q", code, errOut)
+	}
+	for _, want := range []string{"LISTEN_ADDR=127.0.0.1:9000\n", "WORKER_POOL_SIZE=3\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+
+	if code, _, errOut := runCommand(t, "config", "print", "-server.port", "0"); code != exitFailure || !strings.Contains(errOut, "server.port") {
+		t.Errorf("Invalid config should fail: code=%d stderr=%q", code, errOut)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	dir := t.TempDir()
+	if code, out, _ := runCommand(t, "check", "-data-dir", dir); code != exitSuccess {
+		t.Errorf("check should pass on an empty data dir: code=%d out=%q", code, out)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "leaderboard.json"), []byte("{broken"), 0644); err != nil {
+		t.Fatalf("write leaderboard: %v", err)
+	}
+	code, out, _ := runCommand(t, "check", "-data-dir", dir, "-static-dir", filepath.Join(dir, "missing"))
+	if code != exitFailure {
+		t.Errorf("check should fail, got code=%d", code)
+	}
+	// 排行榜損毀且沒有備份時無法開啟儲存
+	for _, want := range []string{"FAIL  static", "FAIL  storage", "leaderboard"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if code, _, errOut := runCommand(t, "bogus"); code != exitBadArgs || !strings.Contains(errOut, `unknown command "bogus"`) {
+		t.Errorf("unknown command: code=%d stderr=%q", code, errOut)
+	}
+}
+
+func TestBoltBackendCommands(t *testing.T) {
+	dir := t.TempDir()
+	repo := repository.NewFileLeaderboardRepository(filepath.Join(dir, "leaderboard.json"))
+	repo.Add(models.GameScore{Nickname: "Legacy", Tries: 2, Time: 9})
+
+	if code, out, _ := runCommand(t, "check", "-data-dir", dir, "-storage.backend", "bolt"); code != exitSuccess || !strings.Contains(out, "will be created") {
+		t.Errorf("check before the database exists: code=%d out=%q", code, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "chatroom.db")); !os.IsNotExist(err) {
+		t.Errorf("check should not create the database, stat err=%v", err)
+	}
+
+	// 第一次開啟資料庫時匯入原本的排行榜
+	code, out, errOut := runCommand(t, "leaderboard", "list", "-data-dir", dir, "-storage.backend", "bolt")
+	if code != exitSuccess || !strings.Contains(out, "Legacy") {
+		t.Errorf("list: code=%d out=%q stderr=%q", code, out, errOut)
+	}
+
+	code, out, _ = runCommand(t, "check", "-data-dir", dir, "-storage.backend", "bolt")
+	if code != exitSuccess || !strings.Contains(out, "schema v") || !strings.Contains(out, "(1 scores)") {
+		t.Errorf("check: code=%d out=%q", code, out)
+	}
+}
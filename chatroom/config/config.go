@@ -1,8 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
 	"time"
 )
 
@@ -12,108 +13,321 @@ type Config struct {
 	WebSocket WSConfig
 	Storage   StorageConfig
 	RateLimit RateLimitConfig
+	Presence  PresenceConfig
+	Room      RoomConfig
+	Pool      PoolConfig
+	Log       LogConfig
+
+	// 載入時遇到的格式錯誤，由 Validate 一併回報
+	errs []error
 }
 
 // ServerConfig 伺服器配置
 type ServerConfig struct {
 	Port            string
+	Addr            string // 監聽位址（例如 127.0.0.1:8080），空白時監聽所有介面的 Port
+	StaticDir       string // 從磁碟提供靜態檔案的目錄（前端開發用），空白時使用內嵌於執行檔的檔案
 	ReadTimeout     time.Duration
 	WriteTimeout    time.Duration
 	ShutdownTimeout time.Duration
+	// RestartRetryAfter 關機時建議客戶端重新連線前等待的時間
+	RestartRetryAfter time.Duration
 }
 
 // WSConfig WebSocket 配置
 type WSConfig struct {
-	MaxMessageSize  int64
-	PingInterval    time.Duration
-	PongWait        time.Duration
-	WriteWait       time.Duration
-	ReadBufferSize  int
-	WriteBufferSize int
+	MaxMessageSize   int64 // 單一 WebSocket 訊息的位元組上限；圖片與語音另外上傳，只需容納文字與自訂頭像
+	MaxContentLength int   // 聊天訊息內容的字數上限
+	PingInterval     time.Duration
+	PongWait         time.Duration
+	WriteWait        time.Duration
+	ReadBufferSize   int
+	WriteBufferSize  int
+	// ResumeGrace 連線中斷後保留 session 的時間，0 表示停用連線恢復
+	ResumeGrace time.Duration
+
+	// 連線數限制（在 Upgrade 之前檢查），0 表示不限
+	MaxConnections      int
+	MaxConnsPerIP       int
+	MaxConnsPerUser     int
+	AdmissionRetryAfter time.Duration // 連線被拒絕時建議的重試等待時間
+	TrustProxy          bool          // 是否以 X-Forwarded-For 判斷客戶端 IP
+	ProxyHops           int           // 前方受信任的反向代理層數，客戶端 IP 取 X-Forwarded-For 從右數第 ProxyHops 個位址
 }
 
 // StorageConfig 儲存配置
 type StorageConfig struct {
-	LeaderboardFile string
-	HistoryMaxSize  int
+	Backend            string // file（JSON 檔案）或 bolt（嵌入式資料庫，另外保存聊天記錄與使用者資料）
+	DatabaseFile       string // bolt 使用的資料庫檔案
+	DataDir            string // 資料檔目錄，相對路徑的資料檔放在此目錄下，空白表示目前目錄
+	LeaderboardFile    string
+	LeaderboardSize    int    // 排行榜顯示的名次數
+	LeaderboardBackups int    // 檔案儲存時保留的排行榜備份數，檔案損毀時從最新的有效備份復原
+	LeaderboardsDir    string // 檔案儲存時其他排行榜（其他遊戲、每日、每週、各房間）的目錄
+	RoomsFile          string // 永久房間資料檔
+	HistoryMaxSize     int
+	MediaDir           string // 上傳的圖片與語音存放的目錄
+	MediaMaxSize       int64  // 上傳檔案的大小上限（位元組）
+	MediaMaxPixels     int    // 圖片寬 × 高的上限（動畫為所有影格合計），超過時不解碼
+	MediaThumbnailSize int    // 聊天記錄中縮圖的最長邊
+	MediaAvatarSize    int    // 自訂頭像的邊長
+}
+
+// DefaultMessageCosts 各訊息類型消耗的令牌數，一般聊天訊息為 1，未列出的類型也是 1
+var DefaultMessageCosts = map[string]float64{
+	"ack":          0,
+	"mark_read":    0,
+	"typing_stop":  0,
+	"typing":       0.2,
+	"presence":     0.5,
+	"draw_move":    0.02,
+	"draw_start":   0.1,
+	"draw_end":     0.1,
+	"clear_canvas": 1,
+	"upload":       5, // 圖片與語音先以 HTTP 上傳，訊息本身只攜帶網址
+	"vote":         10,
+	"quiz_start":   10,
 }
 
 // RateLimitConfig 限流配置
 type RateLimitConfig struct {
 	Enabled     bool
-	MaxMessages int
+	MaxMessages int // 每個使用者或連線在時間窗口內補充的令牌數
 	TimeWindow  time.Duration
+	Burst       int // 使用者與連線可累積的令牌數，0 表示與 MaxMessages 相同
+
+	IPMaxMessages int // 每個 IP 在時間窗口內補充的令牌數
+	IPBurst       int // 每個 IP 可累積的令牌數，0 表示與 IPMaxMessages 相同
+
+	Costs map[string]float64 // 覆寫各訊息類型消耗的令牌數
+
+	// 重複違規的處置，0 表示停用該步驟
+	ViolationWindow time.Duration // 超過此時間沒有違規即重新計算次數
+	MuteAfter       int           // 違規幾次後暫時禁止發言
+	MuteDuration    time.Duration // 暫時禁止發言的時間
+	DisconnectAfter int           // 違規幾次後中斷連線
 }
 
-// Load 從環境變數載入配置
-func Load() *Config {
+// PresenceConfig 在線狀態與輸入提示配置
+type PresenceConfig struct {
+	IdleAfter      time.Duration // 多久沒有收到訊息自動變為閒置，0 表示停用
+	TypingTTL      time.Duration // 輸入提示自動過期時間
+	TypingThrottle time.Duration // 同一使用者輸入提示的最短廣播間隔
+}
+
+// RoomConfig 房間配置
+type RoomConfig struct {
+	ReadReceiptMaxMembers int           // 成員數不超過此值的房間會廣播已讀回條，0 表示停用
+	PasswordMaxAttempts   int           // 鎖定時間內密碼錯誤幾次後鎖定，0 表示不限制
+	PasswordLockout       time.Duration // 密碼錯誤過多後的鎖定時間
+	MaxMembers            int           // 每個房間預設的人數上限（大廳除外），0 表示不限
+	MaxTotalMembers       int           // 全站同時在線的使用者上限，0 表示不限
+	Waitlist              bool          // 房間已滿時是否排隊等候空位
+	LobbyName             string        // 預設大廳名稱
+}
+
+// PoolConfig Worker Pool 配置
+type PoolConfig struct {
+	Workers   int // worker 數量
+	QueueSize int // 任務佇列長度
+}
+
+// LogConfig 日誌配置
+type LogConfig struct {
+	Level string // debug、info、warn 或 error
+}
+
+// 儲存方式
+const (
+	StorageFile = "file"
+	StorageBolt = "bolt"
+)
+
+// DefaultLobbyName 預設大廳名稱
+const DefaultLobbyName = "聊天大廳"
+
+// Default 內建的預設配置
+func Default() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port:            getEnv("PORT", "8080"),
-			ReadTimeout:     getDuration("READ_TIMEOUT", 15*time.Second),
-			WriteTimeout:    getDuration("WRITE_TIMEOUT", 15*time.Second),
-			ShutdownTimeout: getDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+			Port:              "8080",
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      15 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			RestartRetryAfter: 5 * time.Second,
 		},
 		WebSocket: WSConfig{
-			MaxMessageSize:  getInt64("WS_MAX_MESSAGE_SIZE", 5*1024*1024), // 5MB
-			PingInterval:    getDuration("WS_PING_INTERVAL", 54*time.Second),
-			PongWait:        getDuration("WS_PONG_WAIT", 60*time.Second),
-			WriteWait:       getDuration("WS_WRITE_WAIT", 10*time.Second),
-			ReadBufferSize:  getInt("WS_READ_BUFFER", 1024),
-			WriteBufferSize: getInt("WS_WRITE_BUFFER", 1024),
+			MaxMessageSize:   64 * 1024, // 64KB
+			MaxContentLength: 2000,
+			PingInterval:     54 * time.Second,
+			PongWait:         60 * time.Second,
+			WriteWait:        10 * time.Second,
+			ReadBufferSize:   1024,
+			WriteBufferSize:  1024,
+			ResumeGrace:      30 * time.Second,
+
+			MaxConnections:      5000,
+			MaxConnsPerIP:       20,
+			MaxConnsPerUser:     5,
+			AdmissionRetryAfter: 10 * time.Second,
+			ProxyHops:           1,
 		},
 		Storage: StorageConfig{
-			LeaderboardFile: getEnv("LEADERBOARD_FILE", "leaderboard.json"),
-			HistoryMaxSize:  getInt("HISTORY_MAX_SIZE", 100),
+			Backend:            StorageFile,
+			DatabaseFile:       "chatroom.db",
+			LeaderboardFile:    "leaderboard.json",
+			LeaderboardSize:    10,
+			LeaderboardBackups: 3,
+			LeaderboardsDir:    "leaderboards",
+			RoomsFile:          "rooms.json",
+			HistoryMaxSize:     100,
+			MediaDir:           "media",
+			MediaMaxSize:       5 * 1024 * 1024, // 5MB
+			MediaMaxPixels:     16_000_000,
+			MediaThumbnailSize: 320,
+			MediaAvatarSize:    96,
 		},
 		RateLimit: RateLimitConfig{
-			Enabled:     getBool("RATE_LIMIT_ENABLED", true),
-			MaxMessages: getInt("RATE_LIMIT_MAX_MSG", 10),
-			TimeWindow:  getDuration("RATE_LIMIT_WINDOW", 10*time.Second),
+			Enabled:     true,
+			MaxMessages: 10,
+			TimeWindow:  10 * time.Second,
+			Burst:       10,
+
+			IPMaxMessages: 50,
+			IPBurst:       50,
+
+			Costs: make(map[string]float64),
+
+			ViolationWindow: time.Minute,
+			MuteAfter:       5,
+			MuteDuration:    30 * time.Second,
+			DisconnectAfter: 10,
+		},
+		Presence: PresenceConfig{
+			IdleAfter:      5 * time.Minute,
+			TypingTTL:      5 * time.Second,
+			TypingThrottle: 2 * time.Second,
+		},
+		Room: RoomConfig{
+			ReadReceiptMaxMembers: 10,
+			PasswordMaxAttempts:   5,
+			PasswordLockout:       time.Minute,
+			LobbyName:             DefaultLobbyName,
+		},
+		Pool: PoolConfig{
+			Workers:   10,
+			QueueSize: 100,
+		},
+		Log: LogConfig{
+			Level: "info",
 		},
 	}
 }
 
-// 輔助函數
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// ListenAddr HTTP 伺服器的監聽位址
+func (s ServerConfig) ListenAddr() string {
+	if s.Addr != "" {
+		return s.Addr
 	}
-	return defaultValue
+	return ":" + s.Port
 }
 
-func getInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intVal, err := strconv.Atoi(value); err == nil {
-			return intVal
-		}
+// Path 資料檔的實際路徑：相對路徑放在 DataDir 下
+func (s StorageConfig) Path(file string) string {
+	if s.DataDir == "" || filepath.IsAbs(file) {
+		return file
 	}
-	return defaultValue
+	return filepath.Join(s.DataDir, file)
 }
 
-func getInt64(key string, defaultValue int64) int64 {
-	if value := os.Getenv(key); value != "" {
-		if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
-			return intVal
-		}
-	}
-	return defaultValue
+// Load 以預設值加上環境變數載入配置；格式錯誤的值保留預設值，並由 Validate 回報
+func Load() *Config {
+	cfg := Default()
+	cfg.applyEnv()
+	return cfg
 }
 
-func getBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		if boolVal, err := strconv.ParseBool(value); err == nil {
-			return boolVal
-		}
+// Fields 所有可由設定檔、環境變數與命令列設定的配置項
+func (c *Config) Fields() []Field {
+	return []Field{
+		{"server.port", "PORT", (*stringValue)(&c.Server.Port)},
+		{"server.addr", "LISTEN_ADDR", (*stringValue)(&c.Server.Addr)},
+		{"server.static_dir", "STATIC_DIR", (*stringValue)(&c.Server.StaticDir)},
+		{"server.read_timeout", "READ_TIMEOUT", (*durationValue)(&c.Server.ReadTimeout)},
+		{"server.write_timeout", "WRITE_TIMEOUT", (*durationValue)(&c.Server.WriteTimeout)},
+		{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", (*durationValue)(&c.Server.ShutdownTimeout)},
+		{"server.restart_retry_after", "SHUTDOWN_RETRY_AFTER", (*durationValue)(&c.Server.RestartRetryAfter)},
+
+		{"websocket.max_message_size", "WS_MAX_MESSAGE_SIZE", (*int64Value)(&c.WebSocket.MaxMessageSize)},
+		{"websocket.max_content_length", "WS_MAX_CONTENT_LENGTH", (*intValue)(&c.WebSocket.MaxContentLength)},
+		{"websocket.ping_interval", "WS_PING_INTERVAL", (*durationValue)(&c.WebSocket.PingInterval)},
+		{"websocket.pong_wait", "WS_PONG_WAIT", (*durationValue)(&c.WebSocket.PongWait)},
+		{"websocket.write_wait", "WS_WRITE_WAIT", (*durationValue)(&c.WebSocket.WriteWait)},
+		{"websocket.read_buffer_size", "WS_READ_BUFFER", (*intValue)(&c.WebSocket.ReadBufferSize)},
+		{"websocket.write_buffer_size", "WS_WRITE_BUFFER", (*intValue)(&c.WebSocket.WriteBufferSize)},
+		{"websocket.resume_grace", "WS_RESUME_GRACE", (*durationValue)(&c.WebSocket.ResumeGrace)},
+		{"websocket.max_connections", "WS_MAX_CONNECTIONS", (*intValue)(&c.WebSocket.MaxConnections)},
+		{"websocket.max_conns_per_ip", "WS_MAX_CONNS_PER_IP", (*intValue)(&c.WebSocket.MaxConnsPerIP)},
+		{"websocket.max_conns_per_user", "WS_MAX_CONNS_PER_USER", (*intValue)(&c.WebSocket.MaxConnsPerUser)},
+		{"websocket.admission_retry_after", "WS_ADMISSION_RETRY_AFTER", (*durationValue)(&c.WebSocket.AdmissionRetryAfter)},
+		{"websocket.trust_proxy", "WS_TRUST_PROXY", (*boolValue)(&c.WebSocket.TrustProxy)},
+		{"websocket.proxy_hops", "WS_PROXY_HOPS", (*intValue)(&c.WebSocket.ProxyHops)},
+
+		{"storage.backend", "STORAGE_BACKEND", (*stringValue)(&c.Storage.Backend)},
+		{"storage.database_file", "DATABASE_FILE", (*stringValue)(&c.Storage.DatabaseFile)},
+		{"storage.data_dir", "DATA_DIR", (*stringValue)(&c.Storage.DataDir)},
+		{"storage.leaderboard_file", "LEADERBOARD_FILE", (*stringValue)(&c.Storage.LeaderboardFile)},
+		{"storage.leaderboard_size", "LEADERBOARD_SIZE", (*intValue)(&c.Storage.LeaderboardSize)},
+		{"storage.leaderboard_backups", "LEADERBOARD_BACKUPS", (*intValue)(&c.Storage.LeaderboardBackups)},
+		{"storage.leaderboards_dir", "LEADERBOARDS_DIR", (*stringValue)(&c.Storage.LeaderboardsDir)},
+		{"storage.rooms_file", "ROOMS_FILE", (*stringValue)(&c.Storage.RoomsFile)},
+		{"storage.history_max_size", "HISTORY_MAX_SIZE", (*intValue)(&c.Storage.HistoryMaxSize)},
+		{"storage.media_dir", "MEDIA_DIR", (*stringValue)(&c.Storage.MediaDir)},
+		{"storage.media_max_size", "MEDIA_MAX_SIZE", (*int64Value)(&c.Storage.MediaMaxSize)},
+		{"storage.media_max_pixels", "MEDIA_MAX_PIXELS", (*intValue)(&c.Storage.MediaMaxPixels)},
+		{"storage.media_thumbnail_size", "MEDIA_THUMBNAIL_SIZE", (*intValue)(&c.Storage.MediaThumbnailSize)},
+		{"storage.media_avatar_size", "MEDIA_AVATAR_SIZE", (*intValue)(&c.Storage.MediaAvatarSize)},
+
+		{"rate_limit.enabled", "RATE_LIMIT_ENABLED", (*boolValue)(&c.RateLimit.Enabled)},
+		{"rate_limit.max_messages", "RATE_LIMIT_MAX_MSG", (*intValue)(&c.RateLimit.MaxMessages)},
+		{"rate_limit.time_window", "RATE_LIMIT_WINDOW", (*durationValue)(&c.RateLimit.TimeWindow)},
+		{"rate_limit.burst", "RATE_LIMIT_BURST", (*intValue)(&c.RateLimit.Burst)},
+		{"rate_limit.ip_max_messages", "RATE_LIMIT_IP_MAX_MSG", (*intValue)(&c.RateLimit.IPMaxMessages)},
+		{"rate_limit.ip_burst", "RATE_LIMIT_IP_BURST", (*intValue)(&c.RateLimit.IPBurst)},
+		{"rate_limit.costs", "RATE_LIMIT_COSTS", (*costsValue)(&c.RateLimit.Costs)},
+		{"rate_limit.violation_window", "RATE_LIMIT_VIOLATION_WINDOW", (*durationValue)(&c.RateLimit.ViolationWindow)},
+		{"rate_limit.mute_after", "RATE_LIMIT_MUTE_AFTER", (*intValue)(&c.RateLimit.MuteAfter)},
+		{"rate_limit.mute_duration", "RATE_LIMIT_MUTE_DURATION", (*durationValue)(&c.RateLimit.MuteDuration)},
+		{"rate_limit.disconnect_after", "RATE_LIMIT_DISCONNECT_AFTER", (*intValue)(&c.RateLimit.DisconnectAfter)},
+
+		{"presence.idle_after", "PRESENCE_IDLE_AFTER", (*durationValue)(&c.Presence.IdleAfter)},
+		{"presence.typing_ttl", "TYPING_TTL", (*durationValue)(&c.Presence.TypingTTL)},
+		{"presence.typing_throttle", "TYPING_THROTTLE", (*durationValue)(&c.Presence.TypingThrottle)},
+
+		{"room.read_receipt_max_members", "READ_RECEIPT_MAX_MEMBERS", (*intValue)(&c.Room.ReadReceiptMaxMembers)},
+		{"room.password_max_attempts", "ROOM_PASSWORD_MAX_ATTEMPTS", (*intValue)(&c.Room.PasswordMaxAttempts)},
+		{"room.password_lockout", "ROOM_PASSWORD_LOCKOUT", (*durationValue)(&c.Room.PasswordLockout)},
+		{"room.max_members", "ROOM_MAX_MEMBERS", (*intValue)(&c.Room.MaxMembers)},
+		{"room.max_total_members", "ROOM_MAX_TOTAL_MEMBERS", (*intValue)(&c.Room.MaxTotalMembers)},
+		{"room.waitlist", "ROOM_WAITLIST", (*boolValue)(&c.Room.Waitlist)},
+		{"room.lobby_name", "LOBBY_NAME", (*stringValue)(&c.Room.LobbyName)},
+
+		{"pool.workers", "WORKER_POOL_SIZE", (*intValue)(&c.Pool.Workers)},
+		{"pool.queue_size", "WORKER_QUEUE_SIZE", (*intValue)(&c.Pool.QueueSize)},
+
+		{"log.level", "LOG_LEVEL", (*stringValue)(&c.Log.Level)},
 	}
-	return defaultValue
 }
 
-func getDuration(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
-			return duration
+// applyEnv 以環境變數覆寫配置
+func (c *Config) applyEnv() {
+	for _, f := range c.Fields() {
+		value, ok := os.LookupEnv(f.Env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := f.Value.Set(value); err != nil {
+			c.errs = append(c.errs, &FieldError{Key: f.Key, Err: fmt.Errorf("%s=%q: %w", f.Env, value, err)})
 		}
 	}
-	return defaultValue
 }
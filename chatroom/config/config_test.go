@@ -0,0 +1,198 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("Default config should be valid: %v", err)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "chatroom.yaml", `
+server:
+  port: 9000
+  read_timeout: 20s
+storage:
+  history_max_size: 50
+rate_limit:
+  costs:
+    image: 8
+room:
+  lobby_name: 大廳
+pool:
+  workers: 4
+`)
+	t.Setenv("HISTORY_MAX_SIZE", "70")
+	t.Setenv("WORKER_POOL_SIZE", "6")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader(fs)
+	if err := fs.Parse([]string{"-config", path, "-pool.workers=8", "-websocket.trust_proxy"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// 設定檔覆寫預設值
+	if cfg.Server.Port != "9000" || cfg.Server.ReadTimeout != 20*time.Second || cfg.Room.LobbyName != "大廳" {
+		t.Errorf("File values not applied: port=%s read_timeout=%s lobby=%s",
+			cfg.Server.Port, cfg.Server.ReadTimeout, cfg.Room.LobbyName)
+	}
+	if cfg.RateLimit.Costs["image"] != 8 {
+		t.Errorf("Expected image cost 8 from file, got %v", cfg.RateLimit.Costs["image"])
+	}
+	// 環境變數覆寫設定檔
+	if cfg.Storage.HistoryMaxSize != 70 {
+		t.Errorf("Expected env to override file, got %d", cfg.Storage.HistoryMaxSize)
+	}
+	// 命令列覆寫環境變數
+	if cfg.Pool.Workers != 8 || !cfg.WebSocket.TrustProxy {
+		t.Errorf("Expected flags to override env, got workers=%d trust_proxy=%v", cfg.Pool.Workers, cfg.WebSocket.TrustProxy)
+	}
+	// 沒有指定的值維持預設
+	if cfg.Pool.QueueSize != 100 {
+		t.Errorf("Expected default queue size, got %d", cfg.Pool.QueueSize)
+	}
+}
+
+func TestLoadJSONFile(t *testing.T) {
+	path := writeFile(t, "chatroom.json", `{"server": {"port": "7000"}, "room": {"waitlist": true}}`)
+
+	cfg := Default()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if cfg.Server.Port != "7000" || !cfg.Room.Waitlist {
+		t.Errorf("JSON values not applied: port=%s waitlist=%v", cfg.Server.Port, cfg.Room.Waitlist)
+	}
+}
+
+func TestValidateReportsEveryBadValue(t *testing.T) {
+	path := writeFile(t, "bad.yaml", `
+server:
+  port: 99999
+websocket:
+  ping_interval: 90s
+storage:
+  leaderbord_file: typo.json
+  history_max_size: 0
+pool:
+  workers: 0
+`)
+	t.Setenv("RATE_LIMIT_WINDOW", "ten seconds")
+	t.Setenv("WS_MAX_CONNECTIONS", "many")
+
+	cfg := Default()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	cfg.applyEnv()
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, key := range []string{
+		"server.port",
+		"websocket.ping_interval",
+		"storage.leaderbord_file",
+		"storage.history_max_size",
+		"pool.workers",
+		"rate_limit.time_window",
+		"websocket.max_connections",
+	} {
+		if !strings.Contains(err.Error(), key+":") {
+			t.Errorf("Expected error for %s, got:\n%v", key, err)
+		}
+	}
+
+	// 格式錯誤的環境變數不套用，保留原本的值
+	if cfg.RateLimit.TimeWindow != 10*time.Second {
+		t.Errorf("Malformed env should keep previous value, got %s", cfg.RateLimit.TimeWindow)
+	}
+}
+
+func TestValidateCostWithinBurst(t *testing.T) {
+	cfg := Default()
+	cfg.RateLimit.Burst = 5
+	cfg.RateLimit.Costs = map[string]float64{"chat": 60}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{
+		`cost of "vote" (10) exceeds rate_limit.burst (5)`,
+		`cost of "chat" (60) exceeds rate_limit.ip_burst (50)`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q, got:\n%v", want, err)
+		}
+	}
+
+	// 停用限流時不檢查
+	cfg.RateLimit.Enabled = false
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Costs should not be checked when rate limiting is disabled: %v", err)
+	}
+}
+
+func TestLoadFileSyntaxError(t *testing.T) {
+	path := writeFile(t, "broken.yaml", "server: [port")
+	if err := Default().LoadFile(path); err == nil {
+		t.Error("Expected parse error")
+	}
+}
+
+func TestExampleConfigIsValid(t *testing.T) {
+	cfg := Default()
+	if err := cfg.LoadFile("../config.example.yaml"); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("config.example.yaml should be valid: %v", err)
+	}
+}
+
+func TestWriteYAMLRoundTrip(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = "9090"
+	cfg.Room.LobbyName = "大廳: 一樓"
+	cfg.RateLimit.Costs = map[string]float64{"image": 8, "vote": 9}
+	cfg.WebSocket.TrustProxy = true
+
+	var buf strings.Builder
+	if err := cfg.WriteYAML(&buf); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+
+	loaded := Default()
+	if err := loaded.LoadFile(writeFile(t, "printed.yaml", buf.String())); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if err := loaded.Validate(); err != nil {
+		t.Fatalf("Printed config should be valid: %v", err)
+	}
+	if changes := Diff(cfg, loaded); len(changes) != 0 {
+		t.Errorf("Printed config should load back unchanged, got %+v", changes)
+	}
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFile 以設定檔（YAML 或 JSON）覆寫配置。
+// 無法讀取或解析檔案時回傳錯誤；個別鍵的錯誤（未知的鍵、格式錯誤）由 Validate 回報。
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	// JSON 是 YAML 的子集，兩種格式都以 YAML 解析
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	fields := make(map[string]Field)
+	for _, f := range c.Fields() {
+		fields[f.Key] = f
+	}
+
+	values := make(map[string]string)
+	flatten("", doc, fields, values)
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f, ok := fields[key]
+		if !ok {
+			c.errs = append(c.errs, &FieldError{Key: key, Err: fmt.Errorf("unknown key in %s", path)})
+			continue
+		}
+		if err := f.Value.Set(values[key]); err != nil {
+			c.errs = append(c.errs, &FieldError{Key: key, Err: fmt.Errorf("%s: %w", path, err)})
+		}
+	}
+	return nil
+}
+
+// flatten 將巢狀的設定檔展開為 "server.port" 形式的鍵；已知配置項的值即使是物件也不再展開
+func flatten(prefix string, node map[string]any, fields map[string]Field, out map[string]string) {
+	for name, value := range node {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		child, isMap := value.(map[string]any)
+		if _, known := fields[key]; known || !isMap {
+			out[key] = formatValue(value)
+			continue
+		}
+		flatten(key, child, fields, out)
+	}
+}
+
+// formatValue 將設定檔中的值轉為配置項可以解析的字串
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case map[string]any:
+		// 例如 rate_limit.costs: {image: 5, vote: 10}
+		items := make([]string, 0, len(v))
+		for name, item := range v {
+			items = append(items, fmt.Sprintf("%s=%v", name, item))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Loader 依優先順序載入配置：預設值 < 設定檔 < 環境變數 < 命令列參數
+type Loader struct {
+	path      string
+	overrides []override
+}
+
+// override 命令列指定的配置項
+type override struct {
+	key   string
+	value string
+}
+
+// NewLoader 在 FlagSet 上註冊 -config 與每個配置項的參數（例如 -server.port=9090）
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{}
+	fs.StringVar(&l.path, "config", os.Getenv("CONFIG_FILE"), "設定檔路徑（YAML 或 JSON），也可用 CONFIG_FILE 指定")
+
+	defaults := Default()
+	for _, f := range defaults.Fields() {
+		fs.Var(&flagValue{loader: l, key: f.Key, value: f.Value}, f.Key,
+			fmt.Sprintf("覆寫 %s（環境變數 %s）", f.Key, f.Env))
+	}
+	return l
+}
+
+// Alias 為配置項註冊較短的命令列參數名稱，例如 -data-dir 對應 storage.data_dir
+func (l *Loader) Alias(fs *flag.FlagSet, name, key, usage string) {
+	for _, f := range Default().Fields() {
+		if f.Key == key {
+			fs.Var(&flagValue{loader: l, key: key, value: f.Value}, name, usage)
+			return
+		}
+	}
+	panic("config: unknown key " + key)
+}
+
+// Load 解析命令列之後呼叫，載入並驗證配置
+func (l *Loader) Load() (*Config, error) {
+	cfg := Default()
+	if l.path != "" {
+		if err := cfg.LoadFile(l.path); err != nil {
+			return nil, err
+		}
+	}
+	cfg.applyEnv()
+
+	fields := make(map[string]Field)
+	for _, f := range cfg.Fields() {
+		fields[f.Key] = f
+	}
+	for _, o := range l.overrides {
+		if err := fields[o.key].Value.Set(o.value); err != nil {
+			cfg.errs = append(cfg.errs, &FieldError{Key: o.key, Err: fmt.Errorf("-%s: %w", o.key, err)})
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// ConfigPath 使用的設定檔路徑，沒有指定時為空字串
+func (l *Loader) ConfigPath() string {
+	return l.path
+}
+
+// flagValue 記錄命令列參數，等設定檔與環境變數載入後才套用
+type flagValue struct {
+	loader *Loader
+	key    string
+	value  flag.Value // 用於顯示預設值與判斷是否為布林參數
+}
+
+func (v *flagValue) String() string {
+	if v == nil || v.value == nil {
+		return ""
+	}
+	return v.value.String()
+}
+
+func (v *flagValue) Set(s string) error {
+	// 先以預設值的型別檢查格式，讓錯誤在解析命令列時就出現
+	if err := v.value.Set(s); err != nil {
+		return err
+	}
+	v.loader.overrides = append(v.loader.overrides, override{key: v.key, value: s})
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	b, ok := v.value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
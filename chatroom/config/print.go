@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WriteYAML 以設定檔格式輸出所有配置項，輸出內容可以直接作為 -config 使用
+func (c *Config) WriteYAML(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := make(map[string]*yaml.Node)
+	for _, f := range c.Fields() {
+		name, key, _ := strings.Cut(f.Key, ".")
+		section, ok := sections[name]
+		if !ok {
+			section = &yaml.Node{Kind: yaml.MappingNode}
+			sections[name] = section
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, section)
+		}
+
+		value := &yaml.Node{Kind: yaml.ScalarNode, Value: f.Value.String()}
+		switch f.Value.(type) {
+		case *stringValue, *costsValue:
+			// 字串一律以字串輸出，例如 port: "8080" 不會被當成數字
+			value.Tag = "!!str"
+		}
+		section.Content = append(section.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// WriteEnv 以環境變數格式輸出所有配置項（每行 NAME=value，必要時加上單引號）
+func (c *Config) WriteEnv(w io.Writer) error {
+	for _, f := range c.Fields() {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", f.Env, shellQuote(f.Value.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shellQuote 值含有 shell 特殊字元時以單引號包住
+func shellQuote(s string) string {
+	safe := s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_-.,:=/+@", r))
+	}) < 0
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
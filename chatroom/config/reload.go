@@ -0,0 +1,86 @@
+package config
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+)
+
+// liveKeys 執行中可以直接套用的配置項，以 "." 結尾者表示整個區段
+var liveKeys = []string{
+	"rate_limit.",
+	"storage.history_max_size",
+	"pool.workers",
+	"log.level",
+}
+
+// IsLive 配置項是否可以不重新啟動就套用
+func IsLive(key string) bool {
+	for _, live := range liveKeys {
+		if key == live || (strings.HasSuffix(live, ".") && strings.HasPrefix(key, live)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Change 配置項的變更
+type Change struct {
+	Key string
+	Old string
+	New string
+}
+
+// Diff 比較兩份配置，回傳有變更的配置項
+func Diff(old, new *Config) []Change {
+	newFields := new.Fields()
+	var changes []Change
+	for i, f := range old.Fields() {
+		before, after := f.Value.String(), newFields[i].Value.String()
+		if before != after {
+			changes = append(changes, Change{Key: f.Key, Old: before, New: after})
+		}
+	}
+	return changes
+}
+
+// Clone 深層複製配置
+func (c *Config) Clone() *Config {
+	clone := *c
+	clone.RateLimit.Costs = make(map[string]float64, len(c.RateLimit.Costs))
+	for msgType, cost := range c.RateLimit.Costs {
+		clone.RateLimit.Costs[msgType] = cost
+	}
+	clone.errs = nil
+	return &clone
+}
+
+// WatchFile 定期檢查檔案的修改時間與大小，有變化時呼叫 onChange，直到 ctx 結束
+func WatchFile(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
+
+	lastMod, lastSize := stat()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			mod, size := stat()
+			if mod.Equal(lastMod) && size == lastSize {
+				continue
+			}
+			lastMod, lastSize = mod, size
+			onChange()
+		}
+	}
+}
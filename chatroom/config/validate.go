@@ -0,0 +1,183 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate 檢查所有配置項，回報載入時的格式錯誤與每個不合理的值（錯誤訊息以鍵開頭）
+func (c *Config) Validate() error {
+	v := &validator{errs: append([]error(nil), c.errs...)}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		v.fail("server.port", "must be a port number between 1 and 65535, got %q", c.Server.Port)
+	}
+	if c.Server.Addr != "" {
+		if _, port, err := net.SplitHostPort(c.Server.Addr); err != nil || port == "" {
+			v.fail("server.addr", "must be host:port (e.g. 127.0.0.1:8080), got %q", c.Server.Addr)
+		}
+	}
+	v.positiveDuration("server.read_timeout", c.Server.ReadTimeout)
+	v.positiveDuration("server.write_timeout", c.Server.WriteTimeout)
+	v.positiveDuration("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	v.nonNegativeDuration("server.restart_retry_after", c.Server.RestartRetryAfter)
+
+	if c.WebSocket.MaxMessageSize <= 0 {
+		v.fail("websocket.max_message_size", "must be positive, got %d", c.WebSocket.MaxMessageSize)
+	}
+	v.positive("websocket.max_content_length", c.WebSocket.MaxContentLength)
+	v.positiveDuration("websocket.ping_interval", c.WebSocket.PingInterval)
+	v.positiveDuration("websocket.pong_wait", c.WebSocket.PongWait)
+	v.positiveDuration("websocket.write_wait", c.WebSocket.WriteWait)
+	if c.WebSocket.PingInterval >= c.WebSocket.PongWait && c.WebSocket.PongWait > 0 {
+		v.fail("websocket.ping_interval", "must be shorter than websocket.pong_wait (%s), got %s",
+			c.WebSocket.PongWait, c.WebSocket.PingInterval)
+	}
+	v.positive("websocket.read_buffer_size", c.WebSocket.ReadBufferSize)
+	v.positive("websocket.write_buffer_size", c.WebSocket.WriteBufferSize)
+	v.nonNegativeDuration("websocket.resume_grace", c.WebSocket.ResumeGrace)
+	v.nonNegative("websocket.max_connections", c.WebSocket.MaxConnections)
+	v.nonNegative("websocket.max_conns_per_ip", c.WebSocket.MaxConnsPerIP)
+	v.nonNegative("websocket.max_conns_per_user", c.WebSocket.MaxConnsPerUser)
+	v.nonNegativeDuration("websocket.admission_retry_after", c.WebSocket.AdmissionRetryAfter)
+	v.positive("websocket.proxy_hops", c.WebSocket.ProxyHops)
+
+	switch c.Storage.Backend {
+	case StorageFile:
+	case StorageBolt:
+		v.required("storage.database_file", c.Storage.DatabaseFile)
+	default:
+		v.fail("storage.backend", "must be %q or %q, got %q", StorageFile, StorageBolt, c.Storage.Backend)
+	}
+	v.required("storage.leaderboard_file", c.Storage.LeaderboardFile)
+	v.positive("storage.leaderboard_size", c.Storage.LeaderboardSize)
+	v.nonNegative("storage.leaderboard_backups", c.Storage.LeaderboardBackups)
+	v.required("storage.leaderboards_dir", c.Storage.LeaderboardsDir)
+	v.required("storage.rooms_file", c.Storage.RoomsFile)
+	// 0 在記憶體中表示不保留、在資料庫中表示不裁切，兩者不一致，因此至少保留 1 則
+	v.positive("storage.history_max_size", c.Storage.HistoryMaxSize)
+	v.required("storage.media_dir", c.Storage.MediaDir)
+	if c.Storage.MediaMaxSize <= 0 {
+		v.fail("storage.media_max_size", "must be positive, got %d", c.Storage.MediaMaxSize)
+	}
+	v.positive("storage.media_max_pixels", c.Storage.MediaMaxPixels)
+	v.positive("storage.media_thumbnail_size", c.Storage.MediaThumbnailSize)
+	v.positive("storage.media_avatar_size", c.Storage.MediaAvatarSize)
+
+	if c.RateLimit.Enabled {
+		v.positive("rate_limit.max_messages", c.RateLimit.MaxMessages)
+		v.positiveDuration("rate_limit.time_window", c.RateLimit.TimeWindow)
+		v.costsWithinBurst(c.RateLimit)
+	}
+	v.nonNegative("rate_limit.burst", c.RateLimit.Burst)
+	v.nonNegative("rate_limit.ip_max_messages", c.RateLimit.IPMaxMessages)
+	v.nonNegative("rate_limit.ip_burst", c.RateLimit.IPBurst)
+	v.nonNegativeDuration("rate_limit.violation_window", c.RateLimit.ViolationWindow)
+	v.nonNegative("rate_limit.mute_after", c.RateLimit.MuteAfter)
+	v.nonNegativeDuration("rate_limit.mute_duration", c.RateLimit.MuteDuration)
+	v.nonNegative("rate_limit.disconnect_after", c.RateLimit.DisconnectAfter)
+
+	v.nonNegativeDuration("presence.idle_after", c.Presence.IdleAfter)
+	v.nonNegativeDuration("presence.typing_ttl", c.Presence.TypingTTL)
+	v.nonNegativeDuration("presence.typing_throttle", c.Presence.TypingThrottle)
+
+	v.nonNegative("room.read_receipt_max_members", c.Room.ReadReceiptMaxMembers)
+	v.nonNegative("room.password_max_attempts", c.Room.PasswordMaxAttempts)
+	v.nonNegativeDuration("room.password_lockout", c.Room.PasswordLockout)
+	v.nonNegative("room.max_members", c.Room.MaxMembers)
+	v.nonNegative("room.max_total_members", c.Room.MaxTotalMembers)
+	v.required("room.lobby_name", c.Room.LobbyName)
+	if strings.HasPrefix(c.Room.LobbyName, "_") {
+		v.fail("room.lobby_name", "must not start with \"_\" (reserved for game rooms), got %q", c.Room.LobbyName)
+	}
+
+	v.positive("pool.workers", c.Pool.Workers)
+	v.positive("pool.queue_size", c.Pool.QueueSize)
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		v.fail("log.level", "must be one of debug, info, warn, error, got %q", c.Log.Level)
+	}
+
+	return errors.Join(v.errs...)
+}
+
+// validator 收集驗證錯誤
+type validator struct {
+	errs []error
+}
+
+func (v *validator) fail(key, format string, args ...any) {
+	v.errs = append(v.errs, &FieldError{Key: key, Err: fmt.Errorf(format, args...)})
+}
+
+func (v *validator) required(key, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.fail(key, "must not be empty")
+	}
+}
+
+func (v *validator) positive(key string, value int) {
+	if value <= 0 {
+		v.fail(key, "must be positive, got %d", value)
+	}
+}
+
+func (v *validator) nonNegative(key string, value int) {
+	if value < 0 {
+		v.fail(key, "must not be negative, got %d", value)
+	}
+}
+
+// costsWithinBurst 每種訊息的費用不能超過桶容量，否則該類型永遠無法送出且每次都算違規
+func (v *validator) costsWithinBurst(rl RateLimitConfig) {
+	burst := rl.Burst
+	if burst == 0 {
+		burst = rl.MaxMessages
+	}
+	ipBurst := rl.IPBurst
+	if ipBurst == 0 {
+		ipBurst = rl.IPMaxMessages
+	}
+
+	costs := make(map[string]float64, len(DefaultMessageCosts)+len(rl.Costs))
+	for msgType, cost := range DefaultMessageCosts {
+		costs[msgType] = cost
+	}
+	for msgType, cost := range rl.Costs {
+		costs[msgType] = cost
+	}
+	msgTypes := make([]string, 0, len(costs))
+	for msgType := range costs {
+		msgTypes = append(msgTypes, msgType)
+	}
+	sort.Strings(msgTypes)
+
+	for _, msgType := range msgTypes {
+		cost := costs[msgType]
+		if burst > 0 && cost > float64(burst) {
+			v.fail("rate_limit.costs", "cost of %q (%g) exceeds rate_limit.burst (%d)", msgType, cost, burst)
+		}
+		if ipBurst > 0 && cost > float64(ipBurst) {
+			v.fail("rate_limit.costs", "cost of %q (%g) exceeds rate_limit.ip_burst (%d)", msgType, cost, ipBurst)
+		}
+	}
+}
+
+func (v *validator) positiveDuration(key string, value time.Duration) {
+	if value <= 0 {
+		v.fail(key, "must be positive, got %s", value)
+	}
+}
+
+func (v *validator) nonNegativeDuration(key string, value time.Duration) {
+	if value < 0 {
+		v.fail(key, "must not be negative, got %s", value)
+	}
+}
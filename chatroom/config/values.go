@@ -0,0 +1,139 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field 單一配置項
+type Field struct {
+	Key   string     // 設定檔與命令列使用的鍵，例如 server.port
+	Env   string     // 環境變數名稱
+	Value flag.Value // 指向 Config 中的欄位
+}
+
+// FieldError 配置項的錯誤，訊息以鍵開頭
+type FieldError struct {
+	Key string
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// stringValue 字串配置項
+type stringValue string
+
+func (v *stringValue) String() string { return string(*v) }
+
+func (v *stringValue) Set(s string) error {
+	*v = stringValue(s)
+	return nil
+}
+
+// intValue 整數配置項
+type intValue int
+
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+
+// int64Value 64 位元整數配置項
+type int64Value int64
+
+func (v *int64Value) String() string { return strconv.FormatInt(int64(*v), 10) }
+
+func (v *int64Value) Set(s string) error {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", s)
+	}
+	*v = int64Value(n)
+	return nil
+}
+
+// boolValue 布林配置項
+type boolValue bool
+
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+// IsBoolFlag 命令列可以只寫 -key 表示 true
+func (v *boolValue) IsBoolFlag() bool { return true }
+
+// durationValue 時間長度配置項，例如 10s、5m
+type durationValue time.Duration
+
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q (e.g. 10s, 5m)", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+// costsValue 訊息類型費用，格式為 "image=5,vote=10"，會與現有設定合併
+type costsValue map[string]float64
+
+func (v *costsValue) String() string {
+	items := make([]string, 0, len(*v))
+	for msgType, cost := range *v {
+		items = append(items, msgType+"="+strconv.FormatFloat(cost, 'g', -1, 64))
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func (v *costsValue) Set(s string) error {
+	costs := make(map[string]float64)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		msgType, value, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(msgType) == "" {
+			return fmt.Errorf("invalid cost %q (expected type=cost)", item)
+		}
+		cost, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || cost < 0 {
+			return fmt.Errorf("invalid cost %q (expected a non-negative number)", item)
+		}
+		costs[strings.TrimSpace(msgType)] = cost
+	}
+
+	if *v == nil {
+		*v = make(costsValue)
+	}
+	for msgType, cost := range costs {
+		(*v)[msgType] = cost
+	}
+	return nil
+}
@@ -32,6 +32,60 @@ var (
 	ErrStorageFailure = errors.New("storage operation failed")
 )
 
+// 回傳給客戶端的錯誤，錯誤文字同時作為訊息類型
+var (
+	// ErrPermissionDenied 權限不足
+	ErrPermissionDenied = errors.New("permission_denied")
+
+	// ErrBanned 已被房間封鎖
+	ErrBanned = errors.New("banned")
+
+	// ErrMuted 禁言中
+	ErrMuted = errors.New("muted")
+
+	// ErrTargetNotFound 指令對象不存在
+	ErrTargetNotFound = errors.New("target_not_found")
+
+	// ErrPasswordRequired 房間需要密碼
+	ErrPasswordRequired = errors.New("password_required")
+
+	// ErrWrongPassword 房間密碼錯誤
+	ErrWrongPassword = errors.New("wrong_password")
+
+	// ErrPasswordLockedOut 密碼錯誤次數過多，暫時鎖定
+	ErrPasswordLockedOut = errors.New("password_locked_out")
+
+	// ErrPasswordTooLong 房間密碼超過長度上限
+	ErrPasswordTooLong = errors.New("password_too_long")
+
+	// ErrRoomFull 房間人數已滿
+	ErrRoomFull = errors.New("room_full")
+
+	// ErrInviteOnly 房間僅限受邀成員
+	ErrInviteOnly = errors.New("invite_only")
+
+	// ErrRoomExists 房間已存在
+	ErrRoomExists = errors.New("room_exists")
+
+	// ErrInvalidRoomName 房間名稱無效
+	ErrInvalidRoomName = errors.New("invalid_room_name")
+
+	// ErrInviteInvalid 邀請連結不存在或已撤銷
+	ErrInviteInvalid = errors.New("invite_invalid")
+
+	// ErrInviteExpired 邀請連結已過期
+	ErrInviteExpired = errors.New("invite_expired")
+
+	// ErrInviteExhausted 邀請連結已達使用次數上限
+	ErrInviteExhausted = errors.New("invite_exhausted")
+
+	// ErrInvalidMedia 圖片或語音不是已上傳的檔案
+	ErrInvalidMedia = errors.New("invalid_media")
+
+	// ErrMessageTooLong 訊息內容超過字數上限
+	ErrMessageTooLong = errors.New("message_too_long")
+)
+
 // ChatError 聊天室自訂錯誤
 type ChatError struct {
 	Op      string // 操作名稱
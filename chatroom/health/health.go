@@ -0,0 +1,133 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// 建置資訊，透過 -ldflags 在連結時注入：
+//
+//	go build -ldflags "-X chatroom/health.GitSHA=$(git rev-parse HEAD) -X chatroom/health.BuildTime=$(date -u +%FT%TZ)"
+var (
+	GitSHA    = "unknown"
+	BuildTime = "unknown"
+)
+
+// CheckFunc 就緒檢查函數，回傳 nil 表示正常
+type CheckFunc func() error
+
+// namedCheck 具名的就緒檢查
+type namedCheck struct {
+	name  string
+	check CheckFunc
+}
+
+// Checker 健康與就緒狀態檢查器
+type Checker struct {
+	mu           sync.RWMutex
+	checks       []namedCheck
+	shuttingDown atomic.Bool
+}
+
+// NewChecker 創建新的檢查器
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// AddCheck 註冊就緒檢查
+func (c *Checker) AddCheck(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// SetShuttingDown 標記正在關機，之後 /readyz 一律回傳 503
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// IsShuttingDown 是否正在關機
+func (c *Checker) IsShuttingDown() bool {
+	return c.shuttingDown.Load()
+}
+
+// Ready 執行所有就緒檢查，回傳各檢查的結果與整體是否就緒
+func (c *Checker) Ready() (map[string]string, bool) {
+	c.mu.RLock()
+	checks := make([]namedCheck, len(c.checks))
+	copy(checks, c.checks)
+	c.mu.RUnlock()
+
+	results := make(map[string]string, len(checks)+1)
+	ready := true
+
+	if c.IsShuttingDown() {
+		results["shutdown"] = "in progress"
+		ready = false
+	}
+
+	for _, nc := range checks {
+		if err := nc.check(); err != nil {
+			results[nc.name] = err.Error()
+			ready = false
+		} else {
+			results[nc.name] = "ok"
+		}
+	}
+
+	return results, ready
+}
+
+// BuildInfo 建置資訊
+type BuildInfo struct {
+	GitSHA    string `json:"gitSha"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// GetBuildInfo 獲取建置資訊
+func GetBuildInfo() BuildInfo {
+	return BuildInfo{
+		GitSHA:    GitSHA,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// HandleHealthz 存活檢查：只要程序能回應就是存活
+func (c *Checker) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleReadyz 就緒檢查：所有檢查通過且未在關機時回傳 200，否則 503
+func (c *Checker) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	results, ready := c.Ready()
+
+	status := http.StatusOK
+	state := "ready"
+	if !ready {
+		status = http.StatusServiceUnavailable
+		state = "not ready"
+	}
+
+	writeJSON(w, status, map[string]interface{}{
+		"status": state,
+		"checks": results,
+	})
+}
+
+// HandleVersion 回傳建置資訊
+func (c *Checker) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, GetBuildInfo())
+}
+
+// writeJSON 寫入 JSON 回應
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
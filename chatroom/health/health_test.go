@@ -0,0 +1,57 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChecker(t *testing.T) {
+	t.Run("Healthz always ok", func(t *testing.T) {
+		c := NewChecker()
+		c.AddCheck("broken", func() error { return errors.New("down") })
+
+		rec := httptest.NewRecorder()
+		c.HandleHealthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Readyz reflects checks", func(t *testing.T) {
+		c := NewChecker()
+		healthy := true
+		c.AddCheck("dep", func() error {
+			if !healthy {
+				return errors.New("dep unavailable")
+			}
+			return nil
+		})
+
+		rec := httptest.NewRecorder()
+		c.HandleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected 200 when checks pass, got %d", rec.Code)
+		}
+
+		healthy = false
+		rec = httptest.NewRecorder()
+		c.HandleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503 when a check fails, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Readyz 503 while shutting down", func(t *testing.T) {
+		c := NewChecker()
+		c.SetShuttingDown()
+
+		rec := httptest.NewRecorder()
+		c.HandleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503 during shutdown, got %d", rec.Code)
+		}
+	})
+}
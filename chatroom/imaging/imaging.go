@@ -0,0 +1,277 @@
+// Package imaging 處理上傳的圖片與自訂頭像：解碼驗證、依 EXIF 方向轉正、
+// 產生縮圖與頭像尺寸，並重新編碼以移除 EXIF / GPS 等中繼資料
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// 圖片處理錯誤
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrInvalidImage      = errors.New("invalid image")
+	ErrTooManyPixels     = errors.New("image has too many pixels")
+)
+
+// jpegQuality 重新編碼 JPEG 的品質
+const jpegQuality = 85
+
+// Options 圖片處理選項
+type Options struct {
+	MaxPixels     int // 寬 × 高的上限（動畫為所有影格合計），解碼前檢查以拒絕解壓縮炸彈
+	ThumbnailSize int // 縮圖最長邊
+	AvatarSize    int // 頭像邊長，裁成置中的正方形
+}
+
+// Image 重新編碼後的圖片
+type Image struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Process 驗證並重新編碼上傳的圖片，回傳原尺寸圖片與縮圖。
+// JPEG 依 EXIF 方向轉正後重新編碼為 JPEG，動畫 GIF 保留動畫，其餘格式轉為 PNG；
+// 圖片不超過縮圖尺寸時縮圖與原圖相同。
+func Process(data []byte, opts Options) (full, thumbnail Image, err error) {
+	img, anim, format, err := decode(data, opts.MaxPixels)
+	if err != nil {
+		return Image{}, Image{}, err
+	}
+
+	if anim != nil {
+		full, err = encodeGIF(anim)
+	} else {
+		full, err = encode(img, format == "jpeg")
+	}
+	if err != nil {
+		return Image{}, Image{}, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() <= opts.ThumbnailSize && bounds.Dy() <= opts.ThumbnailSize {
+		return full, full, nil
+	}
+	thumbnail, err = encode(fit(img, opts.ThumbnailSize), isOpaque(img))
+	if err != nil {
+		return Image{}, Image{}, err
+	}
+	return full, thumbnail, nil
+}
+
+// Avatar 將圖片裁成置中的正方形並縮放為頭像尺寸，輸出 PNG；動畫只取第一個影格
+func Avatar(data []byte, opts Options) (Image, error) {
+	img, _, _, err := decode(data, opts.MaxPixels)
+	if err != nil {
+		return Image{}, err
+	}
+
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(bounds.Min).Add(image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2))
+
+	size := min(opts.AvatarSize, side)
+	return encode(scale(img, crop, size, size), false)
+}
+
+// decode 先讀取尺寸確認不超過像素上限再解碼；GIF 以 DecodeAll 讀取所有影格，
+// 多個影格時 anim 不為 nil，img 為第一個影格合成後的畫面
+func decode(data []byte, maxPixels int) (img image.Image, anim *gif.GIF, format string, err error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, nil, "", ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, nil, "", ErrInvalidImage
+	}
+	if int64(config.Width)*int64(config.Height) > int64(maxPixels) {
+		return nil, nil, "", ErrTooManyPixels
+	}
+
+	if format == "gif" {
+		return decodeGIF(data, config, maxPixels)
+	}
+
+	img, _, err = image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	return img, nil, format, nil
+}
+
+// decodeGIF 解碼前先計算所有影格的像素數，避免大量影格造成的解壓縮炸彈
+func decodeGIF(data []byte, config image.Config, maxPixels int) (image.Image, *gif.GIF, string, error) {
+	pixels, err := gifPixels(data)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if pixels > int64(maxPixels) {
+		return nil, nil, "", ErrTooManyPixels
+	}
+
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if len(anim.Image) == 0 {
+		return nil, nil, "", ErrInvalidImage
+	}
+
+	first := image.NewRGBA(image.Rect(0, 0, config.Width, config.Height))
+	draw.Draw(first, anim.Image[0].Bounds(), anim.Image[0], anim.Image[0].Bounds().Min, draw.Over)
+	if len(anim.Image) == 1 {
+		return first, nil, "gif", nil
+	}
+	return first, anim, "gif", nil
+}
+
+// gifPixels 不解碼影像資料，只走訪 GIF 的區塊加總每個影格的像素數
+func gifPixels(data []byte) (int64, error) {
+	const headerSize = 13
+	if len(data) < headerSize {
+		return 0, ErrInvalidImage
+	}
+	i := headerSize
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1) // 全域色盤
+	}
+
+	var pixels int64
+	for i < len(data) {
+		switch data[i] {
+		case 0x2C: // 影格描述
+			if i+10 > len(data) {
+				return 0, ErrInvalidImage
+			}
+			width := int64(data[i+5]) | int64(data[i+6])<<8
+			height := int64(data[i+7]) | int64(data[i+8])<<8
+			pixels += width * height
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1) // 區域色盤
+			}
+			i = skipSubBlocks(data, i+1) // LZW 最小碼長之後是影像資料
+		case 0x21: // 擴充區塊
+			i = skipSubBlocks(data, i+2)
+		case 0x3B: // 結尾
+			return pixels, nil
+		default:
+			return 0, ErrInvalidImage
+		}
+	}
+	return pixels, nil
+}
+
+// skipSubBlocks 略過以長度 0 結尾的資料子區塊，回傳下一個區塊的位置
+func skipSubBlocks(data []byte, i int) int {
+	for i < len(data) {
+		n := int(data[i])
+		i++
+		if n == 0 {
+			return i
+		}
+		i += n
+	}
+	return i
+}
+
+// fit 等比例縮小到最長邊為 size
+func fit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := size, size
+	if bounds.Dx() > bounds.Dy() {
+		height = max(bounds.Dy()*size/bounds.Dx(), 1)
+	} else {
+		width = max(bounds.Dx()*size/bounds.Dy(), 1)
+	}
+
+	return scale(img, bounds, width, height)
+}
+
+// scale 以區域平均（box filter）將 img 的 sr 範圍縮放為 width × height；
+// 每個目標像素取其涵蓋的來源像素平均，縮小時不會產生鋸齒
+func scale(img image.Image, sr image.Rectangle, width, height int) *image.RGBA {
+	// 先轉為 RGBA（預乘 alpha）再直接讀取像素，避免逐點呼叫 At
+	src := image.NewRGBA(image.Rect(0, 0, sr.Dx(), sr.Dy()))
+	draw.Draw(src, src.Bounds(), img, sr.Min, draw.Src)
+	sw, sh := sr.Dx(), sr.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * sh / height
+		y1 := max((y+1)*sh/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := x * sw / width
+			x1 := max((x+1)*sw/width, x0+1)
+
+			var sum [4]uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += uint64(row[i])
+					sum[1] += uint64(row[i+1])
+					sum[2] += uint64(row[i+2])
+					sum[3] += uint64(row[i+3])
+				}
+			}
+
+			n := uint64((x1 - x0) * (y1 - y0))
+			i := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// encode 重新編碼：lossy 為 true 且圖片不透明時使用 JPEG，否則使用 PNG
+func encode(img image.Image, lossy bool) (Image, error) {
+	var buf bytes.Buffer
+	contentType := "image/png"
+	var err error
+	if lossy && isOpaque(img) {
+		contentType = "image/jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return Image{}, err
+	}
+
+	bounds := img.Bounds()
+	return Image{Data: buf.Bytes(), ContentType: contentType, Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+// encodeGIF 重新編碼動畫 GIF，只保留影格、延遲與循環次數（註解與應用程式擴充會被移除）
+func encodeGIF(anim *gif.GIF) (Image, error) {
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return Image{}, err
+	}
+	return Image{Data: buf.Bytes(), ContentType: "image/gif", Width: anim.Config.Width, Height: anim.Config.Height}, nil
+}
+
+// isOpaque 圖片是否沒有透明像素
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var testOptions = Options{MaxPixels: 1_000_000, ThumbnailSize: 64, AvatarSize: 32}
+
+// exifSegment 只含方向與 GPS IFD 指標的 APP1 EXIF 區段（little endian）
+func exifSegment(orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("II")
+	binary.Write(&tiff, binary.LittleEndian, uint16(42))
+	binary.Write(&tiff, binary.LittleEndian, uint32(8))
+	binary.Write(&tiff, binary.LittleEndian, uint16(2))
+	for _, entry := range [][3]uint32{{exifOrientationTag, 3, uint32(orientation)}, {0x8825, 4, 0x47505321}} {
+		binary.Write(&tiff, binary.LittleEndian, uint16(entry[0]))
+		binary.Write(&tiff, binary.LittleEndian, uint16(entry[1]))
+		binary.Write(&tiff, binary.LittleEndian, uint32(1))
+		binary.Write(&tiff, binary.LittleEndian, entry[2])
+	}
+	binary.Write(&tiff, binary.LittleEndian, uint32(0))
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// testJPEG 左半紅、右半藍的 JPEG，插入 EXIF 方向
+func testJPEG(t *testing.T, width, height int, orientation uint16) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("jpeg.Encode failed: %v", err)
+	}
+	data := buf.Bytes()
+	return append(append(append([]byte{}, data[:2]...), exifSegment(orientation)...), data[2:]...)
+}
+
+func TestProcessStripsExifAndOrients(t *testing.T) {
+	data := testJPEG(t, 200, 100, 6)
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("Expected orientation 6, got %d", got)
+	}
+
+	full, thumbnail, err := Process(data, testOptions)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if full.ContentType != "image/jpeg" || full.Width != 100 || full.Height != 200 {
+		t.Errorf("Expected a rotated 100x200 JPEG, got %s %dx%d", full.ContentType, full.Width, full.Height)
+	}
+	if bytes.Contains(full.Data, []byte("Exif")) || bytes.Contains(thumbnail.Data, []byte("Exif")) {
+		t.Error("EXIF data should be removed")
+	}
+
+	// 順時針旋轉 90 度後，原本左半的紅色在上方
+	img, err := jpeg.Decode(bytes.NewReader(full.Data))
+	if err != nil {
+		t.Fatalf("Decode output failed: %v", err)
+	}
+	if r, _, b, _ := img.At(50, 20).RGBA(); r < b {
+		t.Errorf("Expected red at the top after rotation, got r=%d b=%d", r, b)
+	}
+
+	if thumbnail.Width != 32 || thumbnail.Height != 64 {
+		t.Errorf("Expected a 32x64 thumbnail, got %dx%d", thumbnail.Width, thumbnail.Height)
+	}
+}
+
+func TestProcessSmallImageAndAvatar(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 40, 20)))
+
+	full, thumbnail, err := Process(buf.Bytes(), testOptions)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if full.ContentType != "image/png" || !bytes.Equal(full.Data, thumbnail.Data) {
+		t.Errorf("Expected the PNG itself as its thumbnail, got %s / %s", full.ContentType, thumbnail.ContentType)
+	}
+
+	avatar, err := Avatar(testJPEG(t, 300, 100, 1), testOptions)
+	if err != nil {
+		t.Fatalf("Avatar failed: %v", err)
+	}
+	if avatar.ContentType != "image/png" || avatar.Width != 32 || avatar.Height != 32 {
+		t.Errorf("Expected a 32x32 PNG avatar, got %s %dx%d", avatar.ContentType, avatar.Width, avatar.Height)
+	}
+}
+
+func TestProcessRejectsBadImages(t *testing.T) {
+	if _, _, err := Process([]byte("<svg onload=alert(1)>"), testOptions); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+	if _, _, err := Process(testJPEG(t, 200, 100, 1)[:300], testOptions); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("Expected ErrInvalidImage for a truncated JPEG, got %v", err)
+	}
+
+	// 尺寸超過上限時不解碼
+	small := Options{MaxPixels: 10_000, ThumbnailSize: 64, AvatarSize: 32}
+	if _, _, err := Process(testJPEG(t, 200, 100, 1), small); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("Expected ErrTooManyPixels, got %v", err)
+	}
+
+	// 每個影格都不大，但影格數量讓總像素超過上限
+	anim := &gif.GIF{}
+	palette := color.Palette{color.Black, color.White}
+	for i := 0; i < 20; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 50, 50), palette))
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("gif.EncodeAll failed: %v", err)
+	}
+	if _, _, err := Process(buf.Bytes(), small); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("Expected ErrTooManyPixels for many frames, got %v", err)
+	}
+
+	full, _, err := Process(buf.Bytes(), testOptions)
+	if err != nil || full.ContentType != "image/gif" {
+		t.Errorf("Expected the animation to be kept, got %s, %v", full.ContentType, err)
+	}
+}
+
+func TestScaleAveragesPixels(t *testing.T) {
+	// 黑白棋盤格縮小後為灰色，左右兩半的顏色不會混在一起
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			c := color.RGBA{A: 255}
+			if x < 2 && (x+y)%2 == 0 {
+				c = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			}
+			if x >= 2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+
+	dst := scale(src, src.Bounds(), 2, 1)
+	if got := dst.RGBAAt(0, 0); got != (color.RGBA{R: 128, G: 128, B: 128, A: 255}) {
+		t.Errorf("Expected gray for the checkerboard half, got %v", got)
+	}
+	if got := dst.RGBAAt(1, 0); got != (color.RGBA{B: 255, A: 255}) {
+		t.Errorf("Expected blue for the right half, got %v", got)
+	}
+}
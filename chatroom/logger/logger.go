@@ -9,6 +9,9 @@ import (
 
 var Log *zap.Logger
 
+// level 目前的日誌級別，可在執行中調整
+var level = zap.NewAtomicLevel()
+
 // Init 初始化日誌系統
 func Init(isDevelopment bool) error {
 	var config zap.Config
@@ -20,6 +23,8 @@ func Init(isDevelopment bool) error {
 		config = zap.NewProductionConfig()
 	}
 
+	level.SetLevel(config.Level.Level())
+	config.Level = level
 	config.OutputPaths = []string{"stdout"}
 	config.ErrorOutputPaths = []string{"stderr"}
 
@@ -32,6 +37,21 @@ func Init(isDevelopment bool) error {
 	return nil
 }
 
+// SetLevel 調整日誌級別（debug/info/warn/error），不需要重新初始化
+func SetLevel(name string) error {
+	l, err := zapcore.ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.SetLevel(l)
+	return nil
+}
+
+// GetLevel 目前的日誌級別
+func GetLevel() string {
+	return level.Level().String()
+}
+
 // Sync 同步日誌
 func Sync() {
 	if Log != nil {
@@ -2,159 +2,118 @@ package main
 
 import (
 	"chatroom/config"
-	"chatroom/logger"
-	"chatroom/metrics"
-	"chatroom/models"
-	"chatroom/pool"
-	"chatroom/ratelimit"
-	"chatroom/repository"
-	"chatroom/service"
-	"chatroom/transport"
-	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
+	"io"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"strings"
+)
 
-	"go.uber.org/zap"
+// 程式結束代碼
+const (
+	exitSuccess = 0
+	exitFailure = 1
+	exitBadArgs = 2 // 參數錯誤，與 flag 套件一致
 )
 
+// commands 子命令說明，依顯示順序排列
+var commands = []struct {
+	name, summary string
+}{
+	{"serve", "啟動聊天室伺服器（沒有指定子命令時的預設行為）"},
+	{"leaderboard list|clear|export", "查看、清空或匯出排行榜"},
+	{"config print", "輸出實際生效的配置"},
+	{"check", "檢查配置與儲存是否可用"},
+}
+
 func main() {
-	// 1. 初始化日誌系統
-	if err := logger.InitDefault(); err != nil {
-		fmt.Printf("Failed to initialize logger: %v\n", err)
-		os.Exit(1)
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run 解析子命令並執行，回傳程式結束代碼
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && !isHelp(args[0])) {
+		// 沒有子命令時直接啟動伺服器，相容原本的啟動方式
+		return runServe(args, stdout, stderr)
 	}
-	defer logger.Sync()
-
-	logger.Info("Starting chatroom server...")
-
-	// 2. 載入配置
-	cfg := config.Load()
-	logger.Info("Configuration loaded",
-		zap.String("port", cfg.Server.Port),
-		zap.Bool("rate_limit", cfg.RateLimit.Enabled))
-
-	// 3. 初始化 Repository
-	leaderboardRepo := repository.NewFileLeaderboardRepository(cfg.Storage.LeaderboardFile)
-	logger.Info("Repository initialized")
-
-	// 4. 初始化 Worker Pool
-	workerPool := pool.NewWorkerPool(10, 100) // 10 workers, 100 queue size
-	workerPool.Start()
-	logger.Info("Worker pool started with 10 workers")
-
-	// 5. 初始化 Rate Limiter
-	rateLimiter := ratelimit.NewRateLimiter(
-		cfg.RateLimit.MaxMessages,
-		cfg.RateLimit.TimeWindow,
-		cfg.RateLimit.Enabled,
-	)
-	logger.Info("Rate limiter initialized")
-
-	// 6. 初始化 Metrics
-	appMetrics := metrics.GetMetrics()
-	logger.Info("Metrics initialized")
 
-	// 7. 建立訊息通道
-	broadcastChan := make(chan models.Message, 100)
-
-	// 8. 初始化 Service
-	stateService := service.NewStateServiceWithDeps(
-		broadcastChan,
-		leaderboardRepo,
-		workerPool,
-		rateLimiter,
-		appMetrics,
-		cfg,
-	)
-	logger.Info("State service initialized")
-
-	// 9. 啟動訊息處理循環
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	go stateService.HandleMessageLoopWithContext(ctx)
-
-	// 10. 初始化 WebSocket Handler
-	wsHandler := transport.NewWebsocketHandlerWithConfig(stateService, cfg)
-
-	// 11. 設置 HTTP 路由
-	fs := http.FileServer(http.Dir("./static"))
-	http.Handle("/", fs)
-	http.HandleFunc("/ws", wsHandler.HandleConnections)
-
-	// 新增 metrics endpoint
-	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
-		snapshot := appMetrics.GetSnapshot()
-		fmt.Fprintf(w, "Total Connections: %d\n", snapshot.TotalConnections)
-		fmt.Fprintf(w, "Active Connections: %d\n", snapshot.ActiveConnections)
-		fmt.Fprintf(w, "Total Messages: %d\n", snapshot.TotalMessages)
-		fmt.Fprintf(w, "Active Rooms: %d\n", snapshot.ActiveRooms)
-		fmt.Fprintf(w, "Average Latency: %v\n", snapshot.AverageLatency)
-		fmt.Fprintf(w, "Total Errors: %d\n", snapshot.TotalErrors)
-	})
-
-	// 12. 建立 HTTP Server
-	server := &http.Server{
-		Addr:         ":" + cfg.Server.Port,
-		ReadTimeout:  cfg.Server.ReadTimeout,
-		WriteTimeout: cfg.Server.WriteTimeout,
+	switch args[0] {
+	case "serve":
+		return runServe(args[1:], stdout, stderr)
+	case "leaderboard":
+		return runLeaderboard(args[1:], stdout, stderr)
+	case "config":
+		return runConfig(args[1:], stdout, stderr)
+	case "check":
+		return runCheck(args[1:], stdout, stderr)
+	case "help":
+		printUsage(stdout)
+		return exitSuccess
 	}
-
-	// 13. 啟動伺服器
-	go func() {
-		logger.Info("Server starting", zap.String("address", server.Addr))
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatal("Server failed to start", zap.Error(err))
-		}
-	}()
-
-	// 14. 優雅關機處理
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	logger.Info("Shutting down server...")
-
-	// 建立關機超時上下文
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
-	defer shutdownCancel()
-
-	// 1. 先取消上下文，停止所有 goroutine
-	cancel()
-	logger.Info("Context cancelled")
-
-	// 2. 停止接受新連線
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		logger.Error("Server forced to shutdown", zap.Error(err))
+	if isHelp(args[0]) {
+		printUsage(stdout)
+		return exitSuccess
 	}
-	logger.Info("HTTP server stopped")
-
-	// 3. 停止 worker pool
-	workerPool.Stop()
-	logger.Info("Worker pool stopped")
 
-	// 4. 關閉 broadcast channel
-	close(broadcastChan)
-	logger.Info("Broadcast channel closed")
-
-	// 5. 同步日誌（有超時保護）
-	syncDone := make(chan struct{})
-	go func() {
-		logger.Sync()
-		close(syncDone)
-	}()
-
-	select {
-	case <-syncDone:
-		// 日誌同步成功
-	case <-time.After(2 * time.Second):
-		// 超時，強制退出
-		fmt.Println("Logger sync timeout, forcing exit")
+	fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+	printUsage(stderr)
+	return exitBadArgs
+}
+
+// printUsage 輸出子命令列表
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "用法: chatroom <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-32s %s\n", c.name, c.summary)
 	}
-
-	fmt.Println("Server exited successfully")
-	os.Exit(0)
-}
\ No newline at end of file
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "執行 chatroom <command> -h 查看各子命令的參數")
+}
+
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// newFlagSet 建立子命令的 FlagSet，錯誤與說明輸出到 stderr
+func newFlagSet(name, params, summary string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "用法: chatroom %s %s\n\n%s\n\nFlags:\n", name, params, summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// newConfigLoader 註冊配置相關參數：-config、每個配置項，以及常用項目的簡短名稱
+func newConfigLoader(fs *flag.FlagSet) *config.Loader {
+	loader := config.NewLoader(fs)
+	loader.Alias(fs, "addr", "server.addr", "監聽位址，例如 127.0.0.1:8080（同 -server.addr）")
+	loader.Alias(fs, "static-dir", "server.static_dir", "從磁碟提供靜態檔案的目錄，預設使用內嵌檔案（同 -server.static_dir）")
+	loader.Alias(fs, "data-dir", "storage.data_dir", "資料檔目錄（同 -storage.data_dir）")
+	return loader
+}
+
+// exitUsage 參數解析失敗時的結束代碼（flag 套件已輸出錯誤訊息），-h 視為成功
+func exitUsage(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitSuccess
+	}
+	return exitBadArgs
+}
+
+// loadConfig 載入配置，失敗時將每個錯誤輸出到 stderr
+func loadConfig(loader *config.Loader, stderr io.Writer) (*config.Config, bool) {
+	cfg, err := loader.Load()
+	if err != nil {
+		fmt.Fprintln(stderr, "invalid configuration:")
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(stderr, "  %s\n", line)
+		}
+		return nil, false
+	}
+	return cfg, true
+}
@@ -12,6 +12,7 @@ type Metrics struct {
 	TotalConnections    int64
 	ActiveConnections   int64
 	TotalDisconnections int64
+	RejectedConnections int64 // 連線數超過上限而被拒絕
 
 	// 訊息相關
 	TotalMessages    int64
@@ -28,6 +29,10 @@ type Metrics struct {
 	RateLimitErrors  int64
 	ConnectionErrors int64
 
+	// 限流處置
+	RateLimitMutes       int64 // 重複違規而被暫時禁止發言
+	RateLimitDisconnects int64 // 重複違規而被中斷連線
+
 	// 效能相關
 	mu                sync.RWMutex
 	AverageLatency    time.Duration
@@ -62,6 +67,11 @@ func (m *Metrics) DecrementConnections() {
 	atomic.AddInt64(&m.TotalDisconnections, 1)
 }
 
+// IncrementRejectedConnections 增加被拒絕連線計數
+func (m *Metrics) IncrementRejectedConnections() {
+	atomic.AddInt64(&m.RejectedConnections, 1)
+}
+
 // IncrementMessages 增加訊息計數
 func (m *Metrics) IncrementMessages() {
 	atomic.AddInt64(&m.TotalMessages, 1)
@@ -99,6 +109,16 @@ func (m *Metrics) IncrementRateLimitErrors() {
 	atomic.AddInt64(&m.RateLimitErrors, 1)
 }
 
+// IncrementRateLimitMutes 增加限流禁言計數
+func (m *Metrics) IncrementRateLimitMutes() {
+	atomic.AddInt64(&m.RateLimitMutes, 1)
+}
+
+// IncrementRateLimitDisconnects 增加限流斷線計數
+func (m *Metrics) IncrementRateLimitDisconnects() {
+	atomic.AddInt64(&m.RateLimitDisconnects, 1)
+}
+
 // IncrementConnectionErrors 增加連線錯誤計數
 func (m *Metrics) IncrementConnectionErrors() {
 	atomic.AddInt64(&m.ConnectionErrors, 1)
@@ -133,39 +153,45 @@ func (m *Metrics) GetSnapshot() MetricsSnapshot {
 	defer m.mu.RUnlock()
 
 	return MetricsSnapshot{
-		TotalConnections:    atomic.LoadInt64(&m.TotalConnections),
-		ActiveConnections:   atomic.LoadInt64(&m.ActiveConnections),
-		TotalDisconnections: atomic.LoadInt64(&m.TotalDisconnections),
-		TotalMessages:       atomic.LoadInt64(&m.TotalMessages),
-		MessagesSent:        atomic.LoadInt64(&m.MessagesSent),
-		MessagesReceived:    atomic.LoadInt64(&m.MessagesReceived),
-		MessagesFailed:      atomic.LoadInt64(&m.MessagesFailed),
-		ActiveRooms:         atomic.LoadInt64(&m.ActiveRooms),
-		TotalRooms:          atomic.LoadInt64(&m.TotalRooms),
-		TotalErrors:         atomic.LoadInt64(&m.TotalErrors),
-		RateLimitErrors:     atomic.LoadInt64(&m.RateLimitErrors),
-		ConnectionErrors:    atomic.LoadInt64(&m.ConnectionErrors),
-		AverageLatency:      m.AverageLatency,
-		MaxLatency:          m.MaxLatency,
+		TotalConnections:     atomic.LoadInt64(&m.TotalConnections),
+		ActiveConnections:    atomic.LoadInt64(&m.ActiveConnections),
+		TotalDisconnections:  atomic.LoadInt64(&m.TotalDisconnections),
+		RejectedConnections:  atomic.LoadInt64(&m.RejectedConnections),
+		TotalMessages:        atomic.LoadInt64(&m.TotalMessages),
+		MessagesSent:         atomic.LoadInt64(&m.MessagesSent),
+		MessagesReceived:     atomic.LoadInt64(&m.MessagesReceived),
+		MessagesFailed:       atomic.LoadInt64(&m.MessagesFailed),
+		ActiveRooms:          atomic.LoadInt64(&m.ActiveRooms),
+		TotalRooms:           atomic.LoadInt64(&m.TotalRooms),
+		TotalErrors:          atomic.LoadInt64(&m.TotalErrors),
+		RateLimitErrors:      atomic.LoadInt64(&m.RateLimitErrors),
+		ConnectionErrors:     atomic.LoadInt64(&m.ConnectionErrors),
+		RateLimitMutes:       atomic.LoadInt64(&m.RateLimitMutes),
+		RateLimitDisconnects: atomic.LoadInt64(&m.RateLimitDisconnects),
+		AverageLatency:       m.AverageLatency,
+		MaxLatency:           m.MaxLatency,
 	}
 }
 
 // MetricsSnapshot 指標快照
 type MetricsSnapshot struct {
-	TotalConnections    int64
-	ActiveConnections   int64
-	TotalDisconnections int64
-	TotalMessages       int64
-	MessagesSent        int64
-	MessagesReceived    int64
-	MessagesFailed      int64
-	ActiveRooms         int64
-	TotalRooms          int64
-	TotalErrors         int64
-	RateLimitErrors     int64
-	ConnectionErrors    int64
-	AverageLatency      time.Duration
-	MaxLatency          time.Duration
+	TotalConnections     int64
+	ActiveConnections    int64
+	TotalDisconnections  int64
+	RejectedConnections  int64
+	TotalMessages        int64
+	MessagesSent         int64
+	MessagesReceived     int64
+	MessagesFailed       int64
+	ActiveRooms          int64
+	TotalRooms           int64
+	TotalErrors          int64
+	RateLimitErrors      int64
+	ConnectionErrors     int64
+	RateLimitMutes       int64
+	RateLimitDisconnects int64
+	AverageLatency       time.Duration
+	MaxLatency           time.Duration
 }
 
 // Reset 重置所有指標
@@ -173,6 +199,7 @@ func (m *Metrics) Reset() {
 	atomic.StoreInt64(&m.TotalConnections, 0)
 	atomic.StoreInt64(&m.ActiveConnections, 0)
 	atomic.StoreInt64(&m.TotalDisconnections, 0)
+	atomic.StoreInt64(&m.RejectedConnections, 0)
 	atomic.StoreInt64(&m.TotalMessages, 0)
 	atomic.StoreInt64(&m.MessagesSent, 0)
 	atomic.StoreInt64(&m.MessagesReceived, 0)
@@ -182,6 +209,8 @@ func (m *Metrics) Reset() {
 	atomic.StoreInt64(&m.TotalErrors, 0)
 	atomic.StoreInt64(&m.RateLimitErrors, 0)
 	atomic.StoreInt64(&m.ConnectionErrors, 0)
+	atomic.StoreInt64(&m.RateLimitMutes, 0)
+	atomic.StoreInt64(&m.RateLimitDisconnects, 0)
 
 	m.mu.Lock()
 	m.AverageLatency = 0
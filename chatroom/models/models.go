@@ -2,6 +2,7 @@ package models
 
 import (
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -16,6 +17,15 @@ type Client struct {
 	Level    int    `json:"level"`
 	Exp      int    `json:"exp"`
 	Title    string `json:"title"`
+	UserID   string
+
+	// 限流用：連線 ID 與客戶端 IP
+	ConnID string
+	IP     string
+
+	// 連線恢復用
+	SessionToken string
+	LastAckID    int64
 }
 
 // ReplyTo 引用訊息結構
@@ -27,11 +37,13 @@ type ReplyTo struct {
 
 // Message
 type Message struct {
+	ID         int64           `json:"id,omitempty"` // 寫入歷史記錄時分配的遞增 ID
 	Room       string          `json:"room"`
 	Nickname   string          `json:"nickname"`
 	Avatar     string          `json:"avatar"`
 	UserId     string          `json:"userId,omitempty"`
 	Content    string          `json:"content,omitempty"`
+	Thumbnail  string          `json:"thumbnail,omitempty"` // 圖片訊息的縮圖網址，content 為原圖
 	Type       string          `json:"type"`
 	Question   string          `json:"question,omitempty"`
 	Answer     string          `json:"answer,omitempty"`
@@ -52,13 +64,93 @@ type Message struct {
 	Level      int             `json:"level,omitempty"`
 	Exp        int             `json:"exp,omitempty"`
 	Title      string          `json:"title,omitempty"`
+	RetryAfter int64           `json:"retryAfter,omitempty"` // 建議重試等待時間（毫秒）
+	Remaining  int             `json:"remaining,omitempty"`  // 剩餘的訊息配額（限流回應使用，未提供表示 0）
+	Token      string          `json:"token,omitempty"`
+	LastID     int64           `json:"lastId,omitempty"` // 客戶端最後確認收到的訊息 ID
+	Status     string          `json:"status,omitempty"` // 在線狀態：online/away/busy/idle
+	Members    []Member        `json:"members,omitempty"`
+	Unread     map[string]int  `json:"unread,omitempty"`   // 各房間未讀數
+	TargetId   string          `json:"targetId,omitempty"` // 管理指令的對象使用者 ID
+	Duration   int             `json:"duration,omitempty"` // 持續秒數（例如禁言）
+	Settings   *RoomSettings   `json:"settings,omitempty"` // 建立或修改房間時的設定
+	MaxUses    int             `json:"maxUses,omitempty"`  // 邀請連結可使用次數
+	Position   int             `json:"position,omitempty"` // 等候名單中的順位
+	Rooms      []RoomSummary   `json:"rooms,omitempty"`    // 房間列表詳細資訊
+	Board      string          `json:"board,omitempty"`    // 排行榜名稱，例如 guess_number
+	Period     string          `json:"period,omitempty"`   // 排行榜區間：all_time/daily/weekly
+	Best       *PersonalBest   `json:"best,omitempty"`     // 玩家在排行榜上的最佳成績與名次
+}
+
+// PersonalBest 玩家在排行榜上的最佳成績與名次
+type PersonalBest struct {
+	Rank       int         `json:"rank"` // 全站名次，從 1 開始
+	Score      GameScore   `json:"score"`
+	NewBest    bool        `json:"newBest,omitempty"` // 這一局刷新了最佳成績
+	Around     []GameScore `json:"around"`            // 前後幾名的成績
+	AroundFrom int         `json:"aroundFrom"`        // around 第一筆的名次
+}
+
+// Member 房間成員
+type Member struct {
+	UserId   string `json:"userId"`
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
+	Level    int    `json:"level"`
+	Title    string `json:"title"`
+	Status   string `json:"status"`
+}
+
+// RoomSettings 房間可自訂的設定
+type RoomSettings struct {
+	Topic       string `json:"topic,omitempty"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	MaxMembers  int    `json:"maxMembers,omitempty"` // 人數上限，0 表示不限
+	InviteOnly  bool   `json:"inviteOnly,omitempty"` // 僅限受邀成員進入
+}
+
+// Room 房間管理資訊
+type Room struct {
+	Name string `json:"name"`
+	RoomSettings
+	Persistent   bool                 `json:"persistent,omitempty"`   // 最後一位成員離開後仍保留
+	Owner        string               `json:"owner"`                  // 建立者的使用者 ID
+	Moderators   map[string]bool      `json:"moderators,omitempty"`   // 管理員使用者 ID
+	Banned       map[string]bool      `json:"banned,omitempty"`       // 被封鎖的使用者 ID
+	Invited      map[string]bool      `json:"invited,omitempty"`      // 僅限受邀房間的成員使用者 ID
+	PasswordHash string               `json:"passwordHash,omitempty"` // 房間密碼雜湊
+	Invites      map[string]*Invite   `json:"invites,omitempty"`      // 邀請 token -> 邀請連結
+	Muted        map[string]time.Time `json:"-"`                      // 使用者 ID -> 禁言到期時間
+	CreatedAt    time.Time            `json:"createdAt"`
+}
+
+// Invite 房間邀請連結
+type Invite struct {
+	Token     string    `json:"token"`
+	Room      string    `json:"room"`
+	CreatedBy string    `json:"createdBy"`           // 建立者的使用者 ID
+	ExpiresAt time.Time `json:"expiresAt,omitempty"` // 零值表示不會過期
+	MaxUses   int       `json:"maxUses,omitempty"`   // 0 表示不限次數
+	Uses      int       `json:"uses"`
+}
+
+// RoomSummary 房間列表中顯示的房間資訊
+type RoomSummary struct {
+	Name string `json:"name"`
+	RoomSettings
+	Persistent bool `json:"persistent,omitempty"`
+	Lobby      bool `json:"lobby,omitempty"`  // 預設大廳
+	Locked     bool `json:"locked,omitempty"` // 需要密碼
+	Online     int  `json:"online"`           // 目前在房間中的使用者數
 }
 
 // Quiz
 type Quiz struct {
-	Question string
-	Answer   string
-	Active   bool
+	Question  string
+	Answer    string
+	Active    bool
+	StartedAt time.Time
 }
 
 // Vote
@@ -68,18 +160,33 @@ type Vote struct {
 	Voters   map[string]bool
 }
 
+// Profile 使用者資料，以使用者 ID 保存最後一次連線時的暱稱與等級
+type Profile struct {
+	UserID    string    `json:"userId"`
+	Nickname  string    `json:"nickname"`
+	Avatar    string    `json:"avatar"`
+	Level     int       `json:"level"`
+	Exp       int       `json:"exp"`
+	Title     string    `json:"title"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
 // GameScore
 type GameScore struct {
+	UserID   string `json:"userId,omitempty"` // 累計型排行榜以此合併同一位玩家（沒有時使用暱稱）
 	Nickname string `json:"nickname"`
 	Avatar   string `json:"avatar"`
 	Tries    int    `json:"tries"`
 	Time     int    `json:"time"`
+	Score    int    `json:"score,omitempty"` // 得分（你畫我猜、搶答）
 }
 
 // DrawState
 type DrawState struct {
 	CurrentWord   string
 	CurrentDrawer string
+	StartedAt     time.Time // 本回合開始時間，用來計算猜中的秒數
 }
 
 // UserProfile 用戶資料
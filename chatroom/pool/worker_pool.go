@@ -3,15 +3,21 @@ package pool
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 )
 
 // WorkerPool 工作池
 type WorkerPool struct {
 	jobQueue   chan func()
 	workerSize int
+	resizeMu   sync.Mutex    // 保護 workerSize 的調整
+	quit       chan struct{} // 縮減 worker 時通知多餘的 worker 結束
 	wg         sync.WaitGroup
 	ctx        context.Context
 	cancel     context.CancelFunc
+	started    atomic.Bool
+	stopped    atomic.Bool
+	stopMu     sync.RWMutex // 保護 jobQueue 的關閉，避免對已關閉的 channel 送值
 }
 
 // NewWorkerPool 創建新的工作池
@@ -21,6 +27,7 @@ func NewWorkerPool(workerSize int, queueSize int) *WorkerPool {
 	pool := &WorkerPool{
 		jobQueue:   make(chan func(), queueSize),
 		workerSize: workerSize,
+		quit:       make(chan struct{}),
 		ctx:        ctx,
 		cancel:     cancel,
 	}
@@ -30,6 +37,10 @@ func NewWorkerPool(workerSize int, queueSize int) *WorkerPool {
 
 // Start 啟動工作池
 func (p *WorkerPool) Start() {
+	p.resizeMu.Lock()
+	defer p.resizeMu.Unlock()
+
+	p.started.Store(true)
 	for i := 0; i < p.workerSize; i++ {
 		p.wg.Add(1)
 		go p.worker()
@@ -49,14 +60,54 @@ func (p *WorkerPool) worker() {
 			if job != nil {
 				job()
 			}
+		case <-p.quit:
+			return
 		case <-p.ctx.Done():
 			return
 		}
 	}
 }
 
-// Submit 提交任務
+// Resize 調整 worker 數量；縮減時會等待多餘的 worker 完成手上的任務後結束
+func (p *WorkerPool) Resize(workerSize int) {
+	if workerSize <= 0 {
+		return
+	}
+
+	p.resizeMu.Lock()
+	defer p.resizeMu.Unlock()
+
+	if p.started.Load() && !p.stopped.Load() {
+		for i := p.workerSize; i < workerSize; i++ {
+			p.wg.Add(1)
+			go p.worker()
+		}
+		for i := workerSize; i < p.workerSize; i++ {
+			select {
+			case p.quit <- struct{}{}:
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}
+	p.workerSize = workerSize
+}
+
+// Size 目前的 worker 數量
+func (p *WorkerPool) Size() int {
+	p.resizeMu.Lock()
+	defer p.resizeMu.Unlock()
+	return p.workerSize
+}
+
+// Submit 提交任務（工作池停止後提交的任務會被丟棄）
 func (p *WorkerPool) Submit(job func()) {
+	p.stopMu.RLock()
+	defer p.stopMu.RUnlock()
+
+	if p.stopped.Load() {
+		return
+	}
 	select {
 	case p.jobQueue <- job:
 	case <-p.ctx.Done():
@@ -64,9 +115,22 @@ func (p *WorkerPool) Submit(job func()) {
 	}
 }
 
-// Stop 停止工作池
+// Stop 停止工作池，已排隊的任務會執行完畢
 func (p *WorkerPool) Stop() {
+	p.stopMu.Lock()
+	if p.stopped.Load() {
+		p.stopMu.Unlock()
+		return
+	}
+	p.stopped.Store(true)
 	close(p.jobQueue) // 關閉任務隊列，worker 會自然退出
-	p.wg.Wait()       // 等待所有 worker 完成
-	p.cancel()        // 取消 context
+	p.stopMu.Unlock()
+
+	p.wg.Wait() // 等待所有 worker 完成
+	p.cancel()  // 取消 context
+}
+
+// IsAccepting 工作池是否已啟動且仍接受新任務
+func (p *WorkerPool) IsAccepting() bool {
+	return p.started.Load() && !p.stopped.Load()
 }
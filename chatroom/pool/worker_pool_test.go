@@ -123,6 +123,50 @@ func TestWorkerPool(t *testing.T) {
 			t.Errorf("Expected counter to be 6, got %d", counter)
 		}
 	})
+
+	t.Run("Resize", func(t *testing.T) {
+		pool := NewWorkerPool(1, 10)
+		pool.Start()
+		defer pool.Stop()
+
+		// 擴充後可以同時執行多個任務
+		pool.Resize(3)
+		if pool.Size() != 3 {
+			t.Fatalf("Expected 3 workers, got %d", pool.Size())
+		}
+
+		var running int32
+		release := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			pool.Submit(func() {
+				defer wg.Done()
+				atomic.AddInt32(&running, 1)
+				<-release
+			})
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for atomic.LoadInt32(&running) < 3 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := atomic.LoadInt32(&running); got != 3 {
+			t.Errorf("Expected 3 concurrent jobs after resize, got %d", got)
+		}
+		close(release)
+		wg.Wait()
+
+		// 縮減後仍可以執行任務
+		pool.Resize(1)
+		done := make(chan struct{})
+		pool.Submit(func() { close(done) })
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Job not executed after shrinking")
+		}
+	})
 }
 
 func BenchmarkWorkerPool(b *testing.B) {
@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"chatroom/config"
+	"sync"
+	"time"
+)
+
+// Keys 一則訊息要檢查的限流維度，空字串的維度不檢查
+type Keys struct {
+	User string // 連線時提供的使用者 ID（客戶端產生、未經驗證，不提供防護）
+	Conn string // 連線 ID
+	IP   string // 客戶端 IP
+}
+
+// MessageLimiter 多維度訊息限流：同時以使用者、連線與 IP 計算，依訊息類型計費
+type MessageLimiter struct {
+	user  *TokenBucket
+	conn  *TokenBucket
+	ip    *TokenBucket
+	mu    sync.RWMutex // 保護 costs
+	costs map[string]float64
+}
+
+// NewMessageLimiter 依配置建立多維度訊息限流器
+func NewMessageLimiter(cfg config.RateLimitConfig) *MessageLimiter {
+	return &MessageLimiter{
+		user:  NewTokenBucket(cfg.MaxMessages, cfg.TimeWindow, cfg.Burst, cfg.Enabled),
+		conn:  NewTokenBucket(cfg.MaxMessages, cfg.TimeWindow, cfg.Burst, cfg.Enabled),
+		ip:    NewTokenBucket(cfg.IPMaxMessages, cfg.TimeWindow, cfg.IPBurst, cfg.Enabled),
+		costs: mergeCosts(cfg.Costs),
+	}
+}
+
+// SetConfig 執行中套用新的限流配置，已累積的令牌保留（不超過新的容量）
+func (ml *MessageLimiter) SetConfig(cfg config.RateLimitConfig) {
+	ml.user.SetLimits(cfg.MaxMessages, cfg.TimeWindow, cfg.Burst)
+	ml.conn.SetLimits(cfg.MaxMessages, cfg.TimeWindow, cfg.Burst)
+	ml.ip.SetLimits(cfg.IPMaxMessages, cfg.TimeWindow, cfg.IPBurst)
+	ml.SetEnabled(cfg.Enabled)
+
+	costs := mergeCosts(cfg.Costs)
+	ml.mu.Lock()
+	ml.costs = costs
+	ml.mu.Unlock()
+}
+
+// mergeCosts 以配置覆寫預設的訊息類型費用
+func mergeCosts(overrides map[string]float64) map[string]float64 {
+	costs := make(map[string]float64, len(config.DefaultMessageCosts)+len(overrides))
+	for msgType, cost := range config.DefaultMessageCosts {
+		costs[msgType] = cost
+	}
+	for msgType, cost := range overrides {
+		costs[msgType] = cost
+	}
+	return costs
+}
+
+// Cost 訊息類型消耗的令牌數
+func (ml *MessageLimiter) Cost(msgType string) float64 {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+
+	if cost, ok := ml.costs[msgType]; ok {
+		return cost
+	}
+	return 1
+}
+
+// Allow 檢查訊息是否允許通過；任一維度令牌不足時全部維度都不消耗
+func (ml *MessageLimiter) Allow(keys Keys, msgType string) bool {
+	cost := ml.Cost(msgType)
+	if cost <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	var taken []dimension
+	for _, d := range ml.dimensions(keys) {
+		if !d.take(cost, now) {
+			for _, t := range taken {
+				t.refund(cost)
+			}
+			return false
+		}
+		taken = append(taken, d)
+	}
+	return true
+}
+
+// GetRemaining 獲取各維度中最少的剩餘令牌數
+func (ml *MessageLimiter) GetRemaining(keys Keys) int {
+	remaining := -1
+	for _, d := range ml.dimensions(keys) {
+		if r := d.bucket.GetRemaining(d.key); remaining < 0 || r < remaining {
+			remaining = r
+		}
+	}
+	if remaining < 0 {
+		return ml.user.capacity()
+	}
+	return remaining
+}
+
+// RetryAfter 各維度都累積足夠令牌還需要等待的時間
+func (ml *MessageLimiter) RetryAfter(keys Keys, msgType string) time.Duration {
+	cost := ml.Cost(msgType)
+	var wait time.Duration
+	for _, d := range ml.dimensions(keys) {
+		wait = max(wait, d.bucket.RetryAfter(d.key, cost))
+	}
+	return wait
+}
+
+// Reset 重置使用者與連線的令牌（IP 由多個使用者共用，不重置）
+func (ml *MessageLimiter) Reset(keys Keys) {
+	if keys.User != "" {
+		ml.user.Reset(keys.User)
+	}
+	if keys.Conn != "" {
+		ml.conn.Reset(keys.Conn)
+	}
+}
+
+// SetEnabled 設置是否啟用
+func (ml *MessageLimiter) SetEnabled(enabled bool) {
+	ml.user.SetEnabled(enabled)
+	ml.conn.SetEnabled(enabled)
+	ml.ip.SetEnabled(enabled)
+}
+
+// dimension 單一限流維度
+type dimension struct {
+	bucket *TokenBucket
+	key    string
+}
+
+// dimensions 需要檢查的維度
+func (ml *MessageLimiter) dimensions(keys Keys) []dimension {
+	dims := make([]dimension, 0, 3)
+	if keys.User != "" {
+		dims = append(dims, dimension{ml.user, keys.User})
+	}
+	if keys.Conn != "" {
+		dims = append(dims, dimension{ml.conn, keys.Conn})
+	}
+	if keys.IP != "" {
+		dims = append(dims, dimension{ml.ip, keys.IP})
+	}
+	return dims
+}
+
+// take 消耗令牌，停用時直接通過
+func (d dimension) take(cost float64, now time.Time) bool {
+	d.bucket.mu.Lock()
+	defer d.bucket.mu.Unlock()
+
+	if !d.bucket.enabled {
+		return true
+	}
+	return d.bucket.takeLocked(d.key, cost, now)
+}
+
+// refund 退回令牌
+func (d dimension) refund(cost float64) {
+	d.bucket.mu.Lock()
+	defer d.bucket.mu.Unlock()
+	d.bucket.refundLocked(d.key, cost)
+}
@@ -1,6 +1,8 @@
 package ratelimit
 
 import (
+	"chatroom/config"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -102,3 +104,131 @@ func BenchmarkRateLimiter(b *testing.B) {
 		}
 	})
 }
+
+func TestTokenBucket(t *testing.T) {
+	t.Run("Burst then refill", func(t *testing.T) {
+		tb := NewTokenBucket(10, 100*time.Millisecond, 3, true)
+		key := "burst_client"
+
+		for i := 0; i < 3; i++ {
+			if !tb.Allow(key) {
+				t.Errorf("Request %d should be allowed within burst", i+1)
+			}
+		}
+		if tb.Allow(key) {
+			t.Error("Request beyond burst should be denied")
+		}
+
+		// 每 10ms 補充一個令牌
+		time.Sleep(25 * time.Millisecond)
+		if !tb.Allow(key) {
+			t.Error("Should be allowed after refill")
+		}
+	})
+
+	t.Run("Cost larger than remaining is not consumed", func(t *testing.T) {
+		tb := NewTokenBucket(1, time.Hour, 10, true)
+		key := "cost_client"
+
+		if !tb.AllowN(key, 8) {
+			t.Fatal("Cost 8 should fit in burst 10")
+		}
+		if tb.AllowN(key, 5) {
+			t.Error("Cost 5 should be denied with 2 remaining")
+		}
+		if remaining := tb.GetRemaining(key); remaining != 2 {
+			t.Errorf("Expected 2 remaining, got %d", remaining)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		tb := NewTokenBucket(1, time.Hour, 1, false)
+		for i := 0; i < 10; i++ {
+			if !tb.Allow("disabled_client") {
+				t.Fatal("Disabled bucket should allow all requests")
+			}
+		}
+	})
+}
+
+func TestMessageLimiter(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		Enabled:       true,
+		MaxMessages:   1,
+		TimeWindow:    time.Hour,
+		Burst:         10,
+		IPMaxMessages: 1,
+		IPBurst:       15,
+	}
+
+	t.Run("Per-type costs", func(t *testing.T) {
+		ml := NewMessageLimiter(cfg)
+		keys := Keys{User: "u1", Conn: "c1"}
+
+		if !ml.Allow(keys, "vote") {
+			t.Fatal("First vote should be allowed")
+		}
+		if ml.Allow(keys, "chat") {
+			t.Error("Chat should be denied after a vote used the whole burst")
+		}
+		if !ml.Allow(keys, "ack") {
+			t.Error("Free message types should always be allowed")
+		}
+
+		ml = NewMessageLimiter(cfg)
+		for i := 0; i < 100; i++ {
+			if !ml.Allow(keys, "draw_move") {
+				t.Fatalf("draw_move %d should be allowed", i+1)
+			}
+		}
+	})
+
+	t.Run("Connection without user ID is limited", func(t *testing.T) {
+		ml := NewMessageLimiter(cfg)
+		keys := Keys{Conn: "anonymous"}
+
+		for i := 0; i < 10; i++ {
+			ml.Allow(keys, "chat")
+		}
+		if ml.Allow(keys, "chat") {
+			t.Error("Connection should be limited even without a user ID")
+		}
+	})
+
+	t.Run("IP shared across connections", func(t *testing.T) {
+		ml := NewMessageLimiter(cfg)
+
+		for i := 0; i < 15; i++ {
+			keys := Keys{Conn: "conn_" + strconv.Itoa(i), IP: "10.0.0.1"}
+			if !ml.Allow(keys, "chat") {
+				t.Fatalf("Message %d should be allowed by IP burst", i+1)
+			}
+		}
+		if ml.Allow(Keys{Conn: "fresh", IP: "10.0.0.1"}, "chat") {
+			t.Error("IP burst exhausted, new connection should be denied")
+		}
+		if !ml.Allow(Keys{Conn: "fresh", IP: "10.0.0.2"}, "chat") {
+			t.Error("Other IPs should not be affected")
+		}
+	})
+
+	t.Run("Denied message consumes nothing", func(t *testing.T) {
+		ml := NewMessageLimiter(cfg)
+		ip := Keys{Conn: "other", IP: "10.0.0.3"}
+		for i := 0; i < 6; i++ {
+			ml.Allow(ip, "chat")
+		}
+
+		// 連線還有 10 個令牌，但 IP 只剩 9 個：vote 被拒絕時連線的令牌不應被扣除
+		keys := Keys{Conn: "victim", IP: "10.0.0.3"}
+		if ml.Allow(keys, "vote") {
+			t.Fatal("Vote should be denied by the IP dimension")
+		}
+		if remaining := ml.conn.GetRemaining("victim"); remaining != 10 {
+			t.Errorf("Expected connection tokens to be refunded, got %d", remaining)
+		}
+		if remaining := ml.GetRemaining(keys); remaining != 9 {
+			t.Errorf("Expected 9 remaining across dimensions, got %d", remaining)
+		}
+	})
+}
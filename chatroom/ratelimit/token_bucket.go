@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket 令牌桶限流器：以固定速率補充令牌，桶容量即允許的突發量
+type TokenBucket struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	rate    float64 // 每秒補充的令牌數
+	burst   float64 // 桶容量
+	enabled bool
+}
+
+// bucket 單一鍵值的令牌狀態
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket 創建令牌桶：每個 window 補充 limit 個令牌，最多累積 burst 個。
+// burst 小於等於 0 時使用 limit。
+func NewTokenBucket(limit int, window time.Duration, burst int, enabled bool) *TokenBucket {
+	tb := &TokenBucket{
+		buckets: make(map[string]*bucket),
+		enabled: enabled,
+	}
+	tb.setLimitsLocked(limit, window, burst)
+
+	// 定期清理已經補滿的記錄
+	go tb.cleanup()
+
+	return tb
+}
+
+// Allow 消耗一個令牌
+func (tb *TokenBucket) Allow(key string) bool {
+	return tb.AllowN(key, 1)
+}
+
+// AllowN 消耗 cost 個令牌，令牌不足時不消耗並回傳 false
+func (tb *TokenBucket) AllowN(key string, cost float64) bool {
+	if !tb.isEnabled() || cost <= 0 {
+		return true
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.takeLocked(key, cost, time.Now())
+}
+
+// GetRemaining 獲取剩餘令牌數（無條件捨去）
+func (tb *TokenBucket) GetRemaining(key string) int {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if !tb.enabled {
+		return int(tb.burst)
+	}
+	return int(tb.refillLocked(key, time.Now()).tokens)
+}
+
+// RetryAfter 累積到 cost 個令牌還需要等待的時間，超過桶容量時以補滿計算
+func (tb *TokenBucket) RetryAfter(key string, cost float64) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if !tb.enabled || tb.rate <= 0 {
+		return 0
+	}
+	missing := min(cost, tb.burst) - tb.refillLocked(key, time.Now()).tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / tb.rate * float64(time.Second))
+}
+
+// Reset 重置鍵值的令牌
+func (tb *TokenBucket) Reset(key string) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	delete(tb.buckets, key)
+}
+
+// SetLimits 調整補充速率與桶容量，已累積的令牌不會超過新的容量
+func (tb *TokenBucket) SetLimits(limit int, window time.Duration, burst int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.setLimitsLocked(limit, window, burst)
+	for _, b := range tb.buckets {
+		b.tokens = min(b.tokens, tb.burst)
+	}
+}
+
+// setLimitsLocked 設定補充速率與桶容量（呼叫端需持有鎖）
+func (tb *TokenBucket) setLimitsLocked(limit int, window time.Duration, burst int) {
+	if burst <= 0 {
+		burst = limit
+	}
+	tb.burst = float64(burst)
+	tb.rate = 0
+	if window > 0 {
+		tb.rate = float64(limit) / window.Seconds()
+	}
+}
+
+// SetEnabled 設置是否啟用
+func (tb *TokenBucket) SetEnabled(enabled bool) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.enabled = enabled
+}
+
+// capacity 桶容量
+func (tb *TokenBucket) capacity() int {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return int(tb.burst)
+}
+
+// isEnabled 是否啟用
+func (tb *TokenBucket) isEnabled() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.enabled
+}
+
+// takeLocked 補充後嘗試消耗令牌（呼叫端需持有鎖）
+func (tb *TokenBucket) takeLocked(key string, cost float64, now time.Time) bool {
+	b := tb.refillLocked(key, now)
+	if b.tokens < cost {
+		return false
+	}
+	b.tokens -= cost
+	return true
+}
+
+// refundLocked 退回已消耗的令牌（呼叫端需持有鎖）
+func (tb *TokenBucket) refundLocked(key string, cost float64) {
+	if b, ok := tb.buckets[key]; ok {
+		b.tokens = min(b.tokens+cost, tb.burst)
+	}
+}
+
+// refillLocked 依經過時間補充令牌（呼叫端需持有鎖）
+func (tb *TokenBucket) refillLocked(key string, now time.Time) *bucket {
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &bucket{tokens: tb.burst, last: now}
+		tb.buckets[key] = b
+		return b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed*tb.rate, tb.burst)
+		b.last = now
+	}
+	return b
+}
+
+// cleanup 定期清理已補滿的記錄，補滿的桶與不存在的桶行為相同
+func (tb *TokenBucket) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		tb.mu.Lock()
+		now := time.Now()
+		for key := range tb.buckets {
+			if tb.refillLocked(key, now).tokens >= tb.burst {
+				delete(tb.buckets, key)
+			}
+		}
+		tb.mu.Unlock()
+	}
+}
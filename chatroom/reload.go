@@ -0,0 +1,114 @@
+package main
+
+import (
+	"chatroom/config"
+	"chatroom/logger"
+	"chatroom/pool"
+	"chatroom/service"
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// configWatchInterval 檢查設定檔是否變更的間隔
+const configWatchInterval = 2 * time.Second
+
+// configReloader 重新載入配置，只套用可以即時生效的變更
+type configReloader struct {
+	mu      sync.Mutex
+	loader  *config.Loader
+	applied *config.Config // 目前生效的配置（不與服務共用，避免競爭）
+	service *service.StateServiceV2
+	pool    *pool.WorkerPool
+}
+
+// newConfigReloader 以啟動時的配置建立 reloader
+func newConfigReloader(loader *config.Loader, cfg *config.Config, s *service.StateServiceV2, p *pool.WorkerPool) *configReloader {
+	return &configReloader{
+		loader:  loader,
+		applied: cfg.Clone(),
+		service: s,
+		pool:    p,
+	}
+}
+
+// Watch 收到 SIGHUP 或設定檔變更時重新載入，直到 ctx 結束
+func (r *configReloader) Watch(ctx context.Context) {
+	if path := r.loader.ConfigPath(); path != "" {
+		go config.WatchFile(ctx, path, configWatchInterval, func() { r.Reload("file") })
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.Reload("SIGHUP")
+		}
+	}
+}
+
+// Reload 重新載入配置：驗證失敗時整份拒絕，無法即時生效的變更會被忽略並記錄
+func (r *configReloader) Reload(source string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.loader.Load()
+	if err != nil {
+		logger.Error("Config reload rejected", zap.String("source", source), zap.Error(err))
+		return
+	}
+
+	changes := config.Diff(r.applied, next)
+	if len(changes) == 0 {
+		logger.Info("Config reloaded, nothing changed", zap.String("source", source))
+		return
+	}
+
+	live := 0
+	for _, change := range changes {
+		fields := []zap.Field{
+			zap.String("source", source),
+			zap.String("key", change.Key),
+			zap.String("old", change.Old),
+			zap.String("new", change.New),
+		}
+		if config.IsLive(change.Key) {
+			live++
+			logger.Info("Config changed", fields...)
+		} else {
+			logger.Warn("Config change requires restart, ignored", fields...)
+		}
+	}
+	if live == 0 {
+		return
+	}
+
+	// 只更新可即時生效的項目，其餘維持啟動時的值
+	updated := r.applied.Clone()
+	updated.RateLimit = next.Clone().RateLimit
+	updated.Storage.HistoryMaxSize = next.Storage.HistoryMaxSize
+	updated.Pool.Workers = next.Pool.Workers
+	updated.Log.Level = next.Log.Level
+
+	r.service.ApplyRuntimeConfig(updated)
+	r.pool.Resize(updated.Pool.Workers)
+	if err := logger.SetLevel(updated.Log.Level); err != nil {
+		logger.Error("Failed to set log level", zap.Error(err))
+	}
+
+	r.applied = updated
+	logger.Info("Config reload applied",
+		zap.String("source", source),
+		zap.Int("applied", live),
+		zap.Int("ignored", len(changes)-live))
+}
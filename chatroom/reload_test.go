@@ -0,0 +1,76 @@
+package main
+
+import (
+	"chatroom/config"
+	"chatroom/logger"
+	"chatroom/metrics"
+	"chatroom/models"
+	"chatroom/pool"
+	"chatroom/ratelimit"
+	"chatroom/repository"
+	"chatroom/service"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "chatroom.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+	}
+	write("storage:\n  history_max_size: 5\npool:\n  workers: 2\n")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := config.NewLoader(fs)
+	if err := fs.Parse([]string{"-config", path}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	wp := pool.NewWorkerPool(cfg.Pool.Workers, cfg.Pool.QueueSize)
+	wp.Start()
+	defer wp.Stop()
+	repo := repository.NewFileLeaderboardRepository(filepath.Join(dir, "leaderboard.json"))
+	svc := service.NewStateServiceWithDeps(make(chan models.Message, 10), repo, wp,
+		ratelimit.NewMessageLimiter(cfg.RateLimit), metrics.GetMetrics(), cfg)
+	reloader := newConfigReloader(loader, cfg, svc, wp)
+
+	for i := 0; i < 5; i++ {
+		svc.AddHistory(models.Message{Type: "chat", Room: "reload_room"})
+	}
+
+	// 可即時生效的變更會套用，需要重新啟動的變更會被忽略
+	write("storage:\n  history_max_size: 2\npool:\n  workers: 4\nlog:\n  level: warn\nserver:\n  port: 9999\n")
+	reloader.Reload("test")
+	defer logger.SetLevel("info")
+
+	if got := len(svc.History["reload_room"]); got != 2 {
+		t.Errorf("Expected history trimmed to 2, got %d", got)
+	}
+	if wp.Size() != 4 {
+		t.Errorf("Expected 4 workers, got %d", wp.Size())
+	}
+	if logger.GetLevel() != "warn" {
+		t.Errorf("Expected log level warn, got %s", logger.GetLevel())
+	}
+	if reloader.applied.Server.Port != "8080" {
+		t.Errorf("Port change should be ignored, got %s", reloader.applied.Server.Port)
+	}
+
+	// 驗證失敗的配置整份拒絕
+	write("storage:\n  history_max_size: -1\npool:\n  workers: 8\n")
+	reloader.Reload("test")
+	if wp.Size() != 4 || reloader.applied.Storage.HistoryMaxSize != 2 {
+		t.Errorf("Invalid config should be rejected, got workers=%d history=%d",
+			wp.Size(), reloader.applied.Storage.HistoryMaxSize)
+	}
+}
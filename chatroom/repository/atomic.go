@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// writeFileAtomic 先寫入同目錄的暫存檔並 fsync，再以 rename 取代原檔；
+// 當機時檔案不是舊內容就是新內容，不會留下寫到一半的檔案。
+// backups > 0 時取代前先將原檔保留為 path.1（最新）到 path.N。
+func writeFileAtomic(path string, data []byte, perm os.FileMode, backups int) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // rename 成功後檔案已不存在，移除會失敗但不影響
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if backups > 0 {
+		if err := rotateBackups(path, backups); err != nil {
+			return fmt.Errorf("rotate backups: %w", err)
+		}
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// rotateBackups 將 path.1 … path.(n-1) 往後移一號，再把目前的檔案保留為 path.1
+func rotateBackups(path string, n int) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	for i := n - 1; i >= 1; i-- {
+		if err := os.Rename(backupPath(path, i), backupPath(path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// 以硬連結保留目前的檔案，原檔在 rename 之前一直存在；不支援硬連結時改為複製
+	newest := backupPath(path, 1)
+	if err := os.Remove(newest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(path, newest); err == nil {
+		return nil
+	}
+	return copyFile(path, newest)
+}
+
+// backupPath 第 i 份備份的路徑，1 為最新
+func backupPath(path string, i int) string {
+	return path + "." + strconv.Itoa(i)
+}
+
+// preserveCorrupt 將無法解析的檔案改名保留，方便事後檢查，回傳新的路徑
+func preserveCorrupt(path string) (string, error) {
+	corrupt := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+	if err := os.Rename(path, corrupt); err != nil {
+		return "", err
+	}
+	return corrupt, nil
+}
+
+// copyFile 複製檔案並 fsync
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir fsync 目錄，確保 rename 寫入磁碟（不支援的平台忽略錯誤）
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 媒體檔案錯誤
+var (
+	ErrBlobNotFound        = errors.New("blob not found")
+	ErrUnsupportedBlobType = errors.New("unsupported blob type")
+)
+
+// BlobTypes 可以儲存的內容類型與對應的副檔名
+var BlobTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"audio/webm": ".webm",
+	"audio/ogg":  ".ogg",
+	"audio/mpeg": ".mp3",
+	"audio/wav":  ".wav",
+	"audio/mp4":  ".m4a",
+}
+
+// blobKeyPattern 內容的 SHA-256 加上副檔名，同時避免路徑穿越
+var blobKeyPattern = regexp.MustCompile(`^[0-9a-f]{64}\.[0-9a-z]+$`)
+
+// Blob 已儲存的媒體檔案
+type Blob struct {
+	Key         string `json:"key"` // 內容的 SHA-256 加上副檔名，相同內容的 key 相同
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"` // 客戶端取得檔案的網址，聊天訊息只攜帶這個網址
+}
+
+// BlobStore 媒體檔案儲存介面，以內容定址：相同內容只會儲存一份
+type BlobStore interface {
+	// Put 儲存內容，contentType 必須是 BlobTypes 之一
+	Put(data []byte, contentType string) (Blob, error)
+	// Open 讀取檔案，不存在時回傳 ErrBlobNotFound
+	Open(key string) (io.ReadCloser, Blob, error)
+	// Stat 取得檔案資訊，不存在時回傳 ErrBlobNotFound
+	Stat(key string) (Blob, error)
+	// Key 從本儲存產生的網址取得 key，不是本儲存的網址時回傳 false
+	Key(url string) (string, bool)
+	Ping() error
+}
+
+// LocalBlobStore 將媒體檔案存放在本機目錄，依 key 的前兩個字元分成子目錄
+type LocalBlobStore struct {
+	dir       string
+	urlPrefix string
+}
+
+// NewLocalBlobStore 建立本機媒體儲存；urlPrefix 為提供檔案的網址前綴（例如 /media/）
+func NewLocalBlobStore(dir, urlPrefix string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalBlobStore{dir: dir, urlPrefix: urlPrefix}, nil
+}
+
+// Put 以內容的 SHA-256 命名並以原子寫入儲存，檔案已存在時直接回傳
+func (s *LocalBlobStore) Put(data []byte, contentType string) (Blob, error) {
+	ext, ok := BlobTypes[contentType]
+	if !ok {
+		return Blob{}, ErrUnsupportedBlobType
+	}
+
+	sum := sha256.Sum256(data)
+	key := hex.EncodeToString(sum[:]) + ext
+	blob := s.blob(key, int64(len(data)))
+
+	path := s.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return blob, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return Blob{}, err
+	}
+	if err := writeFileAtomic(path, data, 0644, 0); err != nil {
+		return Blob{}, err
+	}
+	return blob, nil
+}
+
+// Open 開啟檔案，回傳的 *os.File 可供 http.ServeContent 處理 Range 請求
+func (s *LocalBlobStore) Open(key string) (io.ReadCloser, Blob, error) {
+	blob, err := s.Stat(key)
+	if err != nil {
+		return nil, Blob{}, err
+	}
+	file, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, Blob{}, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, Blob{}, err
+	}
+	return file, blob, nil
+}
+
+// Stat 取得檔案資訊
+func (s *LocalBlobStore) Stat(key string) (Blob, error) {
+	if !blobKeyPattern.MatchString(key) {
+		return Blob{}, ErrBlobNotFound
+	}
+	info, err := os.Stat(s.path(key))
+	if os.IsNotExist(err) {
+		return Blob{}, ErrBlobNotFound
+	}
+	if err != nil {
+		return Blob{}, err
+	}
+	return s.blob(key, info.Size()), nil
+}
+
+// Key 從網址取得 key
+func (s *LocalBlobStore) Key(url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, s.urlPrefix)
+	if !ok || !blobKeyPattern.MatchString(key) {
+		return "", false
+	}
+	return key, true
+}
+
+// Ping 檢查目錄是否可以存取
+func (s *LocalBlobStore) Ping() error {
+	_, err := os.Stat(s.dir)
+	return err
+}
+
+// blob 依 key 組出檔案資訊，內容類型由副檔名決定
+func (s *LocalBlobStore) blob(key string, size int64) Blob {
+	return Blob{
+		Key:         key,
+		ContentType: blobContentType(key),
+		Size:        size,
+		URL:         s.urlPrefix + key,
+	}
+}
+
+// path 檔案路徑：目錄/前兩個字元/key
+func (s *LocalBlobStore) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key)
+}
+
+// blobContentType 依 key 的副檔名取得內容類型
+func blobContentType(key string) string {
+	ext := filepath.Ext(key)
+	for contentType, e := range BlobTypes {
+		if e == ext {
+			return contentType
+		}
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestLocalBlobStore(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir(), "/media/")
+	if err != nil {
+		t.Fatalf("NewLocalBlobStore failed: %v", err)
+	}
+
+	data := []byte("\x89PNG\r\n\x1a\nfake image")
+	blob, err := store.Put(data, "image/png")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if len(blob.Key) != 68 || blob.URL != "/media/"+blob.Key || blob.Size != int64(len(data)) {
+		t.Errorf("Unexpected blob %+v", blob)
+	}
+
+	// 相同內容得到相同的 key
+	again, err := store.Put(data, "image/png")
+	if err != nil || again != blob {
+		t.Errorf("Expected the same blob for the same content, got %+v, %v", again, err)
+	}
+
+	key, ok := store.Key(blob.URL)
+	if !ok || key != blob.Key {
+		t.Errorf("Key(%q) = %q, %v", blob.URL, key, ok)
+	}
+	file, stat, err := store.Open(key)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	content, _ := io.ReadAll(file)
+	file.Close()
+	if string(content) != string(data) || stat.ContentType != "image/png" {
+		t.Errorf("Unexpected content %q (%s)", content, stat.ContentType)
+	}
+
+	if _, err := store.Put(data, "text/html"); !errors.Is(err, ErrUnsupportedBlobType) {
+		t.Errorf("Expected ErrUnsupportedBlobType, got %v", err)
+	}
+	for _, url := range []string{"/media/../leaderboard.json", "https://example.com/x.png", "/media/" + blob.Key[:10]} {
+		if _, ok := store.Key(url); ok {
+			t.Errorf("Key(%q) should be rejected", url)
+		}
+	}
+	if _, err := store.Stat("../../etc/passwd"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound for an invalid key, got %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+package repository
+
+import (
+	"chatroom/models"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// 資料庫中的 bucket
+var (
+	metaBucket         = []byte("meta")
+	leaderboardBucket  = []byte("leaderboard")  // 猜數字總榜
+	leaderboardsBucket = []byte("leaderboards") // 其他排行榜，每個一個子 bucket
+	roomsBucket        = []byte("rooms")
+	historyBucket      = []byte("history") // 每個房間一個子 bucket，鍵為訊息 ID
+	profilesBucket     = []byte("profiles")
+
+	schemaVersionKey = []byte("schema_version")
+	lastMessageIDKey = []byte("last_message_id")
+)
+
+// ErrSchemaTooNew 資料庫由較新版本的程式建立，無法安全地開啟
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+// boltOpenTimeout 等待資料庫檔案鎖的時間；伺服器執行中時命令列工具會在此時間後放棄
+const boltOpenTimeout = time.Second
+
+// BoltOptions 開啟資料庫的選項
+type BoltOptions struct {
+	// 第一次建立資料庫時匯入的舊版 JSON 檔案，檔案不存在時略過
+	LegacyLeaderboardFile string
+	LegacyRoomsFile       string
+}
+
+// BoltStore 以 bbolt 嵌入式資料庫保存排行榜、房間、聊天記錄與使用者資料
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore 開啟（或建立）資料庫並執行尚未套用的 schema migration
+func OpenBoltStore(path string, opts BoltOptions) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("open %s: database is locked by another process (is the server running?)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+
+	store := &BoltStore{db: db}
+	if err := store.migrate(opts); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// Close 關閉資料庫
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Ping 檢查資料庫是否可讀取
+func (s *BoltStore) Ping() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(metaBucket) == nil {
+			return errors.New("meta bucket missing")
+		}
+		return nil
+	})
+}
+
+// SchemaVersion 資料庫目前的 schema 版本
+func (s *BoltStore) SchemaVersion() (int, error) {
+	var version int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = schemaVersion(tx)
+		return err
+	})
+	return version, err
+}
+
+// Leaderboard 猜數字總榜，顯示前 maxSize 名；資料無法讀取時回傳錯誤，
+// 不會以空白排行榜繼續執行
+func (s *BoltStore) Leaderboard(maxSize int) (*BoltLeaderboardRepository, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultLeaderboardSize
+	}
+	repo := &BoltLeaderboardRepository{store: s, maxSize: maxSize, less: ByTriesThenTime}
+	if _, err := repo.Load(); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Leaderboards 其他排行榜（其他遊戲、每日、每週、各房間）的儲存
+func (s *BoltStore) Leaderboards() *BoltLeaderboardStore {
+	return &BoltLeaderboardStore{store: s}
+}
+
+// Rooms 永久房間儲存
+func (s *BoltStore) Rooms() *BoltRoomRepository {
+	return &BoltRoomRepository{store: s}
+}
+
+// History 聊天記錄儲存
+func (s *BoltStore) History() *BoltHistoryRepository {
+	return &BoltHistoryRepository{store: s}
+}
+
+// Profiles 使用者資料儲存
+func (s *BoltStore) Profiles() *BoltProfileRepository {
+	return &BoltProfileRepository{store: s}
+}
+
+// migration 一次 schema 變更，版本號依序遞增，套用後記錄在 meta bucket
+type migration struct {
+	version int
+	name    string
+	up      func(tx *bolt.Tx, opts BoltOptions) error
+}
+
+// migrations 所有 schema 變更；新增時只能附加在最後，不可修改已發布的項目
+var migrations = []migration{
+	{1, "create buckets", func(tx *bolt.Tx, _ BoltOptions) error {
+		for _, name := range [][]byte{leaderboardBucket, roomsBucket, historyBucket, profilesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{2, "import legacy JSON files", importLegacyFiles},
+	{3, "create leaderboards bucket", func(tx *bolt.Tx, _ BoltOptions) error {
+		_, err := tx.CreateBucketIfNotExists(leaderboardsBucket)
+		return err
+	}},
+	{4, "key leaderboard rows by player", rekeyLeaderboards},
+}
+
+// migrate 依序套用尚未執行的 migration，每一個都在獨立的交易中完成
+func (s *BoltStore) migrate(opts BoltOptions) error {
+	latest := migrations[len(migrations)-1].version
+	for _, m := range migrations {
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			meta, err := tx.CreateBucketIfNotExists(metaBucket)
+			if err != nil {
+				return err
+			}
+			version, err := schemaVersion(tx)
+			if err != nil {
+				return err
+			}
+			if version > latest {
+				return fmt.Errorf("%w (database v%d, binary v%d)", ErrSchemaTooNew, version, latest)
+			}
+			if version >= m.version {
+				return nil
+			}
+
+			if err := m.up(tx, opts); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+			return meta.Put(schemaVersionKey, []byte(strconv.Itoa(m.version)))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaVersion 讀取 schema 版本，尚未初始化的資料庫為 0
+func schemaVersion(tx *bolt.Tx) (int, error) {
+	meta := tx.Bucket(metaBucket)
+	if meta == nil {
+		return 0, nil
+	}
+	value := meta.Get(schemaVersionKey)
+	if value == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q", value)
+	}
+	return version, nil
+}
+
+// importLegacyFiles 匯入檔案儲存時期的排行榜與房間，讓切換儲存方式時不遺失資料
+func importLegacyFiles(tx *bolt.Tx, opts BoltOptions) error {
+	if opts.LegacyLeaderboardFile != "" {
+		var scores []models.GameScore
+		if err := readLegacyJSON(opts.LegacyLeaderboardFile, &scores); err != nil {
+			return err
+		}
+		if err := putScores(tx, nil, rankScores(scores, ByTriesThenTime)); err != nil {
+			return err
+		}
+	}
+
+	if opts.LegacyRoomsFile != "" {
+		var rooms []models.Room
+		if err := readLegacyJSON(opts.LegacyRoomsFile, &rooms); err != nil {
+			return err
+		}
+		for _, room := range rooms {
+			if err := putJSON(tx.Bucket(roomsBucket), []byte(room.Name), room); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rekeyLeaderboards 排行榜的鍵由名次改為玩家，新增成績時只需寫入該玩家的一筆資料；
+// 原本依名次排列，同一位玩家重複時保留名次較前的一筆
+func rekeyLeaderboards(tx *bolt.Tx, _ BoltOptions) error {
+	ids := [][]byte{nil}
+	err := tx.Bucket(leaderboardsBucket).ForEachBucket(func(name []byte) error {
+		ids = append(ids, append([]byte(nil), name...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		b := scoresBucket(tx, id)
+		if b == nil {
+			continue
+		}
+		var scores []models.GameScore
+		err := b.ForEach(func(_, v []byte) error {
+			var score models.GameScore
+			if err := json.Unmarshal(v, &score); err != nil {
+				return err
+			}
+			scores = append(scores, score)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := putScores(tx, id, scores); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLegacyJSON 讀取舊版 JSON 檔案，檔案不存在時保持空值
+func readLegacyJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// putJSON 以 JSON 寫入一筆資料
+func putJSON(b *bolt.Bucket, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// itob 將數字轉為 8 bytes big-endian，讓 bucket 中的鍵依數字排序
+func itob(n int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(n))
+	return b
+}
+
+// btoi itob 的反向轉換
+func btoi(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b))
+}
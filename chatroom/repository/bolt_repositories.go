@@ -0,0 +1,433 @@
+package repository
+
+import (
+	"chatroom/models"
+	"encoding/json"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltLeaderboardRepository 資料庫型排行榜儲存，保留每位玩家的最佳成績，記憶體中保留一份排序後的快取
+type BoltLeaderboardRepository struct {
+	store   *BoltStore
+	id      []byte // leaderboards 中的子 bucket，nil 表示原本的 leaderboard bucket（猜數字總榜）
+	maxSize int
+	less    Less
+
+	mu     sync.RWMutex
+	scores []models.GameScore
+}
+
+// Load 從資料庫載入排行榜
+func (r *BoltLeaderboardRepository) Load() ([]models.GameScore, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	scores := make([]models.GameScore, 0)
+	err := r.store.db.View(func(tx *bolt.Tx) error {
+		b := scoresBucket(tx, r.id)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var score models.GameScore
+			if err := json.Unmarshal(v, &score); err != nil {
+				return err
+			}
+			scores = append(scores, score)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 資料以玩家為鍵，名次在記憶體中排序
+	r.scores = rankScores(scores, r.less)
+	return r.scores, nil
+}
+
+// Save 以指定的分數取代整個排行榜
+func (r *BoltLeaderboardRepository) Save(scores []models.GameScore) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.saveLocked(scores)
+}
+
+// saveLocked 寫入資料庫成功後才更新快取（呼叫端需持有寫鎖）
+func (r *BoltLeaderboardRepository) saveLocked(scores []models.GameScore) error {
+	err := r.store.db.Update(func(tx *bolt.Tx) error {
+		return putScores(tx, r.id, scores)
+	})
+	if err != nil {
+		return err
+	}
+	r.scores = append([]models.GameScore(nil), scores...)
+	return nil
+}
+
+// Add 新增分數並排序；同一位玩家只保留最佳成績，只寫入該玩家的一筆資料
+func (r *BoltLeaderboardRepository) Add(score models.GameScore) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 沒有比原本的最佳成績好時不需要寫入
+	if _, best, ok := findPlayer(r.scores, score); ok && !r.lessOrDefault()(score, best) {
+		return nil
+	}
+
+	err := r.store.db.Update(func(tx *bolt.Tx) error {
+		b, err := createScoresBucket(tx, r.id)
+		if err != nil {
+			return err
+		}
+		return putJSON(b, []byte(playerKey(score)), score)
+	})
+	if err != nil {
+		return err
+	}
+	r.scores = rankScores(keepBest(append([]models.GameScore(nil), r.scores...), score, r.less), r.less)
+	return nil
+}
+
+// lessOrDefault 排行榜的排序方式，未指定時依次數與時間
+func (r *BoltLeaderboardRepository) lessOrDefault() Less {
+	if r.less == nil {
+		return ByTriesThenTime
+	}
+	return r.less
+}
+
+// GetTop 獲取前 N 名（最多 maxSize 名）
+func (r *BoltLeaderboardRepository) GetTop(n int) ([]models.GameScore, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n = min(n, r.maxSize, len(r.scores))
+	result := make([]models.GameScore, n)
+	copy(result, r.scores[:n])
+	return result, nil
+}
+
+// GetAll 獲取所有分數
+func (r *BoltLeaderboardRepository) GetAll() []models.GameScore {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]models.GameScore, len(r.scores))
+	copy(result, r.scores)
+	return result
+}
+
+// GetRank 玩家最佳成績的名次
+func (r *BoltLeaderboardRepository) GetRank(userID string) (int, models.GameScore, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return rankOf(r.scores, userID)
+}
+
+// GetAround 玩家前後各 n 名的成績
+func (r *BoltLeaderboardRepository) GetAround(userID string, n int) ([]models.GameScore, int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return scoresAround(r.scores, userID, n)
+}
+
+// Clear 清空排行榜
+func (r *BoltLeaderboardRepository) Clear() error {
+	return r.Save(make([]models.GameScore, 0))
+}
+
+// Ping 檢查資料庫是否可讀取
+func (r *BoltLeaderboardRepository) Ping() error {
+	return r.store.Ping()
+}
+
+// bucketParent 可以建立與刪除子 bucket 的交易或 bucket
+type bucketParent interface {
+	CreateBucket(key []byte) (*bolt.Bucket, error)
+	DeleteBucket(key []byte) error
+}
+
+// scoresBucket 排行榜的 bucket，尚未寫入過時為 nil
+func scoresBucket(tx *bolt.Tx, id []byte) *bolt.Bucket {
+	if id == nil {
+		return tx.Bucket(leaderboardBucket)
+	}
+	return tx.Bucket(leaderboardsBucket).Bucket(id)
+}
+
+// createScoresBucket 排行榜的 bucket，不存在時建立
+func createScoresBucket(tx *bolt.Tx, id []byte) (*bolt.Bucket, error) {
+	if id == nil {
+		return tx.CreateBucketIfNotExists(leaderboardBucket)
+	}
+	return tx.Bucket(leaderboardsBucket).CreateBucketIfNotExists(id)
+}
+
+// putScores 重建排行榜 bucket，鍵為玩家（playerKey）；同一位玩家出現多次時保留較前面的一筆
+func putScores(tx *bolt.Tx, id []byte, scores []models.GameScore) error {
+	var parent bucketParent = tx
+	name := leaderboardBucket
+	if id != nil {
+		parent, name = tx.Bucket(leaderboardsBucket), id
+	}
+
+	if err := parent.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	b, err := parent.CreateBucket(name)
+	if err != nil {
+		return err
+	}
+	for _, score := range scores {
+		key := []byte(playerKey(score))
+		if b.Get(key) != nil {
+			continue
+		}
+		if err := putJSON(b, key, score); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BoltLeaderboardStore 資料庫型的多排行榜儲存，每個排行榜是 leaderboards 中的一個子 bucket
+type BoltLeaderboardStore struct {
+	store *BoltStore
+}
+
+// Open 開啟（或建立）排行榜
+func (s *BoltLeaderboardStore) Open(id string, size int, less Less) (LeaderboardRepository, error) {
+	repo := &BoltLeaderboardRepository{store: s.store, id: []byte(id), maxSize: size, less: less}
+	if _, err := repo.Load(); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// List 列出所有排行榜 ID
+func (s *BoltLeaderboardStore) List() ([]string, error) {
+	var ids []string
+	err := s.store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(leaderboardsBucket).ForEachBucket(func(name []byte) error {
+			ids = append(ids, string(name))
+			return nil
+		})
+	})
+	return ids, err
+}
+
+// Drop 刪除排行榜
+func (s *BoltLeaderboardStore) Drop(id string) error {
+	return s.store.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(leaderboardsBucket).DeleteBucket([]byte(id))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// BoltRoomRepository 資料庫型永久房間儲存
+type BoltRoomRepository struct {
+	store *BoltStore
+}
+
+// Load 載入所有房間（依名稱排序）
+func (r *BoltRoomRepository) Load() ([]models.Room, error) {
+	var rooms []models.Room
+	err := r.store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(roomsBucket).ForEach(func(_, v []byte) error {
+			var room models.Room
+			if err := json.Unmarshal(v, &room); err != nil {
+				return err
+			}
+			rooms = append(rooms, room)
+			return nil
+		})
+	})
+	return rooms, err
+}
+
+// Save 新增或更新房間
+func (r *BoltRoomRepository) Save(room models.Room) error {
+	return r.store.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(roomsBucket), []byte(room.Name), room)
+	})
+}
+
+// Delete 刪除房間
+func (r *BoltRoomRepository) Delete(name string) error {
+	return r.store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(roomsBucket).Delete([]byte(name))
+	})
+}
+
+// GetAll 獲取所有房間（依名稱排序），讀取失敗時回傳空列表
+func (r *BoltRoomRepository) GetAll() []models.Room {
+	rooms, err := r.Load()
+	if err != nil {
+		return nil
+	}
+	return rooms
+}
+
+// Ping 檢查資料庫是否可讀取
+func (r *BoltRoomRepository) Ping() error {
+	return r.store.Ping()
+}
+
+// BoltHistoryRepository 資料庫型聊天記錄儲存
+type BoltHistoryRepository struct {
+	store *BoltStore
+}
+
+// Append 寫入訊息並裁切房間記錄；同時寫入的訊息會合併為一次交易
+func (r *BoltHistoryRepository) Append(msg models.Message, keep int) error {
+	return r.store.db.Batch(func(tx *bolt.Tx) error {
+		room, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(msg.Room))
+		if err != nil {
+			return err
+		}
+		if err := putJSON(room, itob(msg.ID), msg); err != nil {
+			return err
+		}
+
+		meta := tx.Bucket(metaBucket)
+		if last := meta.Get(lastMessageIDKey); last == nil || btoi(last) < msg.ID {
+			if err := meta.Put(lastMessageIDKey, itob(msg.ID)); err != nil {
+				return err
+			}
+		}
+		return trimRoom(room, keep)
+	})
+}
+
+// LoadAll 載入每個房間最新的 keep 則訊息（keep <= 0 表示全部）
+func (r *BoltHistoryRepository) LoadAll(keep int) (map[string][]models.Message, error) {
+	history := make(map[string][]models.Message)
+	err := r.store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyBucket).ForEachBucket(func(name []byte) error {
+			var messages []models.Message
+			c := tx.Bucket(historyBucket).Bucket(name).Cursor()
+			for k, v := c.Last(); k != nil && (keep <= 0 || len(messages) < keep); k, v = c.Prev() {
+				var msg models.Message
+				if err := json.Unmarshal(v, &msg); err != nil {
+					return err
+				}
+				messages = append(messages, msg)
+			}
+
+			// 由新到舊讀取，反轉為由舊到新
+			for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+				messages[i], messages[j] = messages[j], messages[i]
+			}
+			if len(messages) > 0 {
+				history[string(name)] = messages
+			}
+			return nil
+		})
+	})
+	return history, err
+}
+
+// LastID 已分配過的最大訊息 ID
+func (r *BoltHistoryRepository) LastID() (int64, error) {
+	var id int64
+	err := r.store.db.View(func(tx *bolt.Tx) error {
+		if last := tx.Bucket(metaBucket).Get(lastMessageIDKey); last != nil {
+			id = btoi(last)
+		}
+		return nil
+	})
+	return id, err
+}
+
+// Delete 刪除房間中的一則訊息
+func (r *BoltHistoryRepository) Delete(room string, id int64) error {
+	return r.store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(historyBucket).Bucket([]byte(room))
+		if b == nil {
+			return nil
+		}
+		return b.Delete(itob(id))
+	})
+}
+
+// Trim 將每個房間裁切為最新的 keep 則
+func (r *BoltHistoryRepository) Trim(keep int) error {
+	return r.store.db.Update(func(tx *bolt.Tx) error {
+		history := tx.Bucket(historyBucket)
+		return history.ForEachBucket(func(name []byte) error {
+			return trimRoom(history.Bucket(name), keep)
+		})
+	})
+}
+
+// Ping 檢查資料庫是否可讀取
+func (r *BoltHistoryRepository) Ping() error {
+	return r.store.Ping()
+}
+
+// trimRoom 刪除最舊的訊息，只保留 keep 則（keep <= 0 表示不裁切）
+func trimRoom(room *bolt.Bucket, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	// Stats 不包含同一交易中尚未提交的寫入，以 cursor 計算
+	count := 0
+	c := room.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		count++
+	}
+	excess := count - keep
+	if excess <= 0 {
+		return nil
+	}
+
+	// 先收集再刪除，避免在走訪時修改 bucket
+	keys := make([][]byte, 0, excess)
+	for k, _ := c.First(); k != nil && len(keys) < excess; k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		if err := room.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BoltProfileRepository 資料庫型使用者資料儲存
+type BoltProfileRepository struct {
+	store *BoltStore
+}
+
+// Get 依使用者 ID 取得資料
+func (r *BoltProfileRepository) Get(userID string) (models.Profile, bool, error) {
+	var profile models.Profile
+	found := false
+	err := r.store.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(profilesBucket).Get([]byte(userID))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &profile)
+	})
+	return profile, found, err
+}
+
+// Save 新增或更新使用者資料
+func (r *BoltProfileRepository) Save(profile models.Profile) error {
+	return r.store.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(profilesBucket), []byte(profile.UserID), profile)
+	})
+}
+
+// Ping 檢查資料庫是否可讀取
+func (r *BoltProfileRepository) Ping() error {
+	return r.store.Ping()
+}
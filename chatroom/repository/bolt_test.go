@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"chatroom/models"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestStore(t *testing.T, path string, opts BoltOptions) *BoltStore {
+	t.Helper()
+	store, err := OpenBoltStore(path, opts)
+	if err != nil {
+		t.Fatalf("OpenBoltStore failed: %v", err)
+	}
+	return store
+}
+
+func openTestLeaderboard(t *testing.T, store *BoltStore, maxSize int) *BoltLeaderboardRepository {
+	t.Helper()
+	repo, err := store.Leaderboard(maxSize)
+	if err != nil {
+		t.Fatalf("Leaderboard failed: %v", err)
+	}
+	return repo
+}
+
+func TestBoltStoreMigrations(t *testing.T) {
+	dir := t.TempDir()
+	leaderboardFile := filepath.Join(dir, "leaderboard.json")
+	roomsFile := filepath.Join(dir, "rooms.json")
+	os.WriteFile(leaderboardFile, []byte(`[{"nickname":"Legacy","tries":2,"time":9}]`), 0644)
+	os.WriteFile(roomsFile, []byte(`[{"name":"舊房間","owner":"u1","persistent":true}]`), 0644)
+
+	path := filepath.Join(dir, "chatroom.db")
+	opts := BoltOptions{LegacyLeaderboardFile: leaderboardFile, LegacyRoomsFile: roomsFile}
+	store := openTestStore(t, path, opts)
+
+	if version, err := store.SchemaVersion(); err != nil || version != len(migrations) {
+		t.Errorf("Expected schema v%d, got v%d (%v)", len(migrations), version, err)
+	}
+
+	// 舊版 JSON 檔案在建立資料庫時匯入
+	if scores := openTestLeaderboard(t, store, 10).GetAll(); len(scores) != 1 || scores[0].Nickname != "Legacy" {
+		t.Errorf("Expected legacy score imported, got %+v", scores)
+	}
+	if rooms, err := store.Rooms().Load(); err != nil || len(rooms) != 1 || rooms[0].Name != "舊房間" {
+		t.Errorf("Expected legacy room imported, got %+v (%v)", rooms, err)
+	}
+
+	// 已套用的 migration 不會重複執行：清空後重新開啟不會再次匯入
+	openTestLeaderboard(t, store, 10).Clear()
+	store.Close()
+	store = openTestStore(t, path, opts)
+	if scores := openTestLeaderboard(t, store, 10).GetAll(); len(scores) != 0 {
+		t.Errorf("Legacy import should run once, got %d scores", len(scores))
+	}
+
+	// 較新版本建立的資料庫拒絕開啟
+	store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(schemaVersionKey, []byte("99"))
+	})
+	store.Close()
+	if _, err := OpenBoltStore(path, opts); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+func TestBoltLeaderboardKeyedByPlayer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chatroom.db")
+	store := openTestStore(t, path, BoltOptions{})
+
+	// 模擬 v3 的資料：鍵為名次，同一位玩家可能重複
+	store.db.Update(func(tx *bolt.Tx) error {
+		rows := []models.GameScore{
+			{UserID: "u1", Nickname: "Alice", Tries: 2},
+			{UserID: "u2", Nickname: "Bob", Tries: 3},
+			{UserID: "u1", Nickname: "Alice", Tries: 7},
+		}
+		tx.DeleteBucket(leaderboardBucket)
+		b, _ := tx.CreateBucket(leaderboardBucket)
+		for i, row := range rows {
+			putJSON(b, itob(int64(i)), row)
+		}
+		return tx.Bucket(metaBucket).Put(schemaVersionKey, []byte("3"))
+	})
+	store.Close()
+
+	store = openTestStore(t, path, BoltOptions{})
+	defer store.Close()
+	repo := openTestLeaderboard(t, store, 10)
+	if scores := repo.GetAll(); len(scores) != 2 || scores[0].Tries != 2 || scores[1].Nickname != "Bob" {
+		t.Fatalf("Expected [Alice(2) Bob], got %+v", scores)
+	}
+
+	// 新增成績只寫入該玩家的一筆資料，名次在記憶體中排序
+	repo.Add(models.GameScore{UserID: "u3", Nickname: "Carol", Tries: 1})
+	repo.Add(models.GameScore{UserID: "u2", Nickname: "Bob", Tries: 9})
+	var keys []string
+	store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(leaderboardBucket).ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	if len(keys) != 3 || keys[0] != "id:u1" || keys[2] != "id:u3" {
+		t.Errorf("Expected rows keyed by player, got %q", keys)
+	}
+	if scores := repo.GetAll(); scores[0].Nickname != "Carol" || scores[2].Tries != 3 {
+		t.Errorf("Expected Carol first and Bob's best kept, got %+v", scores)
+	}
+}
+
+func TestBoltStoreLegacyParseError(t *testing.T) {
+	dir := t.TempDir()
+	leaderboardFile := filepath.Join(dir, "leaderboard.json")
+	os.WriteFile(leaderboardFile, []byte("{broken"), 0644)
+
+	// 無法解析的舊檔案讓 migration 失敗，而不是默默丟棄分數
+	_, err := OpenBoltStore(filepath.Join(dir, "chatroom.db"), BoltOptions{LegacyLeaderboardFile: leaderboardFile})
+	if err == nil {
+		t.Fatal("Expected migration to fail on unparsable legacy file")
+	}
+}
+
+func TestBoltLeaderboardCorrupt(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "chatroom.db"), BoltOptions{})
+	defer store.Close()
+
+	store.db.Update(func(tx *bolt.Tx) error {
+		b, err := createScoresBucket(tx, nil)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("broken"), []byte("{broken"))
+	})
+
+	// 無法讀取的排行榜回傳錯誤，而不是當成空白排行榜
+	if _, err := store.Leaderboard(10); err == nil {
+		t.Fatal("Expected an error for a corrupt leaderboard bucket")
+	}
+}
+
+func TestBoltRepositories(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chatroom.db")
+	store := openTestStore(t, path, BoltOptions{})
+
+	t.Run("Leaderboard", func(t *testing.T) {
+		repo := openTestLeaderboard(t, store, 2)
+		repo.Add(models.GameScore{Nickname: "Slow", Tries: 5})
+		repo.Add(models.GameScore{Nickname: "Fast", Tries: 1})
+		repo.Add(models.GameScore{Nickname: "Mid", Tries: 3})
+
+		top, _ := repo.GetTop(10)
+		if len(top) != 2 || top[0].Nickname != "Fast" || top[1].Nickname != "Mid" {
+			t.Errorf("Expected [Fast Mid], got %+v", top)
+		}
+	})
+
+	t.Run("Leaderboards", func(t *testing.T) {
+		boards := store.Leaderboards()
+		repo, err := boards.Open("quiz.all_time@Lobby", 2, ByScoreThenTime)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		repo.Add(models.GameScore{Nickname: "Low", Score: 1})
+		repo.Add(models.GameScore{Nickname: "High", Score: 3})
+		boards.Open("quiz.daily.2026-01-01", 2, ByScoreThenTime)
+
+		if top, _ := repo.GetTop(10); len(top) != 2 || top[0].Nickname != "High" {
+			t.Errorf("Expected High first, got %+v", top)
+		}
+		// 只有寫入過的排行榜才會建立 bucket
+		if ids, _ := boards.List(); len(ids) != 1 || ids[0] != "quiz.all_time@Lobby" {
+			t.Errorf("Unexpected leaderboards %v", ids)
+		}
+		if err := boards.Drop("quiz.all_time@Lobby"); err != nil {
+			t.Fatalf("drop: %v", err)
+		}
+		if ids, _ := boards.List(); len(ids) != 0 {
+			t.Errorf("Expected no leaderboards after drop, got %v", ids)
+		}
+	})
+
+	t.Run("Rooms", func(t *testing.T) {
+		repo := store.Rooms()
+		repo.Save(models.Room{Name: "b", Owner: "u1"})
+		repo.Save(models.Room{Name: "a", Owner: "u2"})
+		repo.Delete("b")
+
+		if rooms := repo.GetAll(); len(rooms) != 1 || rooms[0].Name != "a" {
+			t.Errorf("Expected only room a, got %+v", rooms)
+		}
+	})
+
+	t.Run("History", func(t *testing.T) {
+		repo := store.History()
+		for id := int64(1); id <= 5; id++ {
+			if err := repo.Append(models.Message{ID: id, Room: "lobby", Content: "hi"}, 3); err != nil {
+				t.Fatalf("Append failed: %v", err)
+			}
+		}
+		repo.Append(models.Message{ID: 6, Room: "other"}, 3)
+		repo.Delete("lobby", 4)
+
+		history, err := repo.LoadAll(10)
+		if err != nil {
+			t.Fatalf("LoadAll failed: %v", err)
+		}
+		if got := history["lobby"]; len(got) != 2 || got[0].ID != 3 || got[1].ID != 5 {
+			t.Errorf("Expected lobby [3 5], got %+v", got)
+		}
+		if last, _ := repo.LastID(); last != 6 {
+			t.Errorf("Expected last ID 6, got %d", last)
+		}
+
+		repo.Trim(1)
+		history, _ = repo.LoadAll(0)
+		if got := history["lobby"]; len(got) != 1 || got[0].ID != 5 {
+			t.Errorf("Expected lobby trimmed to [5], got %+v", got)
+		}
+	})
+
+	t.Run("Profiles", func(t *testing.T) {
+		repo := store.Profiles()
+		if _, ok, err := repo.Get("u1"); ok || err != nil {
+			t.Errorf("Expected missing profile, got ok=%v err=%v", ok, err)
+		}
+		repo.Save(models.Profile{UserID: "u1", Nickname: "Alice", Level: 3})
+		if profile, ok, _ := repo.Get("u1"); !ok || profile.Nickname != "Alice" || profile.Level != 3 {
+			t.Errorf("Unexpected profile %+v", profile)
+		}
+	})
+
+	// 重新開啟後資料仍在
+	store.Close()
+	store = openTestStore(t, path, BoltOptions{})
+	defer store.Close()
+	if scores, _ := openTestLeaderboard(t, store, 2).GetTop(10); len(scores) != 2 {
+		t.Errorf("Expected 2 scores after reopen, got %d", len(scores))
+	}
+	if scores := openTestLeaderboard(t, store, 2).GetAll(); len(scores) != 3 {
+		t.Errorf("Expected every player's best after reopen, got %d", len(scores))
+	}
+	if _, ok, _ := store.Profiles().Get("u1"); !ok {
+		t.Error("Expected profile after reopen")
+	}
+}
@@ -0,0 +1,17 @@
+package repository
+
+import "chatroom/models"
+
+// HistoryRepository 聊天記錄存取介面，每個房間只保留最新的訊息
+type HistoryRepository interface {
+	// Append 寫入訊息，並只保留房間最新的 keep 則（keep <= 0 表示不裁切）
+	Append(msg models.Message, keep int) error
+	// LoadAll 載入每個房間最新的 keep 則訊息（依 ID 由舊到新）
+	LoadAll(keep int) (map[string][]models.Message, error)
+	// LastID 已分配過的最大訊息 ID，重新啟動後從這裡繼續
+	LastID() (int64, error)
+	Delete(room string, id int64) error
+	// Trim 將每個房間裁切為最新的 keep 則
+	Trim(keep int) error
+	Ping() error
+}
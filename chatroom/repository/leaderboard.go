@@ -1,11 +1,17 @@
 package repository
 
 import (
+	"chatroom/logger"
 	"chatroom/models"
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
+
+	"go.uber.org/zap"
 )
 
 // LeaderboardRepository 排行榜資料存取介面
@@ -15,98 +21,164 @@ type LeaderboardRepository interface {
 	Add(score models.GameScore) error
 	GetTop(n int) ([]models.GameScore, error)
 	GetAll() []models.GameScore
+	// GetRank 玩家最佳成績的名次（從 1 開始），沒有成績時第三個回傳值為 false
+	GetRank(userID string) (int, models.GameScore, bool)
+	// GetAround 玩家前後各 n 名的成績，以及第一筆的名次；沒有成績時為空
+	GetAround(userID string, n int) ([]models.GameScore, int)
 	Clear() error
+	Ping() error
 }
 
-// FileLeaderboardRepository 檔案型排行榜儲存
+// FileLeaderboardRepository 檔案型排行榜儲存，保留每位玩家的最佳成績，GetTop 只顯示前 maxSize 名
 type FileLeaderboardRepository struct {
 	mu       sync.RWMutex
 	filePath string
+	maxSize  int
+	less     Less
+	backups  int // 保留的備份數（leaderboard.json.1 為最新）
 	scores   []models.GameScore
 }
 
+// DefaultLeaderboardSize 排行榜預設顯示的名次數
+const DefaultLeaderboardSize = 10
+
+// DefaultLeaderboardBackups 排行榜預設保留的備份數
+const DefaultLeaderboardBackups = 3
+
 // NewFileLeaderboardRepository 創建新的檔案型排行榜儲存
 func NewFileLeaderboardRepository(filePath string) *FileLeaderboardRepository {
+	return NewFileLeaderboardRepositoryWithSize(filePath, DefaultLeaderboardSize)
+}
+
+// NewFileLeaderboardRepositoryWithSize 創建顯示指定名次數的檔案型排行榜儲存
+func NewFileLeaderboardRepositoryWithSize(filePath string, maxSize int) *FileLeaderboardRepository {
+	// 載入失敗時已記錄錯誤，排行榜從空白開始
+	repo, _ := OpenFileLeaderboardRepository(filePath, maxSize, DefaultLeaderboardBackups)
+	return repo
+}
+
+// OpenFileLeaderboardRepository 創建檔案型排行榜儲存並載入現有資料；
+// 檔案損毀且沒有可用的備份時回傳錯誤（仍會回傳空白的排行榜）
+func OpenFileLeaderboardRepository(filePath string, maxSize, backups int) (*FileLeaderboardRepository, error) {
+	return openFileLeaderboard(filePath, maxSize, backups, ByTriesThenTime)
+}
+
+// openFileLeaderboard 創建使用指定排序方式的檔案型排行榜儲存並載入現有資料
+func openFileLeaderboard(filePath string, maxSize, backups int, less Less) (*FileLeaderboardRepository, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultLeaderboardSize
+	}
+	if backups < 0 {
+		backups = 0
+	}
 	repo := &FileLeaderboardRepository{
 		filePath: filePath,
+		maxSize:  maxSize,
+		less:     less,
+		backups:  backups,
 		scores:   make([]models.GameScore, 0),
 	}
 
-	// 嘗試載入現有資料
-	repo.Load()
-
-	return repo
+	_, err := repo.Load()
+	return repo, err
 }
 
-// Load 從檔案載入排行榜
+// Load 從檔案載入排行榜；檔案損毀時改用最新的有效備份，並將損毀的檔案改名保留
 func (r *FileLeaderboardRepository) Load() ([]models.GameScore, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	file, err := os.ReadFile(r.filePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// 檔案不存在，返回空列表
-			r.scores = make([]models.GameScore, 0)
-			return r.scores, nil
+	scores, err := readScores(r.filePath)
+	if err == nil {
+		r.scores = scores
+		return r.scores, nil
+	}
+	if os.IsNotExist(err) {
+		// 檔案不存在，返回空列表
+		r.scores = make([]models.GameScore, 0)
+		return r.scores, nil
+	}
+
+	logger.Error("Leaderboard file is unreadable, trying backups",
+		zap.String("file", r.filePath),
+		zap.Error(err))
+
+	for i := 1; i <= r.backups; i++ {
+		backup := backupPath(r.filePath, i)
+		scores, backupErr := readScores(backup)
+		if backupErr != nil {
+			if !os.IsNotExist(backupErr) {
+				logger.Error("Leaderboard backup is unreadable",
+					zap.String("backup", backup),
+					zap.Error(backupErr))
+			}
+			continue
 		}
-		return nil, err
+
+		r.restoreLocked(scores, backup)
+		return r.scores, nil
 	}
 
-	err = json.Unmarshal(file, &r.scores)
+	logger.Error("Leaderboard could not be recovered from any backup, starting empty until the file is fixed or removed",
+		zap.String("file", r.filePath),
+		zap.Int("backups", r.backups))
+	r.scores = make([]models.GameScore, 0)
+	return nil, fmt.Errorf("leaderboard %s is corrupt and no valid backup was found: %w", r.filePath, err)
+}
+
+// restoreLocked 以備份的內容取代損毀的檔案（呼叫端需持有寫鎖）
+func (r *FileLeaderboardRepository) restoreLocked(scores []models.GameScore, backup string) {
+	r.scores = scores
+
+	corrupt, err := preserveCorrupt(r.filePath)
 	if err != nil {
-		r.scores = make([]models.GameScore, 0)
-		return nil, err
+		logger.Error("Failed to preserve corrupt leaderboard", zap.String("file", r.filePath), zap.Error(err))
+	}
+	if err := r.writeLocked(0); err != nil {
+		logger.Error("Failed to rewrite leaderboard from backup", zap.String("file", r.filePath), zap.Error(err))
 	}
 
-	return r.scores, nil
+	logger.Error("Leaderboard recovered from backup",
+		zap.String("file", r.filePath),
+		zap.String("backup", backup),
+		zap.String("corrupt_copy", corrupt),
+		zap.Int("scores", len(scores)))
 }
 
-// Save 儲存排行榜到檔案
+// Save 儲存排行榜到檔案（寫入暫存檔後取代原檔，並輪替備份）
 func (r *FileLeaderboardRepository) Save(scores []models.GameScore) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	r.scores = scores
+	return r.writeLocked(r.backups)
+}
 
+// writeLocked 將目前的排行榜寫入檔案（呼叫端需持有寫鎖）
+func (r *FileLeaderboardRepository) writeLocked(backups int) error {
 	file, err := json.MarshalIndent(r.scores, "", "  ")
 	if err != nil {
 		return err
 	}
-
-	return os.WriteFile(r.filePath, file, 0644)
+	return writeFileAtomic(r.filePath, file, 0644, backups)
 }
 
-// Add 新增分數並排序
+// Add 新增分數並排序；同一位玩家只保留最佳成績。
+// 更新與寫入檔案在同一個臨界區內完成，並行新增時檔案不會寫入較舊的內容
 func (r *FileLeaderboardRepository) Add(score models.GameScore) error {
 	r.mu.Lock()
-	r.scores = append(r.scores, score)
-
-	// 排序：嘗試次數少的優先，次數相同則時間短的優先
-	sort.Slice(r.scores, func(i, j int) bool {
-		if r.scores[i].Tries != r.scores[j].Tries {
-			return r.scores[i].Tries < r.scores[j].Tries
-		}
-		return r.scores[i].Time < r.scores[j].Time
-	})
-
-	// 只保留前 10 名
-	if len(r.scores) > 10 {
-		r.scores = r.scores[:10]
-	}
-	r.mu.Unlock()
+	defer r.mu.Unlock()
 
-	return r.Save(r.scores)
+	r.scores = rankScores(keepBest(r.scores, score, r.less), r.less)
+	return r.writeLocked(r.backups)
 }
 
-// GetTop 獲取前 N 名
+// GetTop 獲取前 N 名（最多 maxSize 名）
 func (r *FileLeaderboardRepository) GetTop(n int) ([]models.GameScore, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	if n > len(r.scores) {
-		n = len(r.scores)
-	}
+	n = min(n, r.maxSize, len(r.scores))
 
 	result := make([]models.GameScore, n)
 	copy(result, r.scores[:n])
@@ -119,7 +191,7 @@ func (r *FileLeaderboardRepository) Clear() error {
 	return r.Save(make([]models.GameScore, 0))
 }
 
-// GetAll 獲取所有分數
+// GetAll 獲取所有分數（每位玩家的最佳成績，依名次排序）
 func (r *FileLeaderboardRepository) GetAll() []models.GameScore {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -128,3 +200,198 @@ func (r *FileLeaderboardRepository) GetAll() []models.GameScore {
 	copy(result, r.scores)
 	return result
 }
+
+// GetRank 玩家最佳成績的名次
+func (r *FileLeaderboardRepository) GetRank(userID string) (int, models.GameScore, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return rankOf(r.scores, userID)
+}
+
+// GetAround 玩家前後各 n 名的成績
+func (r *FileLeaderboardRepository) GetAround(userID string, n int) ([]models.GameScore, int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return scoresAround(r.scores, userID, n)
+}
+
+// Ping 檢查排行榜檔案是否可讀取（檔案尚未建立視為正常）
+func (r *FileLeaderboardRepository) Ping() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	file, err := os.Open(r.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return file.Close()
+}
+
+// Less 排行榜的排序方式，a 排在 b 前面時回傳 true
+type Less func(a, b models.GameScore) bool
+
+// ByTriesThenTime 嘗試次數少的優先，次數相同則時間短的優先（猜數字）
+func ByTriesThenTime(a, b models.GameScore) bool {
+	if a.Tries != b.Tries {
+		return a.Tries < b.Tries
+	}
+	return a.Time < b.Time
+}
+
+// ByScoreThenTime 得分高的優先，得分相同則時間短的優先（你畫我猜、搶答）
+func ByScoreThenTime(a, b models.GameScore) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.Time < b.Time
+}
+
+// rankScores 依 less 排序；less 為 nil 時使用 ByTriesThenTime
+func rankScores(scores []models.GameScore, less Less) []models.GameScore {
+	if less == nil {
+		less = ByTriesThenTime
+	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return less(scores[i], scores[j])
+	})
+	return scores
+}
+
+// keepBest 加入成績；玩家已有紀錄時只在新成績較好時取代
+func keepBest(scores []models.GameScore, score models.GameScore, less Less) []models.GameScore {
+	if less == nil {
+		less = ByTriesThenTime
+	}
+	if i, best, ok := findPlayer(scores, score); ok {
+		if less(score, best) {
+			scores[i] = score
+		}
+		return scores
+	}
+	return append(scores, score)
+}
+
+// findPlayer 找出與 score 同一位玩家的紀錄
+func findPlayer(scores []models.GameScore, score models.GameScore) (int, models.GameScore, bool) {
+	for i := range scores {
+		if playerKey(scores[i]) == playerKey(score) {
+			return i, scores[i], true
+		}
+	}
+	return 0, models.GameScore{}, false
+}
+
+// playerKey 識別玩家：有使用者 ID 時使用 ID，否則使用暱稱
+func playerKey(score models.GameScore) string {
+	if score.UserID != "" {
+		return "id:" + score.UserID
+	}
+	return "nick:" + score.Nickname
+}
+
+// rankOf 在排序後的成績中找出玩家的名次（從 1 開始）
+func rankOf(scores []models.GameScore, userID string) (int, models.GameScore, bool) {
+	if userID == "" {
+		return 0, models.GameScore{}, false
+	}
+	for i, score := range scores {
+		if score.UserID == userID {
+			return i + 1, score, true
+		}
+	}
+	return 0, models.GameScore{}, false
+}
+
+// scoresAround 玩家前後各 n 名的成績，以及第一筆的名次
+func scoresAround(scores []models.GameScore, userID string, n int) ([]models.GameScore, int) {
+	rank, _, ok := rankOf(scores, userID)
+	if !ok {
+		return []models.GameScore{}, 0
+	}
+	from := max(rank-1-n, 0)
+	to := min(rank+n, len(scores))
+
+	result := make([]models.GameScore, to-from)
+	copy(result, scores[from:to])
+	return result, from + 1
+}
+
+// readScores 讀取並解析排行榜檔案
+func readScores(path string) ([]models.GameScore, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scores := make([]models.GameScore, 0)
+	if err := json.Unmarshal(file, &scores); err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
+
+// FileLeaderboardStore 檔案型的多排行榜儲存，每個排行榜一個 JSON 檔案
+type FileLeaderboardStore struct {
+	dir     string
+	backups int
+}
+
+// NewFileLeaderboardStore 創建將排行榜存放在 dir 的儲存，每個排行榜保留 backups 份備份
+func NewFileLeaderboardStore(dir string, backups int) *FileLeaderboardStore {
+	return &FileLeaderboardStore{dir: dir, backups: backups}
+}
+
+// Open 開啟（或建立）排行榜；檔案損毀且無法從備份復原時回傳錯誤
+func (s *FileLeaderboardStore) Open(id string, size int, less Less) (LeaderboardRepository, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+	repo, err := openFileLeaderboard(s.path(id), size, s.backups, less)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// List 列出目錄中所有排行榜 ID（目錄不存在時為空）
+func (s *FileLeaderboardStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, ".json"))
+	}
+	return ids, nil
+}
+
+// Drop 刪除排行榜檔案與備份
+func (s *FileLeaderboardStore) Drop(id string) error {
+	path := s.path(id)
+	backups, err := filepath.Glob(path + ".[0-9]*")
+	if err != nil {
+		return err
+	}
+	for _, file := range append([]string{path}, backups...) {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// path 排行榜檔案路徑
+func (s *FileLeaderboardStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
@@ -3,13 +3,15 @@ package repository
 import (
 	"chatroom/models"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 )
 
 func TestFileLeaderboardRepository(t *testing.T) {
 	// 使用臨時檔案
-	tmpFile := "test_leaderboard.json"
-	defer os.Remove(tmpFile)
+	tmpFile := filepath.Join(t.TempDir(), "test_leaderboard.json")
 
 	repo := NewFileLeaderboardRepository(tmpFile)
 
@@ -67,9 +69,29 @@ func TestFileLeaderboardRepository(t *testing.T) {
 	})
 }
 
+func TestFileLeaderboardConcurrentAdd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leaderboard.json")
+	repo := NewFileLeaderboardRepository(path)
+
+	// 並行新增時檔案內容必須包含每一筆成績，不會被較舊的內容覆蓋
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			repo.Add(models.GameScore{UserID: "u" + strconv.Itoa(i), Nickname: "Player", Tries: i + 1})
+		}(i)
+	}
+	wg.Wait()
+
+	reopened := NewFileLeaderboardRepository(path)
+	if scores := reopened.GetAll(); len(scores) != 20 {
+		t.Errorf("Expected 20 scores in the file, got %d", len(scores))
+	}
+}
+
 func TestLeaderboardSorting(t *testing.T) {
-	tmpFile := "test_sort.json"
-	defer os.Remove(tmpFile)
+	tmpFile := filepath.Join(t.TempDir(), "test_sort.json")
 
 	repo := NewFileLeaderboardRepository(tmpFile)
 
@@ -85,8 +107,7 @@ func TestLeaderboardSorting(t *testing.T) {
 }
 
 func TestMaxLeaderboardSize(t *testing.T) {
-	tmpFile := "test_max.json"
-	defer os.Remove(tmpFile)
+	tmpFile := filepath.Join(t.TempDir(), "test_max.json")
 
 	repo := NewFileLeaderboardRepository(tmpFile)
 
@@ -99,8 +120,118 @@ func TestMaxLeaderboardSize(t *testing.T) {
 		})
 	}
 
-	all := repo.GetAll()
-	if len(all) != 10 {
-		t.Errorf("Expected max 10 scores, got %d", len(all))
+	top, _ := repo.GetTop(15)
+	if len(top) != 10 {
+		t.Errorf("Expected max 10 scores, got %d", len(top))
+	}
+	// 名次以外的玩家成績仍然保留
+	if all := repo.GetAll(); len(all) != 15 {
+		t.Errorf("Expected every player's best to be kept, got %d", len(all))
+	}
+}
+
+func TestLeaderboardBackupRecovery(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "leaderboard.json")
+
+	repo, err := OpenFileLeaderboardRepository(path, 10, 2)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := repo.Add(models.GameScore{Nickname: "P" + strconv.Itoa(i), Tries: i, Time: i}); err != nil {
+			t.Fatalf("add: %v", err)
+		}
 	}
+
+	t.Run("Rotation", func(t *testing.T) {
+		// 三次寫入：目前檔案 3 筆，.1 為 2 筆，.2 為 1 筆，不會產生 .3
+		for i, want := range map[int]int{1: 2, 2: 1} {
+			scores, err := readScores(backupPath(path, i))
+			if err != nil || len(scores) != want {
+				t.Errorf("backup %d: expected %d scores, got %d (%v)", i, want, len(scores), err)
+			}
+		}
+		if _, err := os.Stat(backupPath(path, 3)); !os.IsNotExist(err) {
+			t.Errorf("Expected only 2 backups, stat .3: %v", err)
+		}
+		if matches, _ := filepath.Glob(filepath.Join(dir, ".leaderboard.json.tmp-*")); len(matches) != 0 {
+			t.Errorf("Temp files left behind: %v", matches)
+		}
+	})
+
+	t.Run("Recover from newest valid backup", func(t *testing.T) {
+		os.WriteFile(path, []byte("{broken"), 0644)
+		os.WriteFile(backupPath(path, 1), []byte("[trunc"), 0644)
+
+		recovered, err := OpenFileLeaderboardRepository(path, 10, 2)
+		if err != nil {
+			t.Fatalf("Expected recovery from backup, got %v", err)
+		}
+		if n := len(recovered.GetAll()); n != 1 {
+			t.Errorf("Expected 1 score from backup .2, got %d", n)
+		}
+		if scores, err := readScores(path); err != nil || len(scores) != 1 {
+			t.Errorf("Expected leaderboard rewritten from backup, got %d scores (%v)", len(scores), err)
+		}
+		if matches, _ := filepath.Glob(path + ".corrupt-*"); len(matches) != 1 {
+			t.Errorf("Expected the corrupt file to be preserved, got %v", matches)
+		}
+	})
+
+	t.Run("Unrecoverable", func(t *testing.T) {
+		os.WriteFile(path, []byte("{broken"), 0644)
+		os.Remove(backupPath(path, 1))
+		os.Remove(backupPath(path, 2))
+
+		repo, err := OpenFileLeaderboardRepository(path, 10, 2)
+		if err == nil {
+			t.Fatal("Expected an error when no backup is valid")
+		}
+		if n := len(repo.GetAll()); n != 0 {
+			t.Errorf("Expected empty leaderboard, got %d scores", n)
+		}
+		if data, _ := os.ReadFile(path); string(data) != "{broken" {
+			t.Errorf("Corrupt file should be left in place, got %q", data)
+		}
+	})
+}
+
+func TestPersonalBestAndRank(t *testing.T) {
+	repo := NewFileLeaderboardRepositoryWithSize(filepath.Join(t.TempDir(), "leaderboard.json"), 2)
+	for i := 1; i <= 5; i++ {
+		repo.Add(models.GameScore{UserID: "u" + strconv.Itoa(i), Nickname: "P" + strconv.Itoa(i), Tries: i * 2})
+	}
+
+	t.Run("Keep only the best per player", func(t *testing.T) {
+		repo.Add(models.GameScore{UserID: "u5", Nickname: "P5", Tries: 20}) // 比原本差，忽略
+		repo.Add(models.GameScore{UserID: "u4", Nickname: "P4", Tries: 3})  // 8 次進步到 3 次
+
+		rank, best, ok := repo.GetRank("u4")
+		if !ok || rank != 2 || best.Tries != 3 {
+			t.Errorf("Expected u4 at rank 2 with 3 tries, got rank=%d best=%+v ok=%v", rank, best, ok)
+		}
+		if rank, best, _ := repo.GetRank("u5"); rank != 5 || best.Tries != 10 {
+			t.Errorf("Expected u5 to keep 10 tries at rank 5, got rank=%d best=%+v", rank, best)
+		}
+		if len(repo.GetAll()) != 5 {
+			t.Errorf("Expected one entry per player, got %d", len(repo.GetAll()))
+		}
+	})
+
+	t.Run("Around", func(t *testing.T) {
+		around, from := repo.GetAround("u5", 1)
+		if from != 4 || len(around) != 2 || around[1].UserID != "u5" {
+			t.Errorf("Expected ranks 4-5 ending with u5, got from=%d %+v", from, around)
+		}
+		if around, from := repo.GetAround("u1", 1); from != 1 || len(around) != 2 {
+			t.Errorf("Expected ranks 1-2, got from=%d %+v", from, around)
+		}
+		if around, from := repo.GetAround("nobody", 1); from != 0 || len(around) != 0 {
+			t.Errorf("Expected no rank for an unknown player, got from=%d %+v", from, around)
+		}
+		if _, _, ok := repo.GetRank(""); ok {
+			t.Error("Players without a user ID have no rank")
+		}
+	})
 }
@@ -0,0 +1,470 @@
+package repository
+
+import (
+	"chatroom/logger"
+	"chatroom/models"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Period 排行榜的時間區間；daily 與 weekly 在區間結束後自動換成新的排行榜
+type Period string
+
+// 排行榜區間
+const (
+	PeriodAllTime Period = "all_time"
+	PeriodDaily   Period = "daily"
+	PeriodWeekly  Period = "weekly"
+)
+
+// Periods 所有區間
+var Periods = []Period{PeriodAllTime, PeriodDaily, PeriodWeekly}
+
+// ErrUnknownBoard 沒有這個名稱的排行榜
+var ErrUnknownBoard = errors.New("unknown leaderboard")
+
+// ErrUnknownPeriod 不支援的排行榜區間
+var ErrUnknownPeriod = errors.New("unknown leaderboard period")
+
+// ParsePeriod 解析區間名稱，空白表示 all_time
+func ParsePeriod(name string) (Period, error) {
+	if name == "" {
+		return PeriodAllTime, nil
+	}
+	for _, p := range Periods {
+		if string(p) == name {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownPeriod, name)
+}
+
+// Key 時間 t 所在區間的識別碼：daily 為 2006-01-02，weekly 為 ISO 週（2006-W01），all_time 為空白
+func (p Period) Key(t time.Time) string {
+	switch p {
+	case PeriodDaily:
+		return t.Format("2006-01-02")
+	case PeriodWeekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return ""
+}
+
+// 內建的排行榜名稱
+const (
+	BoardGuessNumber = "guess_number"
+	BoardDrawGuess   = "draw_guess"
+	BoardQuiz        = "quiz"
+)
+
+// 排行榜主要的成績欄位
+const (
+	MetricTries = "tries" // 嘗試次數，越少越好
+	MetricScore = "score" // 得分，越高越好
+)
+
+// Board 一個排行榜的定義
+type Board struct {
+	Name   string
+	Title  string // 顯示名稱
+	Size   int    // 顯示的名次數
+	Less   Less
+	Metric string // 主要的成績欄位：MetricTries 或 MetricScore
+	// Accumulate 同一位玩家的成績累加為一筆（得分、時間相加），否則每次成績各佔一筆
+	Accumulate bool
+	// PerRoom 另外為每個房間保留一份排行榜
+	PerRoom bool
+}
+
+// DefaultBoards 內建的排行榜，每個顯示前 size 名
+func DefaultBoards(size int) []Board {
+	if size <= 0 {
+		size = DefaultLeaderboardSize
+	}
+	return []Board{
+		{Name: BoardGuessNumber, Title: "猜數字", Size: size, Less: ByTriesThenTime, Metric: MetricTries},
+		{Name: BoardDrawGuess, Title: "你畫我猜", Size: size, Less: ByScoreThenTime, Metric: MetricScore, Accumulate: true},
+		{Name: BoardQuiz, Title: "搶答", Size: size, Less: ByScoreThenTime, Metric: MetricScore, Accumulate: true, PerRoom: true},
+	}
+}
+
+// LeaderboardStore 依 ID 保存多個排行榜
+type LeaderboardStore interface {
+	// Open 開啟（或建立）排行榜，顯示前 size 名
+	Open(id string, size int, less Less) (LeaderboardRepository, error)
+	// List 列出所有已保存的排行榜 ID
+	List() ([]string, error)
+	// Drop 刪除排行榜
+	Drop(id string) error
+}
+
+// Scope 指定一份排行榜：名稱、區間與房間（空白表示全站）
+type Scope struct {
+	Board  string
+	Period Period
+	Room   string
+}
+
+// id 排行榜在儲存中的 ID，例如 quiz.daily.2026-01-02@Lobby
+func (s Scope) id(key string) string {
+	id := s.Board + "." + string(s.Period)
+	if key != "" {
+		id += "." + key
+	}
+	if s.Room != "" {
+		id += "@" + url.QueryEscape(s.Room)
+	}
+	return id
+}
+
+// parseID 解析排行榜 ID，回傳範圍與區間識別碼
+func parseID(id string) (Scope, string, bool) {
+	head, room, _ := strings.Cut(id, "@")
+	parts := strings.Split(head, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Scope{}, "", false
+	}
+	scope := Scope{Board: parts[0], Period: Period(parts[1])}
+	if room != "" {
+		unescaped, err := url.QueryUnescape(room)
+		if err != nil {
+			return Scope{}, "", false
+		}
+		scope.Room = unescaped
+	}
+	key := ""
+	if len(parts) == 3 {
+		key = parts[2]
+	}
+	return scope, key, true
+}
+
+// Leaderboards 管理所有排行榜。猜數字的全站總榜沿用原本的排行榜儲存，
+// 其餘（其他遊戲、每日、每週、各房間）放在 LeaderboardStore
+type Leaderboards struct {
+	mu      sync.Mutex
+	boards  []Board
+	primary LeaderboardRepository
+	store   LeaderboardStore
+	now     func() time.Time
+
+	open    map[string]LeaderboardRepository // ID -> 已開啟的排行榜
+	current map[Scope]string                 // 範圍 -> 目前區間的 ID，區間改變時刪除舊的排行榜
+}
+
+// NewLeaderboards 創建排行榜管理；store 為 nil 時只保存在記憶體
+func NewLeaderboards(boards []Board, primary LeaderboardRepository, store LeaderboardStore) *Leaderboards {
+	if store == nil {
+		store = NewMemoryLeaderboardStore()
+	}
+	return &Leaderboards{
+		boards:  boards,
+		primary: primary,
+		store:   store,
+		now:     time.Now,
+		open:    make(map[string]LeaderboardRepository),
+		current: make(map[Scope]string),
+	}
+}
+
+// Boards 所有排行榜的定義
+func (l *Leaderboards) Boards() []Board {
+	return append([]Board(nil), l.boards...)
+}
+
+// Board 依名稱取得排行榜定義
+func (l *Leaderboards) Board(name string) (Board, bool) {
+	for _, b := range l.boards {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return Board{}, false
+}
+
+// Normalize 檢查排行榜名稱與區間；沒有分房間的排行榜忽略房間
+func (l *Leaderboards) Normalize(scope Scope) (Scope, Board, error) {
+	board, ok := l.Board(scope.Board)
+	if !ok {
+		return scope, board, fmt.Errorf("%w %q", ErrUnknownBoard, scope.Board)
+	}
+	period, err := ParsePeriod(string(scope.Period))
+	if err != nil {
+		return scope, board, err
+	}
+	scope.Period = period
+	if !board.PerRoom {
+		scope.Room = ""
+	}
+	return scope, board, nil
+}
+
+// Get 取得目前區間的排行榜
+func (l *Leaderboards) Get(scope Scope) (LeaderboardRepository, error) {
+	scope, board, err := l.Normalize(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.repoLocked(scope, board)
+}
+
+// Top 目前區間排行榜的前幾名
+func (l *Leaderboards) Top(scope Scope) ([]models.GameScore, error) {
+	scope, board, err := l.Normalize(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	repo, err := l.repoLocked(scope, board)
+	if err != nil {
+		return nil, err
+	}
+	return repo.GetTop(board.Size)
+}
+
+// Record 將成績寫入遊戲的每個區間，分房間的排行榜同時寫入該房間的排行榜
+func (l *Leaderboards) Record(boardName, room string, score models.GameScore) error {
+	board, ok := l.Board(boardName)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownBoard, boardName)
+	}
+
+	scopes := make([]Scope, 0, 2*len(Periods))
+	for _, period := range Periods {
+		scopes = append(scopes, Scope{Board: board.Name, Period: period})
+		if board.PerRoom && room != "" {
+			scopes = append(scopes, Scope{Board: board.Name, Period: period, Room: room})
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var errs []error
+	for _, scope := range scopes {
+		repo, err := l.repoLocked(scope, board)
+		if err == nil {
+			if board.Accumulate {
+				err = repo.Save(rankScores(accumulate(repo.GetAll(), score), board.Less))
+			} else {
+				err = repo.Add(score)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", scope.id(scope.Period.Key(l.now())), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush 將所有已開啟的排行榜寫回儲存
+func (l *Leaderboards) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var errs []error
+	if l.primary != nil {
+		if err := l.primary.Save(l.primary.GetAll()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for id, repo := range l.open {
+		if err := repo.Save(repo.GetAll()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Prune 刪除已經結束的區間留下的排行榜（例如重新啟動前的每日排行榜），回傳刪除的數量
+func (l *Leaderboards) Prune() (int, error) {
+	ids, err := l.store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	dropped := 0
+	for _, id := range ids {
+		scope, key, ok := parseID(id)
+		if !ok || key == "" || key == scope.Period.Key(now) {
+			continue
+		}
+		if err := l.dropLocked(id); err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+	return dropped, nil
+}
+
+// repoLocked 開啟範圍目前區間的排行榜；區間已經改變時刪除上一個區間（呼叫端需持有鎖）
+func (l *Leaderboards) repoLocked(scope Scope, board Board) (LeaderboardRepository, error) {
+	if scope.Board == BoardGuessNumber && scope.Period == PeriodAllTime && scope.Room == "" && l.primary != nil {
+		return l.primary, nil
+	}
+
+	id := scope.id(scope.Period.Key(l.now()))
+	if previous, ok := l.current[scope]; ok && previous != id {
+		if err := l.dropLocked(previous); err != nil {
+			logger.Error("Failed to drop expired leaderboard", zap.String("id", previous), zap.Error(err))
+		}
+		logger.Info("Leaderboard rolled over", zap.String("from", previous), zap.String("to", id))
+	}
+	l.current[scope] = id
+
+	if repo, ok := l.open[id]; ok {
+		return repo, nil
+	}
+	repo, err := l.store.Open(id, board.Size, board.Less)
+	if err != nil {
+		return nil, err
+	}
+	l.open[id] = repo
+	return repo, nil
+}
+
+// dropLocked 刪除排行榜（呼叫端需持有鎖）
+func (l *Leaderboards) dropLocked(id string) error {
+	delete(l.open, id)
+	return l.store.Drop(id)
+}
+
+// accumulate 將成績累加到同一位玩家原有的紀錄上，暱稱與頭像更新為最新的
+func accumulate(scores []models.GameScore, score models.GameScore) []models.GameScore {
+	for i := range scores {
+		if playerKey(scores[i]) == playerKey(score) {
+			scores[i].Nickname = score.Nickname
+			scores[i].Avatar = score.Avatar
+			scores[i].Score += score.Score
+			scores[i].Tries += score.Tries
+			scores[i].Time += score.Time
+			return scores
+		}
+	}
+	return append(scores, score)
+}
+
+// MemoryLeaderboardStore 只保存在記憶體的排行榜
+type MemoryLeaderboardStore struct {
+	mu     sync.Mutex
+	boards map[string]*memoryLeaderboard
+}
+
+// NewMemoryLeaderboardStore 創建記憶體排行榜儲存
+func NewMemoryLeaderboardStore() *MemoryLeaderboardStore {
+	return &MemoryLeaderboardStore{boards: make(map[string]*memoryLeaderboard)}
+}
+
+// Open 開啟（或建立）排行榜
+func (s *MemoryLeaderboardStore) Open(id string, size int, less Less) (LeaderboardRepository, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if board, ok := s.boards[id]; ok {
+		return board, nil
+	}
+	board := &memoryLeaderboard{maxSize: size, less: less}
+	s.boards[id] = board
+	return board, nil
+}
+
+// List 列出所有排行榜 ID
+func (s *MemoryLeaderboardStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.boards))
+	for id := range s.boards {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Drop 刪除排行榜
+func (s *MemoryLeaderboardStore) Drop(id string) error {
+	s.mu.Lock()
+	delete(s.boards, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// memoryLeaderboard 記憶體排行榜
+type memoryLeaderboard struct {
+	mu      sync.RWMutex
+	maxSize int
+	less    Less
+	scores  []models.GameScore
+}
+
+func (r *memoryLeaderboard) Load() ([]models.GameScore, error) {
+	return r.GetAll(), nil
+}
+
+func (r *memoryLeaderboard) Save(scores []models.GameScore) error {
+	r.mu.Lock()
+	r.scores = append([]models.GameScore(nil), scores...)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *memoryLeaderboard) Add(score models.GameScore) error {
+	r.mu.Lock()
+	r.scores = rankScores(keepBest(r.scores, score, r.less), r.less)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *memoryLeaderboard) GetTop(n int) ([]models.GameScore, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n = min(n, r.maxSize, len(r.scores))
+	result := make([]models.GameScore, n)
+	copy(result, r.scores[:n])
+	return result, nil
+}
+
+func (r *memoryLeaderboard) GetAll() []models.GameScore {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]models.GameScore, len(r.scores))
+	copy(result, r.scores)
+	return result
+}
+
+func (r *memoryLeaderboard) GetRank(userID string) (int, models.GameScore, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return rankOf(r.scores, userID)
+}
+
+func (r *memoryLeaderboard) GetAround(userID string, n int) ([]models.GameScore, int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return scoresAround(r.scores, userID, n)
+}
+
+func (r *memoryLeaderboard) Clear() error {
+	return r.Save(make([]models.GameScore, 0))
+}
+
+func (r *memoryLeaderboard) Ping() error {
+	return nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"chatroom/models"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLeaderboardsRecord(t *testing.T) {
+	primary := NewFileLeaderboardRepository(filepath.Join(t.TempDir(), "leaderboard.json"))
+	boards := NewLeaderboards(DefaultBoards(3), primary, nil)
+
+	t.Run("Guess number uses the primary board", func(t *testing.T) {
+		boards.Record(BoardGuessNumber, "_game_", models.GameScore{Nickname: "Slow", Tries: 5, Time: 30})
+		boards.Record(BoardGuessNumber, "_game_", models.GameScore{Nickname: "Fast", Tries: 2, Time: 10})
+
+		if all := primary.GetAll(); len(all) != 2 || all[0].Nickname != "Fast" {
+			t.Errorf("Expected primary board to rank Fast first, got %+v", all)
+		}
+		daily, _ := boards.Top(Scope{Board: BoardGuessNumber, Period: PeriodDaily})
+		if len(daily) != 2 {
+			t.Errorf("Expected 2 daily scores, got %d", len(daily))
+		}
+	})
+
+	t.Run("Accumulate by player", func(t *testing.T) {
+		boards.Record(BoardDrawGuess, "_draw_game_", models.GameScore{UserID: "u1", Nickname: "Amy", Score: 1, Time: 20})
+		boards.Record(BoardDrawGuess, "_draw_game_", models.GameScore{UserID: "u2", Nickname: "Ben", Score: 1, Time: 5})
+		boards.Record(BoardDrawGuess, "_draw_game_", models.GameScore{UserID: "u1", Nickname: "Amy2", Score: 1, Time: 10})
+
+		top, err := boards.Top(Scope{Board: BoardDrawGuess})
+		if err != nil {
+			t.Fatalf("top: %v", err)
+		}
+		if len(top) != 2 || top[0].Nickname != "Amy2" || top[0].Score != 2 || top[0].Time != 30 {
+			t.Errorf("Expected Amy2 first with 2 points, got %+v", top)
+		}
+	})
+
+	t.Run("Per room", func(t *testing.T) {
+		boards.Record(BoardQuiz, "Lobby", models.GameScore{Nickname: "Amy", Score: 1})
+		boards.Record(BoardQuiz, "Other", models.GameScore{Nickname: "Ben", Score: 1})
+
+		if global, _ := boards.Top(Scope{Board: BoardQuiz, Period: PeriodWeekly}); len(global) != 2 {
+			t.Errorf("Expected 2 scores on the global quiz board, got %d", len(global))
+		}
+		room, _ := boards.Top(Scope{Board: BoardQuiz, Room: "Lobby"})
+		if len(room) != 1 || room[0].Nickname != "Amy" {
+			t.Errorf("Expected only Amy on the Lobby board, got %+v", room)
+		}
+	})
+
+	t.Run("Unknown board or period", func(t *testing.T) {
+		if _, err := boards.Top(Scope{Board: "chess"}); !errors.Is(err, ErrUnknownBoard) {
+			t.Errorf("Expected ErrUnknownBoard, got %v", err)
+		}
+		if _, err := boards.Top(Scope{Board: BoardQuiz, Period: "monthly"}); !errors.Is(err, ErrUnknownPeriod) {
+			t.Errorf("Expected ErrUnknownPeriod, got %v", err)
+		}
+	})
+}
+
+func TestLeaderboardsRollover(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "leaderboards")
+	store := NewFileLeaderboardStore(dir, 1)
+	now := time.Date(2026, 1, 4, 23, 0, 0, 0, time.UTC) // 週日，ISO 第 1 週
+
+	boards := NewLeaderboards(DefaultBoards(10), nil, store)
+	boards.now = func() time.Time { return now }
+	boards.Record(BoardQuiz, "Lobby", models.GameScore{Nickname: "Amy", Score: 1})
+
+	ids, _ := store.List()
+	if len(ids) != 6 {
+		t.Fatalf("Expected 3 periods x (global + room) boards, got %v", ids)
+	}
+
+	// 跨日與跨週後讀取：舊的每日、每週排行榜被刪除，總榜保留
+	now = now.Add(2 * time.Hour)
+	if daily, _ := boards.Top(Scope{Board: BoardQuiz, Period: PeriodDaily}); len(daily) != 0 {
+		t.Errorf("Expected a fresh daily board after midnight, got %+v", daily)
+	}
+	if weekly, _ := boards.Top(Scope{Board: BoardQuiz, Period: PeriodWeekly, Room: "Lobby"}); len(weekly) != 0 {
+		t.Errorf("Expected a fresh weekly board on Monday, got %+v", weekly)
+	}
+	if all, _ := boards.Top(Scope{Board: BoardQuiz}); len(all) != 1 {
+		t.Errorf("Expected the all-time board to keep its score, got %+v", all)
+	}
+	for _, id := range []string{"quiz.daily.2026-01-04", "quiz.weekly.2026-W01@Lobby"} {
+		if _, err := readScores(store.path(id)); err == nil {
+			t.Errorf("Expected %s to be dropped", id)
+		}
+	}
+
+	// 重新啟動後清除停機期間結束的區間
+	restarted := NewLeaderboards(DefaultBoards(10), nil, store)
+	restarted.now = func() time.Time { return now.Add(48 * time.Hour) }
+	dropped, err := restarted.Prune()
+	if err != nil || dropped != 2 {
+		t.Errorf("Expected the remaining expired daily and weekly boards to be pruned, got %d (%v)", dropped, err)
+	}
+	if scope, key, ok := parseID(Scope{Board: BoardQuiz, Period: PeriodDaily, Room: "a.b@c"}.id("2026-01-05")); !ok || scope.Room != "a.b@c" || key != "2026-01-05" {
+		t.Errorf("Room names must round-trip through the ID, got %+v %q", scope, key)
+	}
+}
@@ -0,0 +1,11 @@
+package repository
+
+import "chatroom/models"
+
+// ProfileRepository 使用者資料存取介面
+type ProfileRepository interface {
+	// Get 依使用者 ID 取得資料，第二個回傳值表示是否存在
+	Get(userID string) (models.Profile, bool, error)
+	Save(profile models.Profile) error
+	Ping() error
+}
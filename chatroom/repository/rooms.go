@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"chatroom/models"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+)
+
+// RoomRepository 永久房間資料存取介面
+type RoomRepository interface {
+	Load() ([]models.Room, error)
+	Save(room models.Room) error
+	Delete(name string) error
+	GetAll() []models.Room
+	Ping() error
+}
+
+// FileRoomRepository 檔案型永久房間儲存
+type FileRoomRepository struct {
+	mu       sync.RWMutex
+	filePath string
+	rooms    map[string]models.Room
+}
+
+// NewFileRoomRepository 創建新的檔案型房間儲存
+func NewFileRoomRepository(filePath string) *FileRoomRepository {
+	repo := &FileRoomRepository{
+		filePath: filePath,
+		rooms:    make(map[string]models.Room),
+	}
+
+	// 嘗試載入現有資料
+	repo.Load()
+
+	return repo
+}
+
+// Load 從檔案載入所有房間
+func (r *FileRoomRepository) Load() ([]models.Room, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := os.ReadFile(r.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 檔案不存在，返回空列表
+			r.rooms = make(map[string]models.Room)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var rooms []models.Room
+	if err := json.Unmarshal(file, &rooms); err != nil {
+		return nil, err
+	}
+
+	r.rooms = make(map[string]models.Room, len(rooms))
+	for _, room := range rooms {
+		r.rooms[room.Name] = room
+	}
+
+	return r.sorted(), nil
+}
+
+// Save 新增或更新房間並寫入檔案
+func (r *FileRoomRepository) Save(room models.Room) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rooms[room.Name] = room
+	return r.write()
+}
+
+// Delete 刪除房間並寫入檔案
+func (r *FileRoomRepository) Delete(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.rooms[name]; !ok {
+		return nil
+	}
+	delete(r.rooms, name)
+	return r.write()
+}
+
+// GetAll 獲取所有房間（依名稱排序）
+func (r *FileRoomRepository) GetAll() []models.Room {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sorted()
+}
+
+// Ping 檢查房間檔案是否可讀取（檔案尚未建立視為正常）
+func (r *FileRoomRepository) Ping() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	file, err := os.Open(r.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return file.Close()
+}
+
+// sorted 依名稱排序的房間列表（呼叫端需持有鎖）
+func (r *FileRoomRepository) sorted() []models.Room {
+	rooms := make([]models.Room, 0, len(r.rooms))
+	for _, room := range r.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].Name < rooms[j].Name
+	})
+	return rooms
+}
+
+// write 將房間寫入檔案（呼叫端需持有寫鎖）
+func (r *FileRoomRepository) write() error {
+	file, err := json.MarshalIndent(r.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.filePath, file, 0644, 0)
+}
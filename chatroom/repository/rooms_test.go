@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"chatroom/models"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileRoomRepository(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "test_rooms.json")
+
+	repo := NewFileRoomRepository(tmpFile)
+
+	room := models.Room{
+		Name:       "團隊頻道",
+		Owner:      "OWNR0001",
+		Persistent: true,
+		RoomSettings: models.RoomSettings{
+			Topic:      "每日站會",
+			Icon:       "🚀",
+			MaxMembers: 20,
+			InviteOnly: true,
+		},
+		Invited: map[string]bool{"BOBB0001": true},
+	}
+	if err := repo.Save(room); err != nil {
+		t.Fatalf("Failed to save room: %v", err)
+	}
+	if err := repo.Save(models.Room{Name: "公告", Owner: "OWNR0001", Persistent: true}); err != nil {
+		t.Fatalf("Failed to save room: %v", err)
+	}
+
+	// 重新載入
+	reloaded := NewFileRoomRepository(tmpFile).GetAll()
+	if len(reloaded) != 2 {
+		t.Fatalf("Expected 2 rooms after reload, got %d", len(reloaded))
+	}
+	if reloaded[1].Name != "團隊頻道" || reloaded[1].Topic != "每日站會" || !reloaded[1].InviteOnly {
+		t.Errorf("Room settings not persisted: %+v", reloaded[1])
+	}
+	if !reloaded[1].Invited["BOBB0001"] {
+		t.Error("Invited members not persisted")
+	}
+
+	if err := repo.Delete("公告"); err != nil {
+		t.Fatalf("Failed to delete room: %v", err)
+	}
+	if rooms := NewFileRoomRepository(tmpFile).GetAll(); len(rooms) != 1 {
+		t.Errorf("Expected 1 room after delete, got %d", len(rooms))
+	}
+}
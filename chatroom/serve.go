@@ -0,0 +1,272 @@
+package main
+
+import (
+	"chatroom/health"
+	"chatroom/logger"
+	"chatroom/metrics"
+	"chatroom/models"
+	"chatroom/pool"
+	"chatroom/ratelimit"
+	"chatroom/repository"
+	"chatroom/service"
+	"chatroom/transport"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// runServe 啟動聊天室伺服器，直到收到 SIGINT 或 SIGTERM
+func runServe(args []string, stdout, stderr io.Writer) int {
+	flags := newFlagSet("serve", "[flags]", "啟動聊天室伺服器", stderr)
+	loader := newConfigLoader(flags)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage(err)
+	}
+
+	// 1. 初始化日誌系統
+	if err := logger.InitDefault(); err != nil {
+		fmt.Fprintf(stderr, "Failed to initialize logger: %v\n", err)
+		return exitFailure
+	}
+	defer logger.Sync()
+
+	logger.Info("Starting chatroom server...")
+
+	// 2. 載入配置（預設值 < 設定檔 < 環境變數 < 命令列參數）
+	cfg, err := loader.Load()
+	if err != nil {
+		logger.Error("Invalid configuration", zap.Error(err))
+		return exitFailure
+	}
+	if err := logger.SetLevel(cfg.Log.Level); err != nil {
+		logger.Warn("Invalid log level", zap.Error(err))
+	}
+	logger.Info("Configuration loaded",
+		zap.String("config_file", loader.ConfigPath()),
+		zap.String("addr", cfg.Server.ListenAddr()),
+		zap.String("data_dir", cfg.Storage.DataDir),
+		zap.String("static_dir", cfg.Server.StaticDir),
+		zap.Bool("rate_limit", cfg.RateLimit.Enabled))
+
+	// 3. 初始化 Repository
+	if cfg.Storage.DataDir != "" {
+		if err := os.MkdirAll(cfg.Storage.DataDir, 0755); err != nil {
+			logger.Error("Failed to create data directory", zap.Error(err))
+			return exitFailure
+		}
+	}
+	store, err := openStorage(cfg)
+	if err != nil {
+		logger.Error("Failed to open storage", zap.Error(err))
+		return exitFailure
+	}
+	logger.Info("Repository initialized", zap.String("backend", cfg.Storage.Backend))
+
+	// 4. 初始化 Worker Pool
+	workerPool := pool.NewWorkerPool(cfg.Pool.Workers, cfg.Pool.QueueSize)
+	workerPool.Start()
+	logger.Info("Worker pool started",
+		zap.Int("workers", cfg.Pool.Workers),
+		zap.Int("queue_size", cfg.Pool.QueueSize))
+
+	// 5. 初始化 Rate Limiter
+	rateLimiter := ratelimit.NewMessageLimiter(cfg.RateLimit)
+	logger.Info("Rate limiter initialized")
+
+	// 6. 初始化 Metrics
+	appMetrics := metrics.GetMetrics()
+	logger.Info("Metrics initialized")
+
+	// 7. 建立訊息通道
+	broadcastChan := make(chan models.Message, 100)
+
+	// 8. 初始化 Service
+	stateService := service.NewStateServiceWithDeps(
+		broadcastChan,
+		store.leaderboard,
+		workerPool,
+		rateLimiter,
+		appMetrics,
+		cfg,
+	)
+	if err := stateService.SetLeaderboardStore(store.boards); err != nil {
+		logger.Error("Failed to prune expired leaderboards", zap.Error(err))
+	}
+	if err := stateService.SetRoomRepository(store.rooms); err != nil {
+		logger.Error("Failed to load persistent rooms", zap.Error(err))
+	}
+	if store.history != nil {
+		if err := stateService.SetHistoryRepository(store.history); err != nil {
+			logger.Error("Failed to load chat history", zap.Error(err))
+		}
+	}
+	if store.profiles != nil {
+		stateService.SetProfileRepository(store.profiles)
+	}
+	blobs, err := repository.NewLocalBlobStore(cfg.Storage.Path(cfg.Storage.MediaDir), transport.MediaURLPrefix)
+	if err != nil {
+		logger.Error("Failed to open media storage", zap.Error(err))
+		return exitFailure
+	}
+	stateService.SetBlobStore(blobs)
+	logger.Info("State service initialized")
+
+	// 9. 啟動訊息處理循環
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go stateService.HandleMessageLoopWithContext(ctx)
+
+	// 收到 SIGHUP 或設定檔變更時重新載入可即時生效的配置
+	reloader := newConfigReloader(loader, cfg, stateService, workerPool)
+	go reloader.Watch(ctx)
+
+	// 10. 初始化 WebSocket Handler
+	wsHandler := transport.NewWebsocketHandlerWithConfig(stateService, cfg)
+
+	// 11. 設置 HTTP 路由
+	staticFS, embedded := staticFiles(cfg.Server.StaticDir)
+	http.Handle("/", transport.NewStaticHandler(staticFS, embedded))
+	http.HandleFunc("/ws", wsHandler.HandleConnections)
+	http.HandleFunc("GET /invite/{token}", wsHandler.HandleInvite)
+
+	// 圖片與語音上傳，訊息只攜帶回傳的網址
+	mediaHandler := transport.NewMediaHandler(stateService, cfg)
+	http.HandleFunc("POST /upload", mediaHandler.HandleUpload)
+	http.HandleFunc("GET "+transport.MediaURLPrefix+"{key}", mediaHandler.HandleMedia)
+
+	// 新增 metrics endpoint
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		snapshot := appMetrics.GetSnapshot()
+		fmt.Fprintf(w, "Total Connections: %d\n", snapshot.TotalConnections)
+		fmt.Fprintf(w, "Active Connections: %d\n", snapshot.ActiveConnections)
+		fmt.Fprintf(w, "Rejected Connections: %d\n", snapshot.RejectedConnections)
+		fmt.Fprintf(w, "Total Messages: %d\n", snapshot.TotalMessages)
+		fmt.Fprintf(w, "Active Rooms: %d\n", snapshot.ActiveRooms)
+		fmt.Fprintf(w, "Average Latency: %v\n", snapshot.AverageLatency)
+		fmt.Fprintf(w, "Total Errors: %d\n", snapshot.TotalErrors)
+		fmt.Fprintf(w, "Rate Limit Errors: %d\n", snapshot.RateLimitErrors)
+		fmt.Fprintf(w, "Rate Limit Mutes: %d\n", snapshot.RateLimitMutes)
+		fmt.Fprintf(w, "Rate Limit Disconnects: %d\n", snapshot.RateLimitDisconnects)
+	})
+
+	// 健康檢查與建置資訊 endpoint
+	checker := health.NewChecker()
+	checker.AddCheck("message_loop", func() error {
+		if !stateService.IsLoopRunning() {
+			return errors.New("message loop not running")
+		}
+		return nil
+	})
+	checker.AddCheck("worker_pool", func() error {
+		if !workerPool.IsAccepting() {
+			return errors.New("worker pool not accepting jobs")
+		}
+		return nil
+	})
+	checker.AddCheck("leaderboard_repository", stateService.CheckStorage)
+	checker.AddCheck("room_repository", stateService.CheckRoomStorage)
+	checker.AddCheck("history_repository", stateService.CheckHistoryStorage)
+	checker.AddCheck("profile_repository", stateService.CheckProfileStorage)
+	checker.AddCheck("media_storage", stateService.CheckMediaStorage)
+	http.HandleFunc("/healthz", checker.HandleHealthz)
+	http.HandleFunc("/readyz", checker.HandleReadyz)
+	http.HandleFunc("/version", checker.HandleVersion)
+
+	// 12. 建立 HTTP Server
+	server := &http.Server{
+		Addr:         cfg.Server.ListenAddr(),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+	}
+
+	// 13. 啟動伺服器
+	go func() {
+		logger.Info("Server starting",
+			zap.String("address", server.Addr),
+			zap.String("git_sha", health.GitSHA),
+			zap.String("build_time", health.BuildTime))
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("Server failed to start", zap.Error(err))
+		}
+	}()
+
+	// 14. 優雅關機處理
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	logger.Info("Shutting down server...")
+
+	// 0. 標記為未就緒，讓負載平衡器停止導入流量
+	checker.SetShuttingDown()
+
+	// 建立關機超時上下文
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer shutdownCancel()
+	retryAfter := cfg.Server.RestartRetryAfter
+
+	// 1. 通知所有客戶端伺服器即將重啟，並停止接受新訊息
+	stateService.BeginShutdown(retryAfter)
+	logger.Info("Clients notified, no longer accepting frames")
+
+	// 2. 停止訊息循環，已排隊的訊息會先交給 worker pool
+	cancel()
+	if err := stateService.WaitLoopStopped(shutdownCtx); err != nil {
+		logger.Error("Message loop did not stop in time", zap.Error(err))
+	}
+	logger.Info("Message loop stopped")
+
+	// 3. 停止 worker pool（等待已排隊的任務完成），再處理期間新產生的訊息
+	workerPool.Stop()
+	drained := stateService.DrainPending()
+	logger.Info("Worker pool stopped", zap.Int("drained_messages", drained))
+
+	// 4. 將資料寫回儲存
+	if err := stateService.FlushStorage(); err != nil {
+		logger.Error("Failed to flush storage", zap.Error(err))
+	} else {
+		logger.Info("Storage flushed")
+	}
+
+	// 5. 對所有 WebSocket 連線送出 close frame（附 retry-after 提示）
+	stateService.CloseAllClients(retryAfter)
+
+	// 6. 停止 HTTP server（被 hijack 的 WebSocket 連線不受 Shutdown 管理）
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Server forced to shutdown", zap.Error(err))
+	}
+	logger.Info("HTTP server stopped")
+
+	// 連線都已關閉，最後關閉資料庫
+	if err := store.Close(); err != nil {
+		logger.Error("Failed to close storage", zap.Error(err))
+	}
+
+	// broadcastChan 不再關閉：仍在讀取的連線可能寫入，關閉會造成 panic
+
+	// 7. 同步日誌（有超時保護）
+	syncDone := make(chan struct{})
+	go func() {
+		logger.Sync()
+		close(syncDone)
+	}()
+
+	select {
+	case <-syncDone:
+		// 日誌同步成功
+	case <-time.After(2 * time.Second):
+		// 超時，強制退出
+		fmt.Fprintln(stderr, "Logger sync timeout, forcing exit")
+	}
+
+	fmt.Fprintln(stdout, "Server exited successfully")
+	return exitSuccess
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"chatroom/logger"
+	"chatroom/models"
+	"chatroom/repository"
+
+	"go.uber.org/zap"
+)
+
+// SetHistoryRepository 設定聊天記錄儲存並載入每個房間最近的訊息，
+// 之後新增、刪除與裁切的記錄都會寫入儲存
+func (s *StateServiceV2) SetHistoryRepository(repo repository.HistoryRepository) error {
+	history, err := repo.LoadAll(int(s.historyMaxSize.Load()))
+	if err != nil {
+		return err
+	}
+	lastID, err := repo.LastID()
+	if err != nil {
+		return err
+	}
+
+	s.HistoryMutex.Lock()
+	s.historyRepo = repo
+	count := 0
+	for room, messages := range history {
+		s.History[room] = messages
+		count += len(messages)
+	}
+	s.HistoryMutex.Unlock()
+
+	// 訊息 ID 接續上次的值，客戶端記錄的最後 ID 才不會失效
+	for {
+		current := s.lastMessageID.Load()
+		if current >= lastID || s.lastMessageID.CompareAndSwap(current, lastID) {
+			break
+		}
+	}
+
+	logger.Info("Chat history loaded",
+		zap.Int("rooms", len(history)),
+		zap.Int("messages", count),
+		zap.Int64("last_id", lastID))
+	return nil
+}
+
+// CheckHistoryStorage 檢查聊天記錄儲存是否可讀取（沒有設定時視為正常）
+func (s *StateServiceV2) CheckHistoryStorage() error {
+	s.HistoryMutex.RLock()
+	repo := s.historyRepo
+	s.HistoryMutex.RUnlock()
+
+	if repo == nil {
+		return nil
+	}
+	return repo.Ping()
+}
+
+// persistHistory 將新的歷史記錄寫入儲存
+func (s *StateServiceV2) persistHistory(repo repository.HistoryRepository, msg models.Message, keep int) {
+	if repo == nil {
+		return
+	}
+	if err := repo.Append(msg, keep); err != nil {
+		logger.Error("Failed to save history",
+			zap.String("room", msg.Room),
+			zap.Int64("id", msg.ID),
+			zap.Error(err))
+	}
+}
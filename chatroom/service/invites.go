@@ -0,0 +1,222 @@
+package service
+
+import (
+	apperrors "chatroom/errors"
+	"chatroom/logger"
+	"chatroom/models"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newInviteToken 產生無法猜測的邀請 token
+func newInviteToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateInvite 為目前所在的房間建立邀請連結（擁有者或管理員）；
+// ttl 為 0 表示不會過期，maxUses 為 0 表示不限次數
+func (s *StateServiceV2) CreateInvite(actor *models.Client, ttl time.Duration, maxUses int) (models.Invite, error) {
+	room := actor.Room
+	if s.roleOf(room, presenceKey(actor)) < roleModerator {
+		return models.Invite{}, apperrors.ErrPermissionDenied
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		logger.Error("Failed to generate invite token", zap.Error(err))
+		return models.Invite{}, err
+	}
+
+	invite := &models.Invite{
+		Token:     token,
+		Room:      room,
+		CreatedBy: presenceKey(actor),
+	}
+	if ttl > 0 {
+		invite.ExpiresAt = time.Now().Add(ttl)
+	}
+	if maxUses > 0 {
+		invite.MaxUses = maxUses
+	}
+
+	s.updateRoomMeta(room, func(meta *models.Room) {
+		meta.Invites[token] = invite
+	})
+
+	logger.Info("Invite created",
+		zap.String("room", room),
+		zap.String("creator", actor.Nickname),
+		zap.Int("max_uses", maxUses),
+		zap.Duration("ttl", ttl))
+	return *invite, nil
+}
+
+// RevokeInvite 撤銷邀請連結，只有房間擁有者可以執行
+func (s *StateServiceV2) RevokeInvite(actor *models.Client, token string) error {
+	// 已過期或用完的連結也可以撤銷
+	room, _, _ := s.findInvite(token)
+	if room == "" {
+		return apperrors.ErrInviteInvalid
+	}
+	if s.roleOf(room, presenceKey(actor)) < roleOwner {
+		return apperrors.ErrPermissionDenied
+	}
+
+	s.updateRoomMeta(room, func(meta *models.Room) {
+		delete(meta.Invites, token)
+	})
+
+	logger.Info("Invite revoked",
+		zap.String("room", room),
+		zap.String("actor", actor.Nickname))
+	return nil
+}
+
+// LookupInvite 檢查邀請連結是否有效（不消耗使用次數）；
+// 找到已過期或用完的連結時會順便刪除
+func (s *StateServiceV2) LookupInvite(token string) (models.Invite, error) {
+	s.RoomMetaMutex.Lock()
+	room, invite, err := s.findInviteLocked(token)
+	stale := s.dropStaleInviteLocked(room, token, err)
+	var found models.Invite
+	if invite != nil {
+		found = *invite
+	}
+	s.RoomMetaMutex.Unlock()
+
+	if stale {
+		s.persistRoom(room)
+	}
+	return found, err
+}
+
+// RedeemInvite 使用邀請連結：將使用者加入房間的受邀名單並回傳房間名稱。
+// 受邀成員可以進入僅限受邀或有密碼的房間，但仍受封鎖與人數上限限制。
+func (s *StateServiceV2) RedeemInvite(client *models.Client, token string) (string, error) {
+	key := presenceKey(client)
+
+	s.RoomMetaMutex.Lock()
+	room, invite, err := s.findInviteLocked(token)
+	if s.dropStaleInviteLocked(room, token, err) {
+		s.RoomMetaMutex.Unlock()
+		s.persistRoom(room)
+		return "", err
+	}
+	if err == nil && s.RoomMeta[room].Banned[key] {
+		err = apperrors.ErrBanned
+	}
+	if err != nil {
+		s.RoomMetaMutex.Unlock()
+		return "", err
+	}
+
+	meta := s.RoomMeta[room]
+	if !meta.Invited[key] {
+		invite.Uses++
+		meta.Invited[key] = true
+	}
+	s.RoomMetaMutex.Unlock()
+
+	s.persistRoom(room)
+
+	logger.Info("Invite redeemed",
+		zap.String("room", room),
+		zap.String("nickname", client.Nickname))
+	return room, nil
+}
+
+// findInvite 依 token 找出邀請連結與所屬房間
+func (s *StateServiceV2) findInvite(token string) (string, models.Invite, error) {
+	s.RoomMetaMutex.RLock()
+	defer s.RoomMetaMutex.RUnlock()
+
+	room, invite, err := s.findInviteLocked(token)
+	if invite == nil {
+		return room, models.Invite{}, err
+	}
+	return room, *invite, err
+}
+
+// findInviteLocked 依 token 找出邀請連結並檢查是否仍有效（呼叫端需持有 RoomMetaMutex）
+func (s *StateServiceV2) findInviteLocked(token string) (string, *models.Invite, error) {
+	if token == "" {
+		return "", nil, apperrors.ErrInviteInvalid
+	}
+
+	for room, meta := range s.RoomMeta {
+		invite, ok := meta.Invites[token]
+		if !ok {
+			continue
+		}
+		return room, invite, inviteUsable(invite, time.Now())
+	}
+	return "", nil, apperrors.ErrInviteInvalid
+}
+
+// inviteUsable 檢查邀請連結在 now 時是否已過期或用完
+func inviteUsable(invite *models.Invite, now time.Time) error {
+	if !invite.ExpiresAt.IsZero() && now.After(invite.ExpiresAt) {
+		return apperrors.ErrInviteExpired
+	}
+	if invite.MaxUses > 0 && invite.Uses >= invite.MaxUses {
+		return apperrors.ErrInviteExhausted
+	}
+	return nil
+}
+
+// dropStaleInviteLocked 在 findInviteLocked 回報過期或用完時刪除該連結，
+// 回傳是否有刪除（呼叫端需持有 RoomMetaMutex 寫鎖，並在解鎖後 persistRoom）
+func (s *StateServiceV2) dropStaleInviteLocked(room, token string, err error) bool {
+	if !errors.Is(err, apperrors.ErrInviteExpired) && !errors.Is(err, apperrors.ErrInviteExhausted) {
+		return false
+	}
+	delete(s.RoomMeta[room].Invites, token)
+	return true
+}
+
+// pruneInvites 刪除所有房間中過期或用完的邀請連結，並寫回受影響的永久房間
+func (s *StateServiceV2) pruneInvites() {
+	now := time.Now()
+	var changed []string
+
+	s.RoomMetaMutex.Lock()
+	for room, meta := range s.RoomMeta {
+		pruned := false
+		for token, invite := range meta.Invites {
+			if inviteUsable(invite, now) != nil {
+				delete(meta.Invites, token)
+				pruned = true
+			}
+		}
+		if pruned {
+			changed = append(changed, room)
+		}
+	}
+	s.RoomMetaMutex.Unlock()
+
+	for _, room := range changed {
+		s.persistRoom(room)
+	}
+	if len(changed) > 0 {
+		logger.Info("Stale invites pruned", zap.Int("rooms", len(changed)))
+	}
+}
+
+// isInvited 使用者是否為房間的擁有者、管理員或受邀成員
+func (s *StateServiceV2) isInvited(room string, client *models.Client) bool {
+	key := presenceKey(client)
+
+	s.RoomMetaMutex.RLock()
+	defer s.RoomMetaMutex.RUnlock()
+
+	meta, ok := s.RoomMeta[room]
+	return ok && (meta.Owner == key || meta.Moderators[key] || meta.Invited[key])
+}
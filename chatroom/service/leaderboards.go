@@ -0,0 +1,149 @@
+package service
+
+import (
+	"chatroom/logger"
+	"chatroom/models"
+	"chatroom/repository"
+	"encoding/json"
+
+	"go.uber.org/zap"
+)
+
+// SetLeaderboardStore 設定其他排行榜（其他遊戲、每日、每週、各房間）的儲存，
+// 並刪除重新啟動前已經結束的區間；需在開始處理訊息前呼叫
+func (s *StateServiceV2) SetLeaderboardStore(store repository.LeaderboardStore) error {
+	boards := repository.NewLeaderboards(repository.DefaultBoards(s.config.Storage.LeaderboardSize), s.leaderboardRepo, store)
+	s.leaderboards.Store(boards)
+
+	dropped, err := boards.Prune()
+	if err != nil {
+		return err
+	}
+	if dropped > 0 {
+		logger.Info("Expired leaderboards removed", zap.Int("count", dropped))
+	}
+	return nil
+}
+
+// Leaderboards 所有排行榜
+func (s *StateServiceV2) Leaderboards() *repository.Leaderboards {
+	return s.leaderboards.Load()
+}
+
+// Leaderboard 取得排行榜目前區間的前幾名
+func (s *StateServiceV2) Leaderboard(scope repository.Scope) ([]models.GameScore, error) {
+	return s.leaderboards.Load().Top(scope)
+}
+
+// personalBestAround personal_best 訊息中玩家前後各列出的名次數
+const personalBestAround = 2
+
+// RecordScore 將遊戲成績寫入排行榜，廣播更新後的總榜到遊戲所在的房間，
+// 並將玩家在全站總榜的名次傳給玩家
+func (s *StateServiceV2) RecordScore(board, room string, score models.GameScore) error {
+	boards := s.leaderboards.Load()
+	global := repository.Scope{Board: board, Period: repository.PeriodAllTime}
+	previous, hadBest := s.personalBest(global, score.UserID)
+
+	if err := boards.Record(board, room, score); err != nil {
+		logger.Error("Failed to update leaderboard",
+			zap.String("board", board),
+			zap.String("room", room),
+			zap.Error(err))
+		return err
+	}
+
+	scope := repository.Scope{Board: board, Period: repository.PeriodAllTime}
+	if b, ok := boards.Board(board); ok && b.PerRoom {
+		scope.Room = room
+	}
+	s.broadcastLeaderboard(scope, room)
+
+	if b, ok := boards.Board(board); ok {
+		newBest := !b.Accumulate && (!hadBest || b.Less(score, previous))
+		s.sendPersonalBest(global, score.UserID, newBest)
+	}
+	return nil
+}
+
+// personalBest 玩家在排行榜上目前的最佳成績
+func (s *StateServiceV2) personalBest(scope repository.Scope, userID string) (models.GameScore, bool) {
+	if userID == "" {
+		return models.GameScore{}, false
+	}
+	repo, err := s.leaderboards.Load().Get(scope)
+	if err != nil {
+		return models.GameScore{}, false
+	}
+	_, best, ok := repo.GetRank(userID)
+	return best, ok
+}
+
+// sendPersonalBest 將玩家在排行榜的名次、最佳成績與前後名次傳給該使用者的所有連線；
+// 沒有使用者 ID 的玩家無法辨識，不會收到
+func (s *StateServiceV2) sendPersonalBest(scope repository.Scope, userID string, newBest bool) {
+	if userID == "" {
+		return
+	}
+	repo, err := s.leaderboards.Load().Get(scope)
+	if err != nil {
+		logger.Error("Failed to load leaderboard", zap.String("board", scope.Board), zap.Error(err))
+		return
+	}
+	rank, best, ok := repo.GetRank(userID)
+	if !ok {
+		return
+	}
+	around, from := repo.GetAround(userID, personalBestAround)
+
+	msg := models.Message{
+		Type:   "personal_best",
+		Board:  scope.Board,
+		Period: string(scope.Period),
+		Best: &models.PersonalBest{
+			Rank:       rank,
+			Score:      best,
+			NewBest:    newBest,
+			Around:     around,
+			AroundFrom: from,
+		},
+	}
+	for _, client := range s.allClients() {
+		if client.UserID == userID {
+			s.safeWriteJSON(client, msg)
+		}
+	}
+}
+
+// broadcastLeaderboard 廣播排行榜到房間
+func (s *StateServiceV2) broadcastLeaderboard(scope repository.Scope, room string) {
+	msg, err := s.LeaderboardMessage(scope)
+	if err != nil {
+		logger.Error("Failed to load leaderboard", zap.String("board", scope.Board), zap.Error(err))
+		return
+	}
+	msg.Room = room
+	s.BroadcastToRoom(msg)
+}
+
+// LeaderboardMessage 排行榜的 leaderboard_update 訊息，content 為 JSON 格式的成績列表
+func (s *StateServiceV2) LeaderboardMessage(scope repository.Scope) (models.Message, error) {
+	scope, _, err := s.leaderboards.Load().Normalize(scope)
+	if err != nil {
+		return models.Message{}, err
+	}
+	scores, err := s.Leaderboard(scope)
+	if err != nil {
+		return models.Message{}, err
+	}
+	scoresJSON, err := json.Marshal(scores)
+	if err != nil {
+		return models.Message{}, err
+	}
+	return models.Message{
+		Type:    "leaderboard_update",
+		Content: string(scoresJSON),
+		Board:   scope.Board,
+		Period:  string(scope.Period),
+	}, nil
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"chatroom/logger"
 	"chatroom/models"
+	"chatroom/repository"
 	"strings"
 	"time"
 
@@ -67,9 +68,9 @@ func (s *StateServiceV2) handleDraw(msg models.Message) {
 // handleGameScore
 func (s *StateServiceV2) handleGameScore(msg models.Message) {
 	newScore := models.GameScore{
-		Nickname: msg.Nickname, Avatar: msg.Avatar, Tries: msg.Tries, Time: msg.Time,
+		UserID: msg.UserId, Nickname: msg.Nickname, Avatar: msg.Avatar, Tries: msg.Tries, Time: msg.Time,
 	}
-	s.UpdateLeaderboard(newScore)
+	s.UpdateLeaderboard(msg.Room, newScore)
 }
 
 // handleReaction
@@ -89,7 +90,7 @@ func (s *StateServiceV2) handleVoteStart(msg models.Message) {
 	}
 	s.VotesMutex.Unlock()
 
-	s.AddHistory(msg)
+	msg = s.AddHistory(msg)
 	s.BroadcastToRoom(msg)
 }
 
@@ -118,7 +119,7 @@ func (s *StateServiceV2) handleVoteAnswer(msg models.Message) {
 func (s *StateServiceV2) handleQuizStart(msg models.Message) {
 	s.QuizzesMutex.Lock()
 	s.Quizzes[msg.Room] = &models.Quiz{
-		Question: msg.Question, Answer: msg.Answer, Active: true,
+		Question: msg.Question, Answer: msg.Answer, Active: true, StartedAt: time.Now(),
 	}
 	s.QuizzesMutex.Unlock()
 
@@ -127,7 +128,7 @@ func (s *StateServiceV2) handleQuizStart(msg models.Message) {
 		Question: msg.Question, Timestamp: msg.Timestamp,
 	}
 
-	s.AddHistory(broadcastMsg)
+	broadcastMsg = s.AddHistory(broadcastMsg)
 	s.BroadcastToRoom(broadcastMsg)
 }
 
@@ -137,8 +138,10 @@ func (s *StateServiceV2) handleQuizAnswer(msg models.Message) {
 	quiz, exists := s.Quizzes[msg.Room]
 	isCorrect := exists && quiz.Active && (quiz.Answer == msg.Answer)
 	var correctAnswer string
+	var elapsed time.Duration
 	if isCorrect {
 		quiz.Active = false
+		elapsed = time.Since(quiz.StartedAt)
 	}
 	if exists {
 		correctAnswer = quiz.Answer
@@ -150,14 +153,22 @@ func (s *StateServiceV2) handleQuizAnswer(msg models.Message) {
 			Type: "quiz_result", Room: msg.Room, Nickname: msg.Nickname, Avatar: msg.Avatar,
 			Content: msg.Content, Answer: correctAnswer, Timestamp: time.Now().Format("15:04:05"),
 		}
-		s.AddHistory(resultMsg)
+		resultMsg = s.AddHistory(resultMsg)
 		s.BroadcastToRoom(resultMsg)
+
+		s.RecordScore(repository.BoardQuiz, msg.Room, models.GameScore{
+			UserID: msg.UserId, Nickname: msg.Nickname, Avatar: msg.Avatar, Score: 1, Time: int(elapsed.Seconds()),
+		})
 	}
 }
 
-// handleGetLeaderboard
+// handleGetLeaderboard 廣播指定的排行榜，沒有指定時為猜數字總榜
 func (s *StateServiceV2) handleGetLeaderboard(msg models.Message) {
-	s.broadcastLeaderboard()
+	board := msg.Board
+	if board == "" {
+		board = repository.BoardGuessNumber
+	}
+	s.broadcastLeaderboard(repository.Scope{Board: board, Period: repository.Period(msg.Period), Room: msg.Room}, msg.Room)
 }
 
 // handleChat
@@ -178,6 +189,7 @@ func (s *StateServiceV2) handleChat(msg models.Message) {
 			if word != "" {
 				state.CurrentWord = word
 				state.CurrentDrawer = msg.Nickname
+				state.StartedAt = time.Now()
 				s.DrawStateMutex.Unlock() // Unlock before sending messages
 
 				// Notify drawer
@@ -228,9 +240,14 @@ func (s *StateServiceV2) handleChat(msg models.Message) {
 				Content: state.CurrentWord, Timestamp: time.Now().Format("15:04:05"),
 			}
 			s.BroadcastToRoom(broadcastMsg)
+			elapsed := time.Since(state.StartedAt)
 			state.CurrentWord = ""
 			state.CurrentDrawer = ""
 			s.DrawStateMutex.Unlock()
+
+			s.RecordScore(repository.BoardDrawGuess, msg.Room, models.GameScore{
+				UserID: msg.UserId, Nickname: msg.Nickname, Avatar: msg.Avatar, Score: 1, Time: int(elapsed.Seconds()),
+			})
 			return
 		}
 		s.DrawStateMutex.Unlock()
@@ -248,7 +265,7 @@ func (s *StateServiceV2) handleChat(msg models.Message) {
 			return
 		}
 
-		s.AddHistory(msg)
+		msg = s.AddHistory(msg)
 	}
 	s.BroadcastToRoom(msg)
 }
@@ -257,7 +274,7 @@ func (s *StateServiceV2) handleChat(msg models.Message) {
 func (s *StateServiceV2) handleDefault(msg models.Message) {
 	if !strings.HasPrefix(msg.Room, "_") {
 		if msg.Type == "image" || msg.Type == "voice" || msg.Content != "" {
-			s.AddHistory(msg)
+			msg = s.AddHistory(msg)
 		}
 	}
 	s.BroadcastToRoom(msg)
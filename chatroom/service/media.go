@@ -0,0 +1,159 @@
+package service
+
+import (
+	apperrors "chatroom/errors"
+	"chatroom/imaging"
+	"chatroom/models"
+	"chatroom/repository"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultAvatar 自訂頭像無法使用時改用的頭像
+const DefaultAvatar = "😺"
+
+// errNoBlobStore 沒有設定媒體儲存
+var errNoBlobStore = errors.New("media storage not configured")
+
+// mediaMessageTypes 訊息類型與可以附加的檔案類型前綴
+var mediaMessageTypes = map[string]string{
+	"image": "image/",
+	"voice": "audio/",
+}
+
+// SetBlobStore 設定上傳的圖片與語音的儲存
+func (s *StateServiceV2) SetBlobStore(store repository.BlobStore) {
+	s.BlobsMutex.Lock()
+	s.blobStore = store
+	s.BlobsMutex.Unlock()
+}
+
+// Blobs 上傳的圖片與語音的儲存，沒有設定時為 nil
+func (s *StateServiceV2) Blobs() repository.BlobStore {
+	s.BlobsMutex.RLock()
+	defer s.BlobsMutex.RUnlock()
+	return s.blobStore
+}
+
+// CheckMediaStorage 檢查媒體儲存是否可存取（沒有設定時視為正常）
+func (s *StateServiceV2) CheckMediaStorage() error {
+	store := s.Blobs()
+	if store == nil {
+		return nil
+	}
+	return store.Ping()
+}
+
+// MediaMessageType 檔案類型對應的訊息類型（image 或 voice），不能附加時回傳空字串
+func MediaMessageType(contentType string) string {
+	for msgType, prefix := range mediaMessageTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return msgType
+		}
+	}
+	return ""
+}
+
+// CheckMedia 圖片與語音訊息的內容必須是已上傳檔案的網址，且檔案類型與訊息類型相符；
+// 縮圖只能附加在圖片訊息上，同樣必須是已上傳的圖片
+func (s *StateServiceV2) CheckMedia(msg models.Message) error {
+	if msg.Thumbnail != "" && (msg.Type != "image" || !s.isStoredMedia(msg.Thumbnail, "image")) {
+		return apperrors.ErrInvalidMedia
+	}
+	if _, ok := mediaMessageTypes[msg.Type]; !ok {
+		return nil
+	}
+	if !s.isStoredMedia(msg.Content, msg.Type) {
+		return apperrors.ErrInvalidMedia
+	}
+	return nil
+}
+
+// isStoredMedia 網址是否指向已上傳、且可以附加在 msgType 訊息上的檔案
+func (s *StateServiceV2) isStoredMedia(url, msgType string) bool {
+	store := s.Blobs()
+	if store == nil {
+		return false
+	}
+	key, ok := store.Key(url)
+	if !ok {
+		return false
+	}
+	blob, err := store.Stat(key)
+	return err == nil && MediaMessageType(blob.ContentType) == msgType
+}
+
+// imageOptions 依配置的圖片處理選項
+func (s *StateServiceV2) imageOptions() imaging.Options {
+	return imaging.Options{
+		MaxPixels:     s.config.Storage.MediaMaxPixels,
+		ThumbnailSize: s.config.Storage.MediaThumbnailSize,
+		AvatarSize:    s.config.Storage.MediaAvatarSize,
+	}
+}
+
+// StoreImage 將上傳的圖片轉正、移除中繼資料並重新編碼後，儲存原圖與縮圖；
+// 無法解碼或像素過多的圖片回傳 imaging 的錯誤
+func (s *StateServiceV2) StoreImage(data []byte) (full, thumbnail repository.Blob, err error) {
+	store := s.Blobs()
+	if store == nil {
+		return repository.Blob{}, repository.Blob{}, errNoBlobStore
+	}
+
+	fullImage, thumbnailImage, err := imaging.Process(data, s.imageOptions())
+	if err != nil {
+		return repository.Blob{}, repository.Blob{}, err
+	}
+	if full, err = store.Put(fullImage.Data, fullImage.ContentType); err != nil {
+		return repository.Blob{}, repository.Blob{}, err
+	}
+	if thumbnail, err = store.Put(thumbnailImage.Data, thumbnailImage.ContentType); err != nil {
+		return repository.Blob{}, repository.Blob{}, err
+	}
+	return full, thumbnail, nil
+}
+
+// StoreAvatar 將 data URL 格式的自訂頭像裁成正方形並縮放後儲存，回傳頭像網址
+func (s *StateServiceV2) StoreAvatar(dataURL string) (string, error) {
+	store := s.Blobs()
+	if store == nil {
+		return "", errNoBlobStore
+	}
+
+	header, encoded, ok := strings.Cut(dataURL, ",")
+	if !ok || !strings.HasPrefix(header, "data:image/") || !strings.HasSuffix(header, ";base64") {
+		return "", imaging.ErrUnsupportedFormat
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", imaging.ErrInvalidImage, err)
+	}
+
+	avatar, err := imaging.Avatar(data, s.imageOptions())
+	if err != nil {
+		return "", err
+	}
+	blob, err := store.Put(avatar.Data, avatar.ContentType)
+	if err != nil {
+		return "", err
+	}
+	return blob.URL, nil
+}
+
+// SessionClient 依 session token 取得客戶端（包含等待恢復的連線），用於驗證 HTTP 請求
+func (s *StateServiceV2) SessionClient(token string) (*models.Client, bool) {
+	if token == "" {
+		return nil, false
+	}
+
+	s.SessionsMutex.Lock()
+	defer s.SessionsMutex.Unlock()
+
+	sess, ok := s.sessions[token]
+	if !ok {
+		return nil, false
+	}
+	return sess.client, true
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	apperrors "chatroom/errors"
+	"chatroom/logger"
+	"chatroom/models"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// IsModerationCommand 是否為房間管理指令
+func IsModerationCommand(msgType string) bool {
+	switch msgType {
+	case "kick", "mute", "unmute", "ban", "unban", "delete_message",
+		"set_password", "add_moderator", "remove_moderator",
+		"invite", "uninvite", "update_room", "delete_room":
+		return true
+	}
+	return false
+}
+
+// Moderate 執行房間管理指令，權限不足或對象不存在時回傳錯誤
+func (s *StateServiceV2) Moderate(actor *models.Client, msg models.Message) error {
+	room := actor.Room
+	actorKey := presenceKey(actor)
+	role := s.roleOf(room, actorKey)
+
+	// 任免管理員與變更房間設定只有擁有者可以執行，其餘指令管理員也可以
+	required := roleModerator
+	switch msg.Type {
+	case "add_moderator", "remove_moderator", "update_room", "delete_room":
+		required = roleOwner
+	}
+	if role < required {
+		logger.Warn("Moderation denied",
+			zap.String("room", room),
+			zap.String("actor", actor.Nickname),
+			zap.String("command", msg.Type))
+		return apperrors.ErrPermissionDenied
+	}
+
+	// 管理員不能對擁有者或其他管理員下指令
+	if msg.TargetId != "" && msg.Type != "add_moderator" && msg.Type != "remove_moderator" {
+		if role != roleOwner && s.roleOf(room, msg.TargetId) >= roleModerator {
+			return apperrors.ErrPermissionDenied
+		}
+	}
+
+	var notice string
+	var err error
+
+	switch msg.Type {
+	case "kick":
+		notice, err = s.kickUser(room, msg.TargetId, "kicked")
+		if err == nil {
+			notice = fmt.Sprintf("%s 已被 %s 踢出房間", notice, actor.Nickname)
+		}
+	case "mute":
+		duration := time.Duration(msg.Duration) * time.Second
+		if duration <= 0 {
+			duration = 5 * time.Minute
+		}
+		s.updateRoomMeta(room, func(meta *models.Room) {
+			meta.Muted[msg.TargetId] = time.Now().Add(duration)
+		})
+		notice = fmt.Sprintf("%s 已被 %s 禁言 %d 秒", s.displayName(room, msg.TargetId), actor.Nickname, int(duration.Seconds()))
+	case "unmute":
+		s.updateRoomMeta(room, func(meta *models.Room) {
+			delete(meta.Muted, msg.TargetId)
+		})
+		notice = fmt.Sprintf("%s 已被 %s 解除禁言", s.displayName(room, msg.TargetId), actor.Nickname)
+	case "ban":
+		if msg.TargetId == "" {
+			return apperrors.ErrTargetNotFound
+		}
+		name := s.displayName(room, msg.TargetId)
+		s.updateRoomMeta(room, func(meta *models.Room) {
+			meta.Banned[msg.TargetId] = true
+		})
+		s.kickUser(room, msg.TargetId, "banned")
+		notice = fmt.Sprintf("%s 已被 %s 封鎖", name, actor.Nickname)
+	case "unban":
+		s.updateRoomMeta(room, func(meta *models.Room) {
+			delete(meta.Banned, msg.TargetId)
+		})
+		notice = fmt.Sprintf("%s 已被 %s 解除封鎖", msg.TargetId, actor.Nickname)
+	case "delete_message":
+		if !s.deleteHistoryMessage(room, msg.ID) {
+			return apperrors.ErrTargetNotFound
+		}
+		s.broadcastMessage(models.Message{Type: "message_deleted", Room: room, ID: msg.ID})
+		notice = fmt.Sprintf("%s 刪除了一則訊息", actor.Nickname)
+	case "set_password":
+		if err := s.setRoomPassword(room, msg.Password); err != nil {
+			return err
+		}
+		s.BroadcastRoomList()
+		notice = fmt.Sprintf("%s 變更了房間密碼", actor.Nickname)
+	case "add_moderator":
+		if msg.TargetId == "" {
+			return apperrors.ErrTargetNotFound
+		}
+		s.updateRoomMeta(room, func(meta *models.Room) {
+			meta.Moderators[msg.TargetId] = true
+		})
+		notice = fmt.Sprintf("%s 已被任命為管理員", s.displayName(room, msg.TargetId))
+	case "remove_moderator":
+		s.updateRoomMeta(room, func(meta *models.Room) {
+			delete(meta.Moderators, msg.TargetId)
+		})
+		notice = fmt.Sprintf("%s 已被解除管理員", s.displayName(room, msg.TargetId))
+	case "invite":
+		if msg.TargetId == "" {
+			return apperrors.ErrTargetNotFound
+		}
+		s.updateRoomMeta(room, func(meta *models.Room) {
+			meta.Invited[msg.TargetId] = true
+		})
+		notice = fmt.Sprintf("%s 邀請了 %s", actor.Nickname, msg.TargetId)
+	case "uninvite":
+		s.updateRoomMeta(room, func(meta *models.Room) {
+			delete(meta.Invited, msg.TargetId)
+		})
+		notice = fmt.Sprintf("%s 取消了 %s 的邀請", actor.Nickname, msg.TargetId)
+	case "update_room":
+		if msg.Settings == nil {
+			return apperrors.ErrInvalidMessage
+		}
+		s.updateRoomMeta(room, func(meta *models.Room) {
+			meta.RoomSettings = normalizeRoomSettings(*msg.Settings)
+		})
+		s.BroadcastRoomList()
+		notice = fmt.Sprintf("%s 更新了房間設定", actor.Nickname)
+	case "delete_room":
+		// 取消永久保存，最後一位成員離開後房間即消失
+		s.updateRoomMeta(room, func(meta *models.Room) {
+			meta.Persistent = false
+		})
+		s.unpersistRoom(room)
+		s.BroadcastRoomList()
+		notice = fmt.Sprintf("%s 將房間改為臨時房間", actor.Nickname)
+	default:
+		return fmt.Errorf("unknown moderation command %q", msg.Type)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.announceSystem(room, notice)
+
+	logger.Info("Moderation command executed",
+		zap.String("room", room),
+		zap.String("actor", actor.Nickname),
+		zap.String("command", msg.Type),
+		zap.String("target", msg.TargetId))
+	return nil
+}
+
+// updateRoomMeta 在鎖內修改房間管理資訊，永久房間會同步寫入儲存
+func (s *StateServiceV2) updateRoomMeta(room string, update func(meta *models.Room)) {
+	s.RoomMetaMutex.Lock()
+	meta, ok := s.RoomMeta[room]
+	if ok {
+		update(meta)
+	}
+	s.RoomMetaMutex.Unlock()
+
+	if ok {
+		s.persistRoom(room)
+	}
+}
+
+// kickUser 將使用者在房間中的所有連線移到大廳，回傳使用者暱稱
+func (s *StateServiceV2) kickUser(room, userKey, reason string) (string, error) {
+	var targets []*models.Client
+	s.RoomsMutex.RLock()
+	for c := range s.Rooms[room] {
+		if presenceKey(c) == userKey {
+			targets = append(targets, c)
+		}
+	}
+	s.RoomsMutex.RUnlock()
+
+	if len(targets) == 0 {
+		return "", apperrors.ErrTargetNotFound
+	}
+
+	for _, c := range targets {
+		s.safeWriteJSON(c, models.Message{
+			Type:    reason,
+			Room:    room,
+			Content: "你已被移出房間 " + room,
+		})
+		if oldRoom, err := s.SwitchRoom(c, s.lobbyRoom(), ""); err == nil {
+			s.EnterRoom(c, oldRoom)
+		}
+	}
+
+	return targets[0].Nickname, nil
+}
+
+// displayName 找出使用者在房間中的暱稱，不在房間時使用 ID
+func (s *StateServiceV2) displayName(room, userKey string) string {
+	s.RoomsMutex.RLock()
+	defer s.RoomsMutex.RUnlock()
+
+	for c := range s.Rooms[room] {
+		if presenceKey(c) == userKey {
+			return c.Nickname
+		}
+	}
+	return userKey
+}
+
+// deleteHistoryMessage 從房間歷史中刪除指定 ID 的訊息
+func (s *StateServiceV2) deleteHistoryMessage(room string, id int64) bool {
+	s.HistoryMutex.Lock()
+	found := false
+	history := s.History[room]
+	for i, msg := range history {
+		if msg.ID == id {
+			s.History[room] = append(history[:i:i], history[i+1:]...)
+			found = true
+			break
+		}
+	}
+	repo := s.historyRepo
+	s.HistoryMutex.Unlock()
+
+	if found && repo != nil {
+		if err := repo.Delete(room, id); err != nil {
+			logger.Error("Failed to delete history message",
+				zap.String("room", room),
+				zap.Int64("id", id),
+				zap.Error(err))
+		}
+	}
+	return found
+}
+
+// announceSystem 發送系統公告到房間
+func (s *StateServiceV2) announceSystem(room, content string) {
+	s.Broadcast <- models.Message{
+		Type:      "system",
+		Room:      room,
+		Nickname:  "🛡️ 系統",
+		Content:   content,
+		Timestamp: time.Now().Format("15:04:05"),
+	}
+}
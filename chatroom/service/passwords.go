@@ -0,0 +1,192 @@
+package service
+
+import (
+	apperrors "chatroom/errors"
+	"chatroom/logger"
+	"chatroom/models"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordAttempt 使用者在某房間的密碼錯誤記錄
+type passwordAttempt struct {
+	failures     int
+	firstFailure time.Time // 本輪計數的第一次錯誤，超過鎖定時間後重新計算
+	lockedUntil  time.Time
+}
+
+// passwordAttemptKeys 密碼錯誤記錄的鍵：房間 + 使用者，以及房間 + IP。
+// 使用者 ID 由客戶端提供，只以使用者計算時換一個 ID 就能重新嘗試，因此同一 IP 也合併計算
+func passwordAttemptKeys(room string, client *models.Client) []string {
+	keys := []string{room + "\x00" + presenceKey(client)}
+	if client.IP != "" {
+		keys = append(keys, room+"\x00ip:"+client.IP)
+	}
+	return keys
+}
+
+// maxRoomPasswordBytes bcrypt 可接受的密碼長度上限（位元組）
+const maxRoomPasswordBytes = 72
+
+// validateRoomPassword 檢查房間密碼長度，超過 bcrypt 上限時回傳 ErrPasswordTooLong
+func validateRoomPassword(password string) error {
+	if len(password) > maxRoomPasswordBytes {
+		return apperrors.ErrPasswordTooLong
+	}
+	return nil
+}
+
+// hashRoomPassword 產生加鹽的密碼雜湊，房間只保存雜湊值
+func hashRoomPassword(password string) (string, error) {
+	if err := validateRoomPassword(password); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// setRoomPassword 設定房間密碼；空字串表示移除密碼
+func (s *StateServiceV2) setRoomPassword(room, password string) error {
+	if password == "" {
+		s.RoomPasswordsMutex.Lock()
+		delete(s.RoomPasswords, room)
+		s.RoomPasswordsMutex.Unlock()
+
+		s.updateRoomMeta(room, func(meta *models.Room) {
+			meta.PasswordHash = ""
+		})
+		return nil
+	}
+
+	hash, err := hashRoomPassword(password)
+	if err != nil {
+		logger.Error("Failed to hash room password", zap.String("room", room), zap.Error(err))
+		return err
+	}
+
+	s.RoomPasswordsMutex.Lock()
+	s.RoomPasswords[room] = hash
+	s.RoomPasswordsMutex.Unlock()
+
+	s.updateRoomMeta(room, func(meta *models.Room) {
+		meta.PasswordHash = hash
+	})
+	return nil
+}
+
+// verifyRoomPassword 驗證進入房間的密碼，錯誤過多時暫時鎖定該使用者
+func (s *StateServiceV2) verifyRoomPassword(client *models.Client, room, password string) error {
+	s.RoomPasswordsMutex.RLock()
+	hash, required := s.RoomPasswords[room]
+	s.RoomPasswordsMutex.RUnlock()
+
+	if !required || s.isInvited(room, client) {
+		// 擁有者、管理員與受邀成員不需要密碼
+		return nil
+	}
+	if password == "" {
+		return apperrors.ErrPasswordRequired
+	}
+	if s.PasswordLockedFor(client, room) > 0 {
+		return apperrors.ErrPasswordLockedOut
+	}
+
+	// bcrypt 比對本身為常數時間
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		if s.recordPasswordFailure(client, room) {
+			logger.Warn("Room password locked out",
+				zap.String("room", room),
+				zap.String("nickname", client.Nickname))
+			return apperrors.ErrPasswordLockedOut
+		}
+		return apperrors.ErrWrongPassword
+	}
+
+	s.PasswordAttemptsMutex.Lock()
+	for _, key := range passwordAttemptKeys(room, client) {
+		delete(s.passwordAttempts, key)
+	}
+	s.PasswordAttemptsMutex.Unlock()
+	return nil
+}
+
+// recordPasswordFailure 記錄一次密碼錯誤，回傳是否因此被鎖定
+func (s *StateServiceV2) recordPasswordFailure(client *models.Client, room string) bool {
+	maxAttempts := s.config.Room.PasswordMaxAttempts
+	if maxAttempts <= 0 {
+		return false
+	}
+
+	s.PasswordAttemptsMutex.Lock()
+	defer s.PasswordAttemptsMutex.Unlock()
+
+	now := time.Now()
+	window := s.config.Room.PasswordLockout
+	locked := false
+	for _, key := range passwordAttemptKeys(room, client) {
+		attempt, ok := s.passwordAttempts[key]
+		if !ok {
+			attempt = &passwordAttempt{}
+			s.passwordAttempts[key] = attempt
+		}
+		// 分散在很長時間內的錯誤不累積
+		if attempt.failures == 0 || now.Sub(attempt.firstFailure) > window {
+			attempt.failures = 0
+			attempt.firstFailure = now
+		}
+		attempt.failures++
+		if attempt.failures < maxAttempts {
+			continue
+		}
+		attempt.failures = 0
+		attempt.lockedUntil = now.Add(window)
+		locked = true
+	}
+	return locked
+}
+
+// prunePasswordAttempts 刪除鎖定已結束且錯誤計數已超過計算時間的記錄
+func (s *StateServiceV2) prunePasswordAttempts() {
+	now := time.Now()
+	window := s.config.Room.PasswordLockout
+
+	s.PasswordAttemptsMutex.Lock()
+	defer s.PasswordAttemptsMutex.Unlock()
+
+	for key, attempt := range s.passwordAttempts {
+		if now.Before(attempt.lockedUntil) {
+			continue
+		}
+		if attempt.failures == 0 || now.Sub(attempt.firstFailure) > window {
+			delete(s.passwordAttempts, key)
+		}
+	}
+}
+
+// PasswordLockedFor 使用者或其 IP 在房間的密碼鎖定剩餘時間（取較長者），0 表示未鎖定
+func (s *StateServiceV2) PasswordLockedFor(client *models.Client, room string) time.Duration {
+	s.PasswordAttemptsMutex.Lock()
+	defer s.PasswordAttemptsMutex.Unlock()
+
+	var longest time.Duration
+	for _, key := range passwordAttemptKeys(room, client) {
+		attempt, ok := s.passwordAttempts[key]
+		if !ok {
+			continue
+		}
+		remaining := time.Until(attempt.lockedUntil)
+		if remaining <= 0 {
+			if attempt.failures == 0 {
+				delete(s.passwordAttempts, key)
+			}
+			continue
+		}
+		longest = max(longest, remaining)
+	}
+	return longest
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"chatroom/logger"
+	"chatroom/models"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 在線狀態
+const (
+	StatusOnline = "online"
+	StatusAway   = "away"
+	StatusBusy   = "busy"
+	StatusIdle   = "idle" // 只會由伺服器自動設定
+)
+
+// userPresence 使用者層級的在線資訊：同一使用者可能有多個分頁或裝置連線
+type userPresence struct {
+	conns      map[*models.Client]struct{}
+	status     string // 使用者自行設定的狀態
+	idle       bool   // 超過閒置時間未收到訊息
+	lastActive time.Time
+}
+
+// effectiveStatus 對外顯示的狀態
+func (p *userPresence) effectiveStatus() string {
+	if p.idle {
+		return StatusIdle
+	}
+	return p.status
+}
+
+// presenceKey 以使用者 ID 識別使用者，沒有 ID 時退回暱稱
+func presenceKey(client *models.Client) string {
+	if client.UserID != "" {
+		return client.UserID
+	}
+	return "nick:" + client.Nickname
+}
+
+// trackConnection 將連線加入使用者的連線集合，回傳是否為該使用者的第一個連線
+func (s *StateServiceV2) trackConnection(client *models.Client) bool {
+	key := presenceKey(client)
+
+	s.PresenceMutex.Lock()
+	defer s.PresenceMutex.Unlock()
+
+	p, ok := s.Presence[key]
+	if !ok {
+		p = &userPresence{
+			conns:  make(map[*models.Client]struct{}),
+			status: StatusOnline,
+		}
+		s.Presence[key] = p
+	}
+	p.conns[client] = struct{}{}
+	p.lastActive = time.Now()
+	p.idle = false
+	return len(p.conns) == 1
+}
+
+// untrackConnection 將連線從使用者的連線集合移除，回傳是否為該使用者的最後一個連線
+func (s *StateServiceV2) untrackConnection(client *models.Client) bool {
+	key := presenceKey(client)
+
+	s.PresenceMutex.Lock()
+	defer s.PresenceMutex.Unlock()
+
+	p, ok := s.Presence[key]
+	if !ok {
+		return true
+	}
+	delete(p.conns, client)
+	if len(p.conns) == 0 {
+		delete(s.Presence, key)
+		return true
+	}
+	return false
+}
+
+// userConnections 取得使用者目前所有的連線
+func (s *StateServiceV2) userConnections(key string) []*models.Client {
+	s.PresenceMutex.RLock()
+	defer s.PresenceMutex.RUnlock()
+
+	p, ok := s.Presence[key]
+	if !ok {
+		return nil
+	}
+	conns := make([]*models.Client, 0, len(p.conns))
+	for c := range p.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// userHasOtherConnInRoom 使用者是否還有其他連線位於指定房間
+func (s *StateServiceV2) userHasOtherConnInRoom(client *models.Client, room string) bool {
+	conns := s.userConnections(presenceKey(client))
+
+	s.RoomsMutex.RLock()
+	defer s.RoomsMutex.RUnlock()
+
+	for _, c := range conns {
+		if c != client && s.Rooms[room][c] {
+			return true
+		}
+	}
+	return false
+}
+
+// AnnounceJoin 使用者的第一個連線進入房間時才廣播加入訊息
+func (s *StateServiceV2) AnnounceJoin(client *models.Client) {
+	room := client.Room
+	if strings.HasPrefix(room, "_") || s.userHasOtherConnInRoom(client, room) {
+		return
+	}
+
+	s.Broadcast <- models.Message{
+		Type:      "join",
+		Room:      room,
+		Content:   client.Nickname + " 加入了聊天室",
+		Timestamp: time.Now().Format("15:04"),
+	}
+
+	// 成員列表增量更新（加入者本身會收到完整列表）
+	s.sendToRoomExcept(models.Message{
+		Type:    "member_joined",
+		Room:    room,
+		Members: []models.Member{s.memberOf(client)},
+	}, client)
+}
+
+// AnnounceLeave 使用者在房間中的最後一個連線離開時才廣播離開訊息
+func (s *StateServiceV2) AnnounceLeave(client *models.Client, room string) {
+	if strings.HasPrefix(room, "_") || s.IsDraining() || s.userHasOtherConnInRoom(client, room) {
+		return
+	}
+
+	s.Broadcast <- models.Message{
+		Type:      "leave",
+		Room:      room,
+		Content:   client.Nickname + " 離開了聊天室",
+		Timestamp: time.Now().Format("15:04"),
+	}
+
+	s.sendToRoomExcept(models.Message{
+		Type:    "member_left",
+		Room:    room,
+		Members: []models.Member{s.memberOf(client)},
+	}, client)
+}
+
+// OnlineUsers 目前在線的不重複使用者數
+func (s *StateServiceV2) OnlineUsers() int {
+	s.PresenceMutex.RLock()
+	defer s.PresenceMutex.RUnlock()
+	return len(s.Presence)
+}
+
+// countUsersInRoom 計算房間中不重複的使用者數（呼叫端需持有 RoomsMutex）
+func countUsersInRoom(clients map[*models.Client]bool) int {
+	users := make(map[string]struct{}, len(clients))
+	for c := range clients {
+		users[presenceKey(c)] = struct{}{}
+	}
+	return len(users)
+}
+
+// Touch 記錄使用者活動；若原本為閒置則恢復並通知房間
+func (s *StateServiceV2) Touch(client *models.Client) {
+	key := presenceKey(client)
+
+	s.PresenceMutex.Lock()
+	p, ok := s.Presence[key]
+	wasIdle := false
+	if ok {
+		p.lastActive = time.Now()
+		wasIdle = p.idle
+		p.idle = false
+	}
+	s.PresenceMutex.Unlock()
+
+	if wasIdle {
+		s.broadcastPresence(client)
+	}
+}
+
+// SetStatus 設定使用者的在線狀態
+func (s *StateServiceV2) SetStatus(client *models.Client, status string) error {
+	switch status {
+	case StatusOnline, StatusAway, StatusBusy:
+	default:
+		return fmt.Errorf("invalid status %q", status)
+	}
+
+	key := presenceKey(client)
+
+	s.PresenceMutex.Lock()
+	p, ok := s.Presence[key]
+	if ok {
+		p.status = status
+		p.idle = false
+		p.lastActive = time.Now()
+	}
+	s.PresenceMutex.Unlock()
+
+	if !ok {
+		return fmt.Errorf("user %s not online", key)
+	}
+
+	s.broadcastPresence(client)
+	return nil
+}
+
+// StatusOf 取得使用者目前對外顯示的狀態
+func (s *StateServiceV2) StatusOf(client *models.Client) string {
+	s.PresenceMutex.RLock()
+	defer s.PresenceMutex.RUnlock()
+
+	if p, ok := s.Presence[presenceKey(client)]; ok {
+		return p.effectiveStatus()
+	}
+	return StatusOnline
+}
+
+// broadcastPresence 將使用者的狀態變更廣播到其連線所在的所有房間
+func (s *StateServiceV2) broadcastPresence(client *models.Client) {
+	status := s.StatusOf(client)
+
+	conns := s.userConnections(presenceKey(client))
+
+	rooms := make(map[string]struct{})
+	s.RoomsMutex.RLock()
+	for _, c := range conns {
+		if s.Rooms[c.Room][c] && !strings.HasPrefix(c.Room, "_") {
+			rooms[c.Room] = struct{}{}
+		}
+	}
+	s.RoomsMutex.RUnlock()
+
+	for room := range rooms {
+		s.broadcastMessage(models.Message{
+			Type:     "presence",
+			Room:     room,
+			UserId:   client.UserID,
+			Nickname: client.Nickname,
+			Status:   status,
+		})
+	}
+}
+
+// RoomMembers 列出房間中的成員（同一使用者只列一次）
+func (s *StateServiceV2) RoomMembers(room string) []models.Member {
+	s.RoomsMutex.RLock()
+	clients := make([]*models.Client, 0, len(s.Rooms[room]))
+	for c := range s.Rooms[room] {
+		clients = append(clients, c)
+	}
+	s.RoomsMutex.RUnlock()
+
+	seen := make(map[string]bool, len(clients))
+	members := make([]models.Member, 0, len(clients))
+	for _, c := range clients {
+		key := presenceKey(c)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		members = append(members, s.memberOf(c))
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Nickname < members[j].Nickname
+	})
+	return members
+}
+
+// memberOf 將連線轉為成員資訊
+func (s *StateServiceV2) memberOf(client *models.Client) models.Member {
+	return models.Member{
+		UserId:   client.UserID,
+		Nickname: client.Nickname,
+		Avatar:   client.Avatar,
+		Level:    client.Level,
+		Title:    client.Title,
+		Status:   s.StatusOf(client),
+	}
+}
+
+// SendRoomMembers 發送房間成員列表給客戶端
+func (s *StateServiceV2) SendRoomMembers(client *models.Client) {
+	s.safeWriteJSON(client, models.Message{
+		Type:    "room_members",
+		Room:    client.Room,
+		Members: s.RoomMembers(client.Room),
+	})
+}
+
+// presenceLoop 定期檢查閒置的使用者
+func (s *StateServiceV2) presenceLoop(ctx context.Context) {
+	idleAfter := s.config.Presence.IdleAfter
+	if idleAfter <= 0 {
+		return
+	}
+
+	interval := idleAfter / 2
+	if interval > 30*time.Second {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.markIdleUsers(idleAfter)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// markIdleUsers 將超過閒置時間未活動的使用者標記為閒置並通知房間
+func (s *StateServiceV2) markIdleUsers(idleAfter time.Duration) {
+	now := time.Now()
+	var becameIdle []*models.Client
+
+	s.PresenceMutex.Lock()
+	for _, p := range s.Presence {
+		if p.idle || now.Sub(p.lastActive) < idleAfter {
+			continue
+		}
+		p.idle = true
+		for c := range p.conns {
+			becameIdle = append(becameIdle, c)
+			break
+		}
+	}
+	s.PresenceMutex.Unlock()
+
+	for _, c := range becameIdle {
+		s.broadcastPresence(c)
+	}
+
+	if len(becameIdle) > 0 {
+		logger.Debug("Users marked idle", zap.Int("count", len(becameIdle)))
+	}
+}
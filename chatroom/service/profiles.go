@@ -0,0 +1,76 @@
+package service
+
+import (
+	"chatroom/logger"
+	"chatroom/models"
+	"chatroom/repository"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SetProfileRepository 設定使用者資料儲存，之後每次連線都會更新使用者資料
+func (s *StateServiceV2) SetProfileRepository(repo repository.ProfileRepository) {
+	s.ProfilesMutex.Lock()
+	s.profileRepo = repo
+	s.ProfilesMutex.Unlock()
+}
+
+// CheckProfileStorage 檢查使用者資料儲存是否可讀取（沒有設定時視為正常）
+func (s *StateServiceV2) CheckProfileStorage() error {
+	s.ProfilesMutex.RLock()
+	repo := s.profileRepo
+	s.ProfilesMutex.RUnlock()
+
+	if repo == nil {
+		return nil
+	}
+	return repo.Ping()
+}
+
+// Profile 取得使用者資料，沒有設定儲存或找不到時第二個回傳值為 false
+func (s *StateServiceV2) Profile(userID string) (models.Profile, bool) {
+	s.ProfilesMutex.RLock()
+	repo := s.profileRepo
+	s.ProfilesMutex.RUnlock()
+
+	if repo == nil || userID == "" {
+		return models.Profile{}, false
+	}
+	profile, ok, err := repo.Get(userID)
+	if err != nil {
+		logger.Error("Failed to load profile", zap.String("user_id", userID), zap.Error(err))
+		return models.Profile{}, false
+	}
+	return profile, ok
+}
+
+// saveProfile 以連線時的暱稱、頭像與等級更新使用者資料
+func (s *StateServiceV2) saveProfile(client *models.Client) {
+	s.ProfilesMutex.Lock()
+	defer s.ProfilesMutex.Unlock()
+
+	if s.profileRepo == nil || client.UserID == "" {
+		return
+	}
+
+	now := time.Now()
+	profile, ok, err := s.profileRepo.Get(client.UserID)
+	if err != nil {
+		logger.Error("Failed to load profile", zap.String("user_id", client.UserID), zap.Error(err))
+		return
+	}
+	if !ok {
+		profile = models.Profile{UserID: client.UserID, FirstSeen: now}
+	}
+	profile.Nickname = client.Nickname
+	profile.Avatar = client.Avatar
+	profile.Level = client.Level
+	profile.Exp = client.Exp
+	profile.Title = client.Title
+	profile.LastSeen = now
+
+	if err := s.profileRepo.Save(profile); err != nil {
+		logger.Error("Failed to save profile", zap.String("user_id", client.UserID), zap.Error(err))
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"chatroom/logger"
+	"chatroom/models"
+	"chatroom/ratelimit"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RateLimitPenalty 超過限流時的處置
+type RateLimitPenalty int
+
+const (
+	PenaltyNone       RateLimitPenalty = iota // 允許通過
+	PenaltyThrottle                           // 拒絕此訊息
+	PenaltyMute                               // 暫時禁止發言
+	PenaltyDisconnect                         // 中斷連線
+)
+
+// RateLimitResult 限流檢查結果
+type RateLimitResult struct {
+	Penalty    RateLimitPenalty
+	RetryAfter time.Duration // 建議多久後再發送
+	Remaining  int           // 剩餘的訊息配額
+}
+
+// Allowed 訊息是否允許通過
+func (r RateLimitResult) Allowed() bool {
+	return r.Penalty == PenaltyNone
+}
+
+// rateLimitViolation 限流違規記錄
+type rateLimitViolation struct {
+	count      int
+	last       time.Time
+	mutedUntil time.Time
+}
+
+// CheckRateLimit 檢查限流：依使用者、連線與 IP 扣除訊息類型的費用，
+// 重複違規會依序升級為暫時禁言與中斷連線
+func (s *StateServiceV2) CheckRateLimit(client *models.Client, msgType string) RateLimitResult {
+	// 不計費的訊息（例如 ack）禁言期間也允許
+	if s.rateLimiter.Cost(msgType) <= 0 {
+		return RateLimitResult{}
+	}
+
+	keys := rateLimitKeys(client)
+	key := violationKey(keys)
+	now := time.Now()
+
+	if s.rateLimitMutedUntil(key, now).IsZero() && s.rateLimiter.Allow(keys, msgType) {
+		return RateLimitResult{}
+	}
+
+	result := s.recordViolation(key, now)
+	result.Remaining = s.rateLimiter.GetRemaining(keys)
+	if result.RetryAfter == 0 {
+		result.RetryAfter = s.rateLimiter.RetryAfter(keys, msgType)
+	}
+
+	s.metrics.IncrementRateLimitErrors()
+	fields := []zap.Field{
+		zap.String("user_id", client.UserID),
+		zap.String("conn_id", client.ConnID),
+		zap.String("ip", client.IP),
+		zap.String("type", msgType),
+		zap.Duration("retry_after", result.RetryAfter),
+	}
+	switch result.Penalty {
+	case PenaltyDisconnect:
+		s.metrics.IncrementRateLimitDisconnects()
+		logger.Warn("Rate limit exceeded, disconnecting", fields...)
+	case PenaltyMute:
+		logger.Warn("Rate limit exceeded while muted", fields...)
+	default:
+		logger.Warn("Rate limit exceeded", fields...)
+	}
+	return result
+}
+
+// rateLimitMutedUntil 因限流被禁言的結束時間，沒有被禁言時回傳零值
+func (s *StateServiceV2) rateLimitMutedUntil(key string, now time.Time) time.Time {
+	s.ViolationsMutex.Lock()
+	defer s.ViolationsMutex.Unlock()
+
+	if v, ok := s.violations[key]; ok && now.Before(v.mutedUntil) {
+		return v.mutedUntil
+	}
+	return time.Time{}
+}
+
+// recordViolation 記錄一次違規並決定處置
+func (s *StateServiceV2) recordViolation(key string, now time.Time) RateLimitResult {
+	cfg := s.rateLimitConfig.Load()
+
+	s.ViolationsMutex.Lock()
+	defer s.ViolationsMutex.Unlock()
+
+	v, ok := s.violations[key]
+	if !ok || (cfg.ViolationWindow > 0 && now.Sub(v.last) > cfg.ViolationWindow && now.After(v.mutedUntil)) {
+		s.pruneViolationsLocked(now, cfg.ViolationWindow)
+		v = &rateLimitViolation{}
+		s.violations[key] = v
+	}
+	v.count++
+	v.last = now
+
+	switch {
+	case cfg.DisconnectAfter > 0 && v.count >= cfg.DisconnectAfter:
+		// 保留記錄直到 violation_window 過期，重新連線後再次違規會立即中斷
+		return RateLimitResult{Penalty: PenaltyDisconnect}
+	case cfg.MuteAfter > 0 && v.count == cfg.MuteAfter && cfg.MuteDuration > 0:
+		v.mutedUntil = now.Add(cfg.MuteDuration)
+		s.metrics.IncrementRateLimitMutes()
+		logger.Warn("Rate limit mute",
+			zap.String("key", key),
+			zap.Int("violations", v.count),
+			zap.Duration("duration", cfg.MuteDuration))
+		return RateLimitResult{Penalty: PenaltyMute, RetryAfter: cfg.MuteDuration}
+	case now.Before(v.mutedUntil):
+		return RateLimitResult{Penalty: PenaltyMute, RetryAfter: v.mutedUntil.Sub(now)}
+	}
+	return RateLimitResult{Penalty: PenaltyThrottle}
+}
+
+// pruneViolationsLocked 移除已過期的違規記錄（呼叫端需持有 ViolationsMutex）
+func (s *StateServiceV2) pruneViolationsLocked(now time.Time, window time.Duration) {
+	if window <= 0 {
+		return
+	}
+	for key, v := range s.violations {
+		if now.Sub(v.last) > window && now.After(v.mutedUntil) {
+			delete(s.violations, key)
+		}
+	}
+}
+
+// rateLimitKeys 連線的限流維度。使用者 ID 取自客戶端的初始訊息，沒有經過驗證，
+// 換一個 ID 就能取得新的額度，因此使用者維度不提供任何防護，只讓同一使用者的多個分頁共用額度；
+// 限流實際依靠連線與 IP 維度
+func rateLimitKeys(client *models.Client) ratelimit.Keys {
+	return ratelimit.Keys{User: client.UserID, Conn: client.ConnID, IP: client.IP}
+}
+
+// violationKey 違規記錄跟隨 IP，換使用者 ID 或重新連線都不會重新計算；沒有 IP 時跟隨連線
+func violationKey(keys ratelimit.Keys) string {
+	if keys.IP != "" {
+		return "ip:" + keys.IP
+	}
+	return "conn:" + keys.Conn
+}
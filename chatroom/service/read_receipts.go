@@ -0,0 +1,125 @@
+package service
+
+import (
+	"chatroom/models"
+	"strings"
+)
+
+// latestMessageID 房間最新一則歷史訊息的 ID
+func (s *StateServiceV2) latestMessageID(room string) int64 {
+	s.HistoryMutex.RLock()
+	defer s.HistoryMutex.RUnlock()
+
+	history := s.History[room]
+	if len(history) == 0 {
+		return 0
+	}
+	return history[len(history)-1].ID
+}
+
+// MarkRead 記錄使用者在房間中已讀到的訊息 ID；id 為 0 表示全部已讀。
+// 小房間會廣播已讀回條給其他成員。
+func (s *StateServiceV2) MarkRead(client *models.Client, room string, id int64) {
+	if room == "" {
+		room = client.Room
+	}
+	if strings.HasPrefix(room, "_") {
+		return
+	}
+
+	latest := s.latestMessageID(room)
+	if id <= 0 || id > latest {
+		id = latest
+	}
+	if !s.setReadMark(client, room, id) {
+		return
+	}
+
+	maxMembers := s.config.Room.ReadReceiptMaxMembers
+	if maxMembers <= 0 || room != client.Room {
+		return
+	}
+
+	s.RoomsMutex.RLock()
+	memberCount := countUsersInRoom(s.Rooms[room])
+	s.RoomsMutex.RUnlock()
+
+	if memberCount <= maxMembers {
+		s.sendToRoomExcept(models.Message{
+			Type:     "read_receipt",
+			Room:     room,
+			ID:       id,
+			UserId:   client.UserID,
+			Nickname: client.Nickname,
+		}, client)
+	}
+}
+
+// markRoomRead 靜默地將房間標記為全部已讀（進入或離開房間時使用）
+func (s *StateServiceV2) markRoomRead(client *models.Client, room string) {
+	if strings.HasPrefix(room, "_") {
+		return
+	}
+	s.setReadMark(client, room, s.latestMessageID(room))
+}
+
+// setReadMark 更新已讀位置，只會往前推進；回傳是否有變更
+func (s *StateServiceV2) setReadMark(client *models.Client, room string, id int64) bool {
+	key := presenceKey(client)
+
+	s.ReadMarksMutex.Lock()
+	defer s.ReadMarksMutex.Unlock()
+
+	marks, ok := s.readMarks[key]
+	if !ok {
+		marks = make(map[string]int64)
+		s.readMarks[key] = marks
+	}
+	if current, exists := marks[room]; exists && id <= current {
+		return false
+	}
+	marks[room] = id
+	return true
+}
+
+// UnreadCounts 計算使用者在曾經進入過的其他房間中的未讀訊息數
+func (s *StateServiceV2) UnreadCounts(client *models.Client) map[string]int {
+	key := presenceKey(client)
+
+	s.ReadMarksMutex.RLock()
+	marks := make(map[string]int64, len(s.readMarks[key]))
+	for room, id := range s.readMarks[key] {
+		marks[room] = id
+	}
+	s.ReadMarksMutex.RUnlock()
+
+	counts := make(map[string]int, len(marks))
+	s.HistoryMutex.RLock()
+	defer s.HistoryMutex.RUnlock()
+
+	for room, lastRead := range marks {
+		if room == client.Room {
+			// 目前所在的房間正在閱讀中
+			continue
+		}
+		unread := 0
+		for _, msg := range s.History[room] {
+			if msg.ID > lastRead && countsAsUnread(msg, client) {
+				unread++
+			}
+		}
+		counts[room] = unread
+	}
+	return counts
+}
+
+// countsAsUnread 系統訊息與自己發送的訊息不計入未讀
+func countsAsUnread(msg models.Message, client *models.Client) bool {
+	if msg.Type == "join" || msg.Type == "leave" {
+		return false
+	}
+	if msg.UserId != "" && msg.UserId == client.UserID {
+		return false
+	}
+	return msg.Nickname != client.Nickname
+}
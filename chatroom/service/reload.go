@@ -0,0 +1,42 @@
+package service
+
+import (
+	"chatroom/config"
+	"chatroom/logger"
+
+	"go.uber.org/zap"
+)
+
+// ApplyRuntimeConfig 執行中套用可以即時生效的配置：限流設定與歷史記錄大小
+func (s *StateServiceV2) ApplyRuntimeConfig(cfg *config.Config) {
+	rateLimit := cfg.RateLimit
+	rateLimit.Costs = make(map[string]float64, len(cfg.RateLimit.Costs))
+	for msgType, cost := range cfg.RateLimit.Costs {
+		rateLimit.Costs[msgType] = cost
+	}
+	s.rateLimiter.SetConfig(rateLimit)
+	s.rateLimitConfig.Store(&rateLimit)
+
+	maxSize := cfg.Storage.HistoryMaxSize
+	if old := s.historyMaxSize.Swap(int64(maxSize)); int(old) > maxSize {
+		// 縮小時立即裁切現有的歷史記錄
+		s.HistoryMutex.Lock()
+		for room, history := range s.History {
+			if len(history) > maxSize {
+				s.History[room] = history[len(history)-maxSize:]
+			}
+		}
+		repo := s.historyRepo
+		s.HistoryMutex.Unlock()
+
+		if repo != nil {
+			if err := repo.Trim(maxSize); err != nil {
+				logger.Error("Failed to trim stored history", zap.Error(err))
+			}
+		}
+	}
+
+	logger.Info("Runtime configuration applied",
+		zap.Bool("rate_limit", rateLimit.Enabled),
+		zap.Int("history_max_size", maxSize))
+}
@@ -0,0 +1,423 @@
+package service
+
+import (
+	"chatroom/config"
+	apperrors "chatroom/errors"
+	"chatroom/logger"
+	"chatroom/models"
+	"chatroom/repository"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// lobbyRoom 預設大廳，沒有擁有者且永遠存在
+func (s *StateServiceV2) lobbyRoom() string {
+	if s.config.Room.LobbyName != "" {
+		return s.config.Room.LobbyName
+	}
+	return config.DefaultLobbyName
+}
+
+// 房間角色
+const (
+	roleMember    = 0
+	roleModerator = 1
+	roleOwner     = 2
+)
+
+// isManagedRoom 大廳與遊戲房間不記錄擁有者
+func (s *StateServiceV2) isManagedRoom(room string) bool {
+	return room != s.lobbyRoom() && !strings.HasPrefix(room, "_")
+}
+
+// createRoomMeta 記錄新房間的建立者為擁有者（呼叫端需持有 RoomsMutex）
+func (s *StateServiceV2) createRoomMeta(room string, creator *models.Client) {
+	if !s.isManagedRoom(room) {
+		return
+	}
+
+	s.RoomMetaMutex.Lock()
+	defer s.RoomMetaMutex.Unlock()
+
+	if _, exists := s.RoomMeta[room]; exists {
+		return
+	}
+	s.RoomMeta[room] = newRoomMeta(room, presenceKey(creator))
+
+	logger.Info("Room created",
+		zap.String("room", room),
+		zap.String("owner", creator.Nickname))
+}
+
+// newRoomMeta 建立空的房間管理資訊
+func newRoomMeta(room, owner string) *models.Room {
+	meta := &models.Room{
+		Name:      room,
+		Owner:     owner,
+		CreatedAt: time.Now(),
+	}
+	ensureRoomMaps(meta)
+	return meta
+}
+
+// ensureRoomMaps 初始化房間管理資訊中的 map（從儲存載入時可能為 nil）
+func ensureRoomMaps(meta *models.Room) {
+	if meta.Moderators == nil {
+		meta.Moderators = make(map[string]bool)
+	}
+	if meta.Banned == nil {
+		meta.Banned = make(map[string]bool)
+	}
+	if meta.Invited == nil {
+		meta.Invited = make(map[string]bool)
+	}
+	if meta.Muted == nil {
+		meta.Muted = make(map[string]time.Time)
+	}
+	if meta.Invites == nil {
+		meta.Invites = make(map[string]*models.Invite)
+	}
+}
+
+// deleteRoomMeta 房間清空時移除管理資訊，永久房間會保留（呼叫端需持有 RoomsMutex）
+func (s *StateServiceV2) deleteRoomMeta(room string) {
+	s.RoomMetaMutex.Lock()
+	if meta, ok := s.RoomMeta[room]; ok && !meta.Persistent {
+		delete(s.RoomMeta, room)
+	}
+	s.RoomMetaMutex.Unlock()
+}
+
+// isPersistentRoom 房間是否為永久房間
+func (s *StateServiceV2) isPersistentRoom(room string) bool {
+	s.RoomMetaMutex.RLock()
+	defer s.RoomMetaMutex.RUnlock()
+
+	meta, ok := s.RoomMeta[room]
+	return ok && meta.Persistent
+}
+
+// roleOf 使用者在房間中的角色
+func (s *StateServiceV2) roleOf(room, userKey string) int {
+	s.RoomMetaMutex.RLock()
+	defer s.RoomMetaMutex.RUnlock()
+
+	meta, ok := s.RoomMeta[room]
+	if !ok {
+		return roleMember
+	}
+	if meta.Owner == userKey {
+		return roleOwner
+	}
+	if meta.Moderators[userKey] {
+		return roleModerator
+	}
+	return roleMember
+}
+
+// checkRoomAccess 檢查使用者能否進入房間：封鎖、僅限受邀與人數上限。
+// 人數在加入房間時會於寫入鎖內再次檢查，這裡只是提早拒絕
+func (s *StateServiceV2) checkRoomAccess(room string, client *models.Client) error {
+	key := presenceKey(client)
+
+	s.RoomMetaMutex.RLock()
+	meta, ok := s.RoomMeta[room]
+	var banned, notInvited bool
+	if ok {
+		banned = meta.Banned[key]
+		notInvited = meta.InviteOnly && meta.Owner != key && !meta.Moderators[key] && !meta.Invited[key]
+	}
+	s.RoomMetaMutex.RUnlock()
+
+	if banned {
+		return apperrors.ErrBanned
+	}
+	if notInvited {
+		return apperrors.ErrInviteOnly
+	}
+
+	if maxMembers := s.roomCapacity(room); maxMembers > 0 {
+		s.RoomsMutex.RLock()
+		full := roomFullLocked(s.Rooms[room], key, maxMembers)
+		s.RoomsMutex.RUnlock()
+
+		if full {
+			return apperrors.ErrRoomFull
+		}
+	}
+	return nil
+}
+
+// roomCapacity 房間的人數上限，0 表示不限；房間自訂的上限優先
+func (s *StateServiceV2) roomCapacity(room string) int {
+	if room == s.lobbyRoom() {
+		// 大廳是被踢出或無法進入其他房間時的去處，只受全站上限限制
+		return 0
+	}
+
+	maxMembers := s.config.Room.MaxMembers
+	s.RoomMetaMutex.RLock()
+	if meta, ok := s.RoomMeta[room]; ok && meta.MaxMembers > 0 {
+		maxMembers = meta.MaxMembers
+	}
+	s.RoomMetaMutex.RUnlock()
+	return maxMembers
+}
+
+// roomFullLocked 房間是否已無法再加入使用者 key；已在房間中的使用者開新分頁不受限制
+// （呼叫端需持有 RoomsMutex）
+func roomFullLocked(clients map[*models.Client]bool, key string, maxMembers int) bool {
+	if maxMembers <= 0 {
+		return false
+	}
+	for c := range clients {
+		if presenceKey(c) == key {
+			return false
+		}
+	}
+	return countUsersInRoom(clients) >= maxMembers
+}
+
+// MutedFor 使用者在目前房間剩餘的禁言時間，0 表示未被禁言
+func (s *StateServiceV2) MutedFor(client *models.Client) time.Duration {
+	s.RoomMetaMutex.RLock()
+	defer s.RoomMetaMutex.RUnlock()
+
+	meta, ok := s.RoomMeta[client.Room]
+	if !ok {
+		return 0
+	}
+	until, muted := meta.Muted[presenceKey(client)]
+	if !muted {
+		return 0
+	}
+	if remaining := time.Until(until); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// EnterRoom 切換房間成功後：確認切換、發送歷史與成員列表、廣播加入訊息
+func (s *StateServiceV2) EnterRoom(client *models.Client, oldRoom string) {
+	s.safeWriteJSON(client, models.Message{
+		Type:    "switch_success",
+		Room:    client.Room,
+		Content: oldRoom, // 舊房間名稱
+	})
+
+	s.SendHistory(client)
+
+	if !strings.HasPrefix(client.Room, "_") {
+		s.SendRoomMembers(client)
+	}
+	s.AnnounceJoin(client)
+}
+
+// SetRoomRepository 設定永久房間儲存並載入已保存的房間
+func (s *StateServiceV2) SetRoomRepository(repo repository.RoomRepository) error {
+	rooms, err := repo.Load()
+	if err != nil {
+		return err
+	}
+
+	s.RoomMetaMutex.Lock()
+	s.roomRepo = repo
+	for i := range rooms {
+		meta := rooms[i]
+		ensureRoomMaps(&meta)
+		s.RoomMeta[meta.Name] = &meta
+	}
+	s.RoomMetaMutex.Unlock()
+
+	s.RoomPasswordsMutex.Lock()
+	for _, meta := range rooms {
+		if meta.PasswordHash != "" {
+			s.RoomPasswords[meta.Name] = meta.PasswordHash
+		}
+	}
+	s.RoomPasswordsMutex.Unlock()
+
+	logger.Info("Persistent rooms loaded", zap.Int("count", len(rooms)))
+	return nil
+}
+
+// CheckRoomStorage 檢查房間儲存是否可讀取
+func (s *StateServiceV2) CheckRoomStorage() error {
+	s.RoomMetaMutex.RLock()
+	repo := s.roomRepo
+	s.RoomMetaMutex.RUnlock()
+
+	if repo == nil {
+		return nil
+	}
+	return repo.Ping()
+}
+
+// CreateRoom 建立永久房間，建立者成為擁有者；
+// 建立者原本擁有的臨時房間會轉為永久房間
+func (s *StateServiceV2) CreateRoom(client *models.Client, name, password string, settings models.RoomSettings) error {
+	name = strings.TrimSpace(name)
+	if name == "" || !s.isManagedRoom(name) {
+		return apperrors.ErrInvalidRoomName
+	}
+	// 先檢查密碼，避免房間建立後才設定密碼失敗
+	if err := validateRoomPassword(password); err != nil {
+		return err
+	}
+	key := presenceKey(client)
+
+	s.RoomMetaMutex.Lock()
+	meta, exists := s.RoomMeta[name]
+	if exists && (meta.Persistent || meta.Owner != key) {
+		s.RoomMetaMutex.Unlock()
+		return apperrors.ErrRoomExists
+	}
+	if !exists {
+		meta = newRoomMeta(name, key)
+		s.RoomMeta[name] = meta
+	}
+	meta.RoomSettings = normalizeRoomSettings(settings)
+	meta.Persistent = true
+	s.RoomMetaMutex.Unlock()
+
+	if password != "" {
+		if err := s.setRoomPassword(name, password); err != nil {
+			return err
+		}
+	} else {
+		s.persistRoom(name)
+	}
+
+	s.BroadcastRoomList()
+
+	logger.Info("Persistent room created",
+		zap.String("room", name),
+		zap.String("owner", client.Nickname))
+	return nil
+}
+
+// normalizeRoomSettings 整理使用者輸入的房間設定
+func normalizeRoomSettings(settings models.RoomSettings) models.RoomSettings {
+	settings.Topic = strings.TrimSpace(settings.Topic)
+	settings.Description = strings.TrimSpace(settings.Description)
+	settings.Icon = strings.TrimSpace(settings.Icon)
+	if settings.MaxMembers < 0 {
+		settings.MaxMembers = 0
+	}
+	return settings
+}
+
+// persistRoom 將永久房間的最新狀態寫入儲存
+func (s *StateServiceV2) persistRoom(room string) {
+	// 序列化寫入，避免舊的快照覆蓋新的
+	s.roomPersistMu.Lock()
+	defer s.roomPersistMu.Unlock()
+
+	s.RoomMetaMutex.RLock()
+	repo := s.roomRepo
+	meta, ok := s.RoomMeta[room]
+	var snapshot models.Room
+	if ok && meta.Persistent {
+		snapshot = cloneRoom(meta)
+	}
+	s.RoomMetaMutex.RUnlock()
+
+	if repo == nil || !snapshot.Persistent {
+		return
+	}
+	if err := repo.Save(snapshot); err != nil {
+		logger.Error("Failed to save room", zap.String("room", room), zap.Error(err))
+	}
+}
+
+// unpersistRoom 從儲存中移除房間
+func (s *StateServiceV2) unpersistRoom(room string) {
+	s.roomPersistMu.Lock()
+	defer s.roomPersistMu.Unlock()
+
+	s.RoomMetaMutex.RLock()
+	repo := s.roomRepo
+	s.RoomMetaMutex.RUnlock()
+
+	if repo == nil {
+		return
+	}
+	if err := repo.Delete(room); err != nil {
+		logger.Error("Failed to delete room", zap.String("room", room), zap.Error(err))
+	}
+}
+
+// cloneRoom 複製房間管理資訊（禁言狀態不保存）
+func cloneRoom(meta *models.Room) models.Room {
+	snapshot := *meta
+	snapshot.Moderators = cloneSet(meta.Moderators)
+	snapshot.Banned = cloneSet(meta.Banned)
+	snapshot.Invited = cloneSet(meta.Invited)
+	snapshot.Invites = make(map[string]*models.Invite, len(meta.Invites))
+	for token, invite := range meta.Invites {
+		copied := *invite
+		snapshot.Invites[token] = &copied
+	}
+	snapshot.Muted = nil
+	return snapshot
+}
+
+func cloneSet(set map[string]bool) map[string]bool {
+	clone := make(map[string]bool, len(set))
+	for k, v := range set {
+		clone[k] = v
+	}
+	return clone
+}
+
+// roomSummaries 房間列表：目前有人的房間加上所有永久房間
+func (s *StateServiceV2) roomSummaries() []models.RoomSummary {
+	lobby := s.lobbyRoom()
+	online := make(map[string]int)
+	online[lobby] = 0
+
+	s.RoomsMutex.RLock()
+	for roomName, clients := range s.Rooms {
+		if !strings.HasPrefix(roomName, "_") {
+			online[roomName] = countUsersInRoom(clients)
+		}
+	}
+	s.RoomsMutex.RUnlock()
+
+	settings := make(map[string]models.Room)
+	s.RoomMetaMutex.RLock()
+	for roomName, meta := range s.RoomMeta {
+		if meta.Persistent {
+			if _, ok := online[roomName]; !ok {
+				online[roomName] = 0
+			}
+		}
+		if _, ok := online[roomName]; ok {
+			settings[roomName] = models.Room{RoomSettings: meta.RoomSettings, Persistent: meta.Persistent}
+		}
+	}
+	s.RoomMetaMutex.RUnlock()
+
+	summaries := make([]models.RoomSummary, 0, len(online))
+	s.RoomPasswordsMutex.RLock()
+	for roomName, count := range online {
+		meta := settings[roomName]
+		summaries = append(summaries, models.RoomSummary{
+			Name:         roomName,
+			RoomSettings: meta.RoomSettings,
+			Persistent:   meta.Persistent,
+			Lobby:        roomName == lobby,
+			Locked:       s.RoomPasswords[roomName] != "",
+			Online:       count,
+		})
+	}
+	s.RoomPasswordsMutex.RUnlock()
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries
+}
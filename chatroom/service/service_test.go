@@ -2,10 +2,17 @@ package service
 
 import (
 	"chatroom/config"
+	apperrors "chatroom/errors"
 	"chatroom/metrics"
 	"chatroom/models"
 	"chatroom/pool"
 	"chatroom/ratelimit"
+	"chatroom/repository"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -37,11 +44,28 @@ func (m *MockRepository) GetAll() []models.GameScore {
 	return m.scores
 }
 
+func (m *MockRepository) GetRank(userID string) (int, models.GameScore, bool) {
+	for i, score := range m.scores {
+		if score.UserID == userID {
+			return i + 1, score, true
+		}
+	}
+	return 0, models.GameScore{}, false
+}
+
+func (m *MockRepository) GetAround(userID string, n int) ([]models.GameScore, int) {
+	return m.scores, 1
+}
+
 func (m *MockRepository) Clear() error {
 	m.scores = []models.GameScore{}
 	return nil
 }
 
+func (m *MockRepository) Ping() error {
+	return nil
+}
+
 func TestStateServiceV2_VoteLogic(t *testing.T) {
 	// 1. 初始化依賴
 	mockRepo := &MockRepository{}
@@ -49,7 +73,7 @@ func TestStateServiceV2_VoteLogic(t *testing.T) {
 	// 為了測試邏輯，不需要真實的 WorkerPool 或 RateLimiter
 	// 但 NewStateServiceWithDeps 需要它們
 	wp := pool.NewWorkerPool(1, 1)
-	rl := ratelimit.NewRateLimiter(10, time.Second, false)
+	rl := ratelimit.NewMessageLimiter(config.RateLimitConfig{})
 	mt := metrics.GetMetrics()
 	broadcastChan := make(chan models.Message, 10)
 
@@ -120,7 +144,7 @@ func TestStateServiceV2_GameScore(t *testing.T) {
 	mockRepo := &MockRepository{}
 	cfg := &config.Config{}
 	wp := pool.NewWorkerPool(1, 1)
-	rl := ratelimit.NewRateLimiter(10, time.Second, false)
+	rl := ratelimit.NewMessageLimiter(config.RateLimitConfig{})
 	mt := metrics.GetMetrics()
 	broadcastChan := make(chan models.Message, 10)
 
@@ -148,7 +172,7 @@ func TestStateServiceV2_QuizLogic(t *testing.T) {
 	mockRepo := &MockRepository{}
 	cfg := &config.Config{}
 	wp := pool.NewWorkerPool(1, 1)
-	rl := ratelimit.NewRateLimiter(10, time.Second, false)
+	rl := ratelimit.NewMessageLimiter(config.RateLimitConfig{})
 	mt := metrics.GetMetrics()
 	broadcastChan := make(chan models.Message, 10)
 
@@ -216,3 +240,237 @@ func TestStateServiceV2_QuizLogic(t *testing.T) {
 		t.Error("Quiz should be inactive after correct answer")
 	}
 }
+
+func TestStateServiceV2_ShutdownDrain(t *testing.T) {
+	mockRepo := &MockRepository{}
+	cfg := &config.Config{}
+	wp := pool.NewWorkerPool(1, 1)
+	rl := ratelimit.NewMessageLimiter(config.RateLimitConfig{})
+	mt := metrics.GetMetrics()
+	broadcastChan := make(chan models.Message, 10)
+
+	service := NewStateServiceWithDeps(broadcastChan, mockRepo, wp, rl, mt, cfg)
+
+	// 關機前已排隊的訊息
+	broadcastChan <- models.Message{
+		Type: "vote", Room: "drain_room", Question: "Still here?", Options: []string{"Yes"},
+	}
+
+	service.BeginShutdown(time.Second)
+	if !service.IsDraining() {
+		t.Fatal("Service should be draining after BeginShutdown")
+	}
+
+	if drained := service.DrainPending(); drained != 1 {
+		t.Errorf("Expected 1 drained message, got %d", drained)
+	}
+
+	service.VotesMutex.RLock()
+	_, exists := service.Votes["drain_room"]
+	service.VotesMutex.RUnlock()
+	if !exists {
+		t.Error("Queued vote should be processed during drain")
+	}
+
+	mockRepo.scores = []models.GameScore{{Nickname: "Keeper", Tries: 1}}
+	if err := service.FlushStorage(); err != nil {
+		t.Fatalf("FlushStorage failed: %v", err)
+	}
+	if len(mockRepo.scores) != 1 {
+		t.Errorf("Expected leaderboard to be kept after flush, got %d scores", len(mockRepo.scores))
+	}
+
+	// 循環從未啟動時不應阻塞
+	if err := service.WaitLoopStopped(context.Background()); err != nil {
+		t.Errorf("WaitLoopStopped should return immediately, got %v", err)
+	}
+}
+
+func TestStateServiceV2_IdlePresence(t *testing.T) {
+	cfg := &config.Config{}
+	wp := pool.NewWorkerPool(1, 1)
+	rl := ratelimit.NewMessageLimiter(config.RateLimitConfig{})
+	service := NewStateServiceWithDeps(make(chan models.Message, 10), &MockRepository{}, wp, rl, metrics.GetMetrics(), cfg)
+
+	client := &models.Client{Nickname: "Sleepy", UserID: "SLPY0001"}
+	service.trackConnection(client)
+
+	if err := service.SetStatus(client, "busy"); err != nil {
+		t.Fatalf("SetStatus failed: %v", err)
+	}
+	if err := service.SetStatus(client, "idle"); err == nil {
+		t.Error("Users should not be able to set idle manually")
+	}
+
+	service.markIdleUsers(0)
+	if status := service.StatusOf(client); status != StatusIdle {
+		t.Errorf("Expected idle after inactivity, got %s", status)
+	}
+
+	// 有活動後恢復原本設定的狀態
+	service.Touch(client)
+	if status := service.StatusOf(client); status != StatusBusy {
+		t.Errorf("Expected busy after activity, got %s", status)
+	}
+}
+
+func TestStateServiceV2_RoomPasswordLockout(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Room.PasswordMaxAttempts = 3
+	cfg.Room.PasswordLockout = time.Minute
+	wp := pool.NewWorkerPool(1, 1)
+	rl := ratelimit.NewMessageLimiter(config.RateLimitConfig{})
+	service := NewStateServiceWithDeps(make(chan models.Message, 10), &MockRepository{}, wp, rl, metrics.GetMetrics(), cfg)
+
+	if err := service.setRoomPassword("secret_room", strings.Repeat("x", 73)); !errors.Is(err, apperrors.ErrPasswordTooLong) {
+		t.Errorf("Expected password_too_long, got %v", err)
+	}
+	if err := service.CreateRoom(&models.Client{UserID: "OWNR0008"}, "secret_room", strings.Repeat("x", 73), models.RoomSettings{}); !errors.Is(err, apperrors.ErrPasswordTooLong) {
+		t.Errorf("Expected CreateRoom to reject a long password, got %v", err)
+	}
+	if _, ok := service.RoomMeta["secret_room"]; ok {
+		t.Error("Room should not be created when the password is rejected")
+	}
+	if err := service.setRoomPassword("secret_room", "hunter2"); err != nil {
+		t.Fatalf("setRoomPassword failed: %v", err)
+	}
+	if stored := service.RoomPasswords["secret_room"]; stored == "hunter2" || stored == "" {
+		t.Fatalf("Expected a hashed password, got %q", stored)
+	}
+
+	client := &models.Client{Nickname: "Mallory", UserID: "MALL0001"}
+	if err := service.verifyRoomPassword(client, "secret_room", ""); !errors.Is(err, apperrors.ErrPasswordRequired) {
+		t.Errorf("Expected password_required, got %v", err)
+	}
+	if err := service.verifyRoomPassword(client, "secret_room", "hunter2"); err != nil {
+		t.Errorf("Correct password rejected: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := service.verifyRoomPassword(client, "secret_room", "guess"); !errors.Is(err, apperrors.ErrWrongPassword) {
+			t.Errorf("Attempt %d: expected wrong_password, got %v", i+1, err)
+		}
+	}
+	if err := service.verifyRoomPassword(client, "secret_room", "guess"); !errors.Is(err, apperrors.ErrPasswordLockedOut) {
+		t.Errorf("Expected password_locked_out, got %v", err)
+	}
+
+	// 鎖定期間即使密碼正確也拒絕
+	if err := service.verifyRoomPassword(client, "secret_room", "hunter2"); !errors.Is(err, apperrors.ErrPasswordLockedOut) {
+		t.Errorf("Expected lockout to hold, got %v", err)
+	}
+	if service.PasswordLockedFor(client, "secret_room") <= 0 {
+		t.Error("Expected remaining lockout time")
+	}
+
+	// 鎖定只針對該使用者
+	other := &models.Client{Nickname: "Alice", UserID: "ALIC0002"}
+	if err := service.verifyRoomPassword(other, "secret_room", "hunter2"); err != nil {
+		t.Errorf("Other users should not be locked out: %v", err)
+	}
+
+	// 同一 IP 換使用者 ID 重試也會被鎖定
+	for i := 0; i < 3; i++ {
+		rotating := &models.Client{Nickname: "Mallory", UserID: fmt.Sprintf("ROTA%04d", i), IP: "198.51.100.7"}
+		service.verifyRoomPassword(rotating, "secret_room", "guess")
+	}
+	fresh := &models.Client{Nickname: "Mallory", UserID: "ROTA9999", IP: "198.51.100.7"}
+	if err := service.verifyRoomPassword(fresh, "secret_room", "hunter2"); !errors.Is(err, apperrors.ErrPasswordLockedOut) {
+		t.Errorf("Expected the IP to be locked out, got %v", err)
+	}
+
+	// 超過計算時間的錯誤不累積，過期記錄會被清除
+	typo := &models.Client{Nickname: "Typo", UserID: "TYPO0001"}
+	for i := 0; i < 2; i++ {
+		service.verifyRoomPassword(typo, "secret_room", "guess")
+	}
+	typoKey := passwordAttemptKeys("secret_room", typo)[0]
+	service.passwordAttempts[typoKey].firstFailure = time.Now().Add(-2 * time.Minute)
+	if err := service.verifyRoomPassword(typo, "secret_room", "guess"); !errors.Is(err, apperrors.ErrWrongPassword) {
+		t.Errorf("Old failures should not count toward a lockout, got %v", err)
+	}
+	service.passwordAttempts[typoKey].firstFailure = time.Now().Add(-2 * time.Minute)
+	service.prunePasswordAttempts()
+	if _, ok := service.passwordAttempts[typoKey]; ok {
+		t.Error("Expected the stale attempt record to be pruned")
+	}
+	if _, ok := service.passwordAttempts[passwordAttemptKeys("secret_room", client)[0]]; !ok {
+		t.Error("Active lockouts should not be pruned")
+	}
+
+	// 受邀成員不需要密碼
+	service.RoomMeta["secret_room"] = newRoomMeta("secret_room", "OWNR0005")
+	service.RoomMeta["secret_room"].Invited["MALL0001"] = true
+	if err := service.verifyRoomPassword(client, "secret_room", ""); err != nil {
+		t.Errorf("Invited users should skip the password: %v", err)
+	}
+}
+
+func TestStateServiceV2_InviteCleanup(t *testing.T) {
+	cfg := &config.Config{}
+	wp := pool.NewWorkerPool(1, 1)
+	rl := ratelimit.NewMessageLimiter(config.RateLimitConfig{})
+	service := NewStateServiceWithDeps(make(chan models.Message, 10), &MockRepository{}, wp, rl, metrics.GetMetrics(), cfg)
+
+	meta := newRoomMeta("invite_room", "OWNR0006")
+	meta.Invites["expired"] = &models.Invite{Token: "expired", Room: "invite_room", ExpiresAt: time.Now().Add(-time.Minute)}
+	meta.Invites["used"] = &models.Invite{Token: "used", Room: "invite_room", MaxUses: 1, Uses: 1}
+	meta.Invites["found"] = &models.Invite{Token: "found", Room: "invite_room", MaxUses: 2, Uses: 2}
+	meta.Invites["valid"] = &models.Invite{Token: "valid", Room: "invite_room", MaxUses: 2, Uses: 1}
+	service.RoomMeta["invite_room"] = meta
+
+	// 查到時回報原因並刪除
+	if _, err := service.LookupInvite("found"); !errors.Is(err, apperrors.ErrInviteExhausted) {
+		t.Errorf("Expected invite_exhausted, got %v", err)
+	}
+	if _, err := service.LookupInvite("found"); !errors.Is(err, apperrors.ErrInviteInvalid) {
+		t.Errorf("Expected the exhausted invite to be deleted, got %v", err)
+	}
+
+	// 定期清除
+	service.pruneInvites()
+	if len(meta.Invites) != 1 || meta.Invites["valid"] == nil {
+		t.Errorf("Expected only the valid invite to remain, got %v", meta.Invites)
+	}
+}
+
+func TestStateServiceV2_HistoryPersistence(t *testing.T) {
+	store, err := repository.OpenBoltStore(filepath.Join(t.TempDir(), "chatroom.db"), repository.BoltOptions{})
+	if err != nil {
+		t.Fatalf("OpenBoltStore failed: %v", err)
+	}
+	defer store.Close()
+
+	cfg := config.Default()
+	cfg.Storage.HistoryMaxSize = 3
+	newService := func() *StateServiceV2 {
+		s := NewStateServiceWithDeps(make(chan models.Message, 10), &MockRepository{}, pool.NewWorkerPool(1, 1),
+			ratelimit.NewMessageLimiter(cfg.RateLimit), metrics.GetMetrics(), cfg)
+		if err := s.SetHistoryRepository(store.History()); err != nil {
+			t.Fatalf("SetHistoryRepository failed: %v", err)
+		}
+		s.SetProfileRepository(store.Profiles())
+		return s
+	}
+
+	first := newService()
+	var last models.Message
+	for i := 0; i < 5; i++ {
+		last = first.AddHistory(models.Message{Type: "chat", Room: "persist_room", Content: "hi"})
+	}
+	first.deleteHistoryMessage("persist_room", last.ID-1)
+	first.saveProfile(&models.Client{UserID: "u1", Nickname: "Alice", Level: 2})
+
+	// 重新啟動後載入最近的記錄，訊息 ID 接續上次的值
+	second := newService()
+	history := second.History["persist_room"]
+	if len(history) != 2 || history[0].ID != last.ID-2 || history[1].ID != last.ID {
+		t.Fatalf("Expected 2 restored messages ending at %d, got %+v", last.ID, history)
+	}
+	if next := second.AddHistory(models.Message{Type: "chat", Room: "persist_room"}); next.ID != last.ID+1 {
+		t.Errorf("Expected next ID %d, got %d", last.ID+1, next.ID)
+	}
+	if profile, ok := second.Profile("u1"); !ok || profile.Nickname != "Alice" || profile.FirstSeen.IsZero() {
+		t.Errorf("Expected stored profile, got %+v (ok=%v)", profile, ok)
+	}
+}
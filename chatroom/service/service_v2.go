@@ -2,6 +2,7 @@ package service
 
 import (
 	"chatroom/config"
+	apperrors "chatroom/errors"
 	"chatroom/logger"
 	"chatroom/metrics"
 	"chatroom/models"
@@ -13,6 +14,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -29,6 +31,7 @@ type StateServiceV2 struct {
 
 	DrawStates    map[string]*models.DrawState
 	RoomPasswords map[string]string
+	RoomMeta      map[string]*models.Room
 
 	// 互斥鎖
 	RoomsMutex         sync.RWMutex
@@ -37,13 +40,65 @@ type StateServiceV2 struct {
 	QuizzesMutex       sync.RWMutex
 	DrawStateMutex     sync.RWMutex
 	RoomPasswordsMutex sync.RWMutex
+	RoomMetaMutex      sync.RWMutex
 
 	// 新增依賴
-	leaderboardRepo repository.LeaderboardRepository
+	leaderboardRepo repository.LeaderboardRepository // 猜數字總榜
+	leaderboards    atomic.Pointer[repository.Leaderboards]
+	roomRepo        repository.RoomRepository
+	roomPersistMu   sync.Mutex
+	historyRepo     repository.HistoryRepository // 由 HistoryMutex 保護，nil 表示只保存在記憶體
+	profileRepo     repository.ProfileRepository
+	ProfilesMutex   sync.RWMutex
+	blobStore       repository.BlobStore // 上傳的圖片與語音，由 BlobsMutex 保護
+	BlobsMutex      sync.RWMutex
 	workerPool      *pool.WorkerPool
-	rateLimiter     *ratelimit.RateLimiter
+	rateLimiter     *ratelimit.MessageLimiter
 	metrics         *metrics.Metrics
 	config          *config.Config
+
+	// 訊息循環是否正在執行
+	loopRunning atomic.Bool
+	loopStarted atomic.Bool
+	loopDone    chan struct{}
+
+	// 關機中：不再接受新的訊息
+	draining atomic.Bool
+
+	// 歷史訊息 ID 產生器
+	lastMessageID atomic.Int64
+
+	// 可恢復的連線 session
+	sessions      map[string]*session
+	SessionsMutex sync.Mutex
+
+	// 使用者層級在線狀態：使用者 ID -> 連線集合
+	Presence      map[string]*userPresence
+	PresenceMutex sync.RWMutex
+
+	// 輸入提示狀態：房間 + 使用者 -> 狀態
+	typing      map[string]*typingState
+	TypingMutex sync.Mutex
+
+	// 已讀位置：使用者 -> 房間 -> 最後已讀訊息 ID
+	readMarks      map[string]map[string]int64
+	ReadMarksMutex sync.RWMutex
+
+	// 房間密碼錯誤記錄：房間 + 使用者 -> 錯誤次數
+	passwordAttempts      map[string]*passwordAttempt
+	PasswordAttemptsMutex sync.Mutex
+
+	// 已滿房間的等候名單：房間 -> 依序等候的連線
+	waitlists     map[string][]waitlistEntry
+	WaitlistMutex sync.Mutex
+
+	// 限流違規記錄：使用者（或連線）-> 違規次數與禁言狀態
+	violations      map[string]*rateLimitViolation
+	ViolationsMutex sync.Mutex
+
+	// 可在執行中重新載入的配置，其餘配置啟動後不再變更
+	rateLimitConfig atomic.Pointer[config.RateLimitConfig]
+	historyMaxSize  atomic.Int64
 }
 
 // NewStateServiceWithDeps 使用依賴注入創建服務
@@ -51,24 +106,37 @@ func NewStateServiceWithDeps(
 	broadcastChan chan models.Message,
 	repo repository.LeaderboardRepository,
 	pool *pool.WorkerPool,
-	limiter *ratelimit.RateLimiter,
+	limiter *ratelimit.MessageLimiter,
 	metrics *metrics.Metrics,
 	cfg *config.Config,
 ) *StateServiceV2 {
 	s := &StateServiceV2{
-		Rooms:           make(map[string]map[*models.Client]bool),
-		History:         make(map[string][]models.Message),
-		Votes:           make(map[string]*models.Vote),
-		Quizzes:         make(map[string]*models.Quiz),
-		Broadcast:       broadcastChan,
-		DrawStates:      make(map[string]*models.DrawState),
-		RoomPasswords:   make(map[string]string),
-		leaderboardRepo: repo,
-		workerPool:      pool,
-		rateLimiter:     limiter,
-		metrics:         metrics,
-		config:          cfg,
+		Rooms:            make(map[string]map[*models.Client]bool),
+		History:          make(map[string][]models.Message),
+		Votes:            make(map[string]*models.Vote),
+		Quizzes:          make(map[string]*models.Quiz),
+		Broadcast:        broadcastChan,
+		DrawStates:       make(map[string]*models.DrawState),
+		RoomPasswords:    make(map[string]string),
+		RoomMeta:         make(map[string]*models.Room),
+		leaderboardRepo:  repo,
+		workerPool:       pool,
+		rateLimiter:      limiter,
+		metrics:          metrics,
+		config:           cfg,
+		loopDone:         make(chan struct{}),
+		sessions:         make(map[string]*session),
+		Presence:         make(map[string]*userPresence),
+		typing:           make(map[string]*typingState),
+		readMarks:        make(map[string]map[string]int64),
+		passwordAttempts: make(map[string]*passwordAttempt),
+		waitlists:        make(map[string][]waitlistEntry),
+		violations:       make(map[string]*rateLimitViolation),
 	}
+	rateLimit := cfg.RateLimit
+	s.rateLimitConfig.Store(&rateLimit)
+	s.historyMaxSize.Store(int64(cfg.Storage.HistoryMaxSize))
+	s.leaderboards.Store(repository.NewLeaderboards(repository.DefaultBoards(cfg.Storage.LeaderboardSize), repo, nil))
 
 	logger.Info("StateService initialized with dependencies")
 	return s
@@ -77,6 +145,13 @@ func NewStateServiceWithDeps(
 // HandleMessageLoopWithContext 帶上下文的訊息處理循環
 func (s *StateServiceV2) HandleMessageLoopWithContext(ctx context.Context) {
 	logger.Info("Starting message loop")
+	s.loopStarted.Store(true)
+	s.loopRunning.Store(true)
+	defer close(s.loopDone)
+	defer s.loopRunning.Store(false)
+
+	go s.presenceLoop(ctx)
+	go s.cleanupLoop(ctx)
 
 	for {
 		select {
@@ -86,32 +161,72 @@ func (s *StateServiceV2) HandleMessageLoopWithContext(ctx context.Context) {
 				logger.Info("Broadcast channel closed")
 				return
 			}
-			// 使用 worker pool 處理訊息
-			s.workerPool.Submit(func() {
-				start := time.Now()
-				s.ProcessMessage(msg)
-				s.metrics.RecordLatency(time.Since(start))
-			})
+			s.submitMessage(msg)
 
 		case <-ctx.Done():
-			logger.Info("Message loop stopped by context")
+			// 把已排隊的訊息交給 worker pool 後再結束
+			drained := s.drainBroadcast(s.submitMessage)
+			logger.Info("Message loop stopped by context", zap.Int("drained", drained))
 			return
 		}
 	}
 }
 
+// cleanupInterval 定期清除過期狀態的間隔
+const cleanupInterval = time.Minute
+
+// cleanupLoop 定期清除過期或用完的邀請連結與過期的密碼錯誤記錄
+func (s *StateServiceV2) cleanupLoop(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.pruneInvites()
+			s.prunePasswordAttempts()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// submitMessage 使用 worker pool 處理訊息
+func (s *StateServiceV2) submitMessage(msg models.Message) {
+	s.workerPool.Submit(func() {
+		start := time.Now()
+		s.ProcessMessage(msg)
+		s.metrics.RecordLatency(time.Since(start))
+	})
+}
+
+// IsLoopRunning 訊息處理循環是否正在執行
+func (s *StateServiceV2) IsLoopRunning() bool {
+	return s.loopRunning.Load()
+}
+
+// Metrics 取得服務使用的指標
+func (s *StateServiceV2) Metrics() *metrics.Metrics {
+	return s.metrics
+}
+
+// CheckStorage 檢查排行榜儲存是否可讀取
+func (s *StateServiceV2) CheckStorage() error {
+	return s.leaderboardRepo.Ping()
+}
+
 // broadcastMessage 廣播訊息到房間
 func (s *StateServiceV2) broadcastMessage(msg models.Message) {
+	// 在鎖內複製成員列表，避免與註冊/切換房間同時存取 map
 	s.RoomsMutex.RLock()
-	clients := s.Rooms[msg.Room]
-	s.RoomsMutex.RUnlock()
-
-	if clients == nil {
-		return
+	clients := make([]*models.Client, 0, len(s.Rooms[msg.Room]))
+	for client := range s.Rooms[msg.Room] {
+		clients = append(clients, client)
 	}
+	s.RoomsMutex.RUnlock()
 
 	// 廣播給所有客戶端
-	for client := range clients {
+	for _, client := range clients {
 		if !s.safeWriteJSON(client, msg) {
 			s.metrics.IncrementMessagesFailed()
 		} else {
@@ -120,6 +235,24 @@ func (s *StateServiceV2) broadcastMessage(msg models.Message) {
 	}
 }
 
+// sendToRoomExcept 直接推送訊息給房間中除了指定使用者以外的成員
+func (s *StateServiceV2) sendToRoomExcept(msg models.Message, except *models.Client) {
+	exceptKey := presenceKey(except)
+
+	s.RoomsMutex.RLock()
+	clients := make([]*models.Client, 0, len(s.Rooms[msg.Room]))
+	for c := range s.Rooms[msg.Room] {
+		if presenceKey(c) != exceptKey {
+			clients = append(clients, c)
+		}
+	}
+	s.RoomsMutex.RUnlock()
+
+	for _, c := range clients {
+		s.safeWriteJSON(c, msg)
+	}
+}
+
 // safeWriteJSON 安全地寫入 JSON
 func (s *StateServiceV2) safeWriteJSON(client *models.Client, msg models.Message) bool {
 	client.Mu.Lock()
@@ -138,17 +271,59 @@ func (s *StateServiceV2) safeWriteJSON(client *models.Client, msg models.Message
 	return true
 }
 
-// RegisterClient 註冊客戶端
-func (s *StateServiceV2) RegisterClient(client *models.Client) {
+// RegisterClient 註冊客戶端；全站人數已滿時回傳 ErrRoomFull。
+// 無法進入指定房間（含密碼房間未提供正確密碼）時改為進入大廳，denied 為原因
+func (s *StateServiceV2) RegisterClient(client *models.Client, password string) (denied error, err error) {
+	// 全站上限只計算新使用者，同一使用者的其他分頁不受影響
+	if maxTotal := s.config.Room.MaxTotalMembers; maxTotal > 0 && len(s.userConnections(presenceKey(client))) == 0 {
+		if s.OnlineUsers() >= maxTotal {
+			logger.Warn("Client rejected, server full",
+				zap.String("nickname", client.Nickname),
+				zap.Int("max_total", maxTotal))
+			return nil, apperrors.ErrRoomFull
+		}
+	}
+
+	// 未指定房間時進入大廳
+	if client.Room == "" {
+		client.Room = s.lobbyRoom()
+	}
+
+	// 無法進入指定房間的使用者（封鎖、僅限受邀、人數已滿、密碼錯誤）改為進入大廳
+	denied = s.checkRoomAccess(client.Room, client)
+	if denied == nil {
+		denied = s.verifyRoomPassword(client, client.Room, password)
+	}
+	if denied != nil {
+		logger.Warn("Client redirected to lobby",
+			zap.String("nickname", client.Nickname),
+			zap.String("room", client.Room),
+			zap.Error(denied))
+		client.Room = s.lobbyRoom()
+	}
+
+	// 檢查到加入之間可能有其他人進入，在寫入鎖內再次確認人數，已滿時改為進入大廳
+	maxMembers := s.roomCapacity(client.Room)
 	s.RoomsMutex.Lock()
+	if roomFullLocked(s.Rooms[client.Room], presenceKey(client), maxMembers) {
+		logger.Warn("Client redirected to lobby",
+			zap.String("nickname", client.Nickname),
+			zap.String("room", client.Room),
+			zap.Error(apperrors.ErrRoomFull))
+		denied = apperrors.ErrRoomFull
+		client.Room = s.lobbyRoom()
+	}
 	if s.Rooms[client.Room] == nil {
 		s.Rooms[client.Room] = make(map[*models.Client]bool)
 		s.metrics.IncrementRooms()
+		s.createRoomMeta(client.Room, client)
 	}
 	s.Rooms[client.Room][client] = true
 	s.RoomsMutex.Unlock()
 
+	s.trackConnection(client)
 	s.metrics.IncrementConnections()
+	s.saveProfile(client)
 
 	if !strings.HasPrefix(client.Room, "_") {
 		s.BroadcastRoomList()
@@ -157,11 +332,13 @@ func (s *StateServiceV2) RegisterClient(client *models.Client) {
 	logger.Info("Client registered",
 		zap.String("nickname", client.Nickname),
 		zap.String("room", client.Room))
+	return denied, nil
 }
 
 // UnregisterClient 取消註冊客戶端
 func (s *StateServiceV2) UnregisterClient(client *models.Client) string {
 	roomToUpdate := client.Room
+	s.markRoomRead(client, roomToUpdate)
 
 	s.RoomsMutex.Lock()
 	delete(s.Rooms[roomToUpdate], client)
@@ -169,6 +346,7 @@ func (s *StateServiceV2) UnregisterClient(client *models.Client) string {
 	if roomIsEmpty {
 		delete(s.Rooms, roomToUpdate)
 		s.metrics.DecrementRooms()
+		s.deleteRoomMeta(roomToUpdate)
 
 		if roomToUpdate == "_draw_game_" {
 			s.DrawStateMutex.Lock()
@@ -178,12 +356,17 @@ func (s *StateServiceV2) UnregisterClient(client *models.Client) string {
 	}
 	s.RoomsMutex.Unlock()
 
+	s.untrackConnection(client)
 	s.metrics.DecrementConnections()
+	s.LeaveWaitlist(client)
 
 	if !strings.HasPrefix(roomToUpdate, "_") {
 		s.BroadcastRoomList()
 	}
 
+	// 空出的位置讓等候中的使用者進入
+	s.admitWaitlisted(roomToUpdate)
+
 	logger.Info("Client unregistered",
 		zap.String("nickname", client.Nickname),
 		zap.String("room", roomToUpdate),
@@ -198,70 +381,77 @@ func (s *StateServiceV2) SwitchRoom(client *models.Client, newRoom, password str
 	isSwitchingToGame := strings.HasPrefix(newRoom, "_")
 	isSwitchingFromGame := strings.HasPrefix(oldRoom, "_")
 
-	// 檢查密碼
-	s.RoomPasswordsMutex.RLock()
-	expectedPassword, passwordRequired := s.RoomPasswords[newRoom]
-	s.RoomPasswordsMutex.RUnlock()
+	if err := s.checkRoomAccess(newRoom, client); err != nil {
+		logger.Warn("Room access denied",
+			zap.String("room", newRoom),
+			zap.String("nickname", client.Nickname),
+			zap.Error(err))
+		return "", err
+	}
 
-	// 檢查房間是否存在
+	// 檢查房間是否存在；沒有成員的永久房間仍保有 RoomMeta，不算新房間
 	s.RoomsMutex.RLock()
 	_, roomExists := s.Rooms[newRoom]
 	s.RoomsMutex.RUnlock()
+	s.RoomMetaMutex.RLock()
+	_, hasMeta := s.RoomMeta[newRoom]
+	s.RoomMetaMutex.RUnlock()
 
-	isNewRoom := !roomExists
+	isNewRoom := !roomExists && !hasMeta
 
 	// 驗證密碼
-	if passwordRequired {
-		if password != expectedPassword {
-			errorType := "wrong_password"
-			if password == "" {
-				errorType = "password_required"
-			}
-			logger.Warn("Password verification failed",
-				zap.String("room", newRoom),
-				zap.String("error", errorType))
-			return "", fmt.Errorf("%s", errorType)
-		}
-	} else if isNewRoom && password != "" {
-		// 新房間設置密碼
-		s.RoomPasswordsMutex.Lock()
-		s.RoomPasswords[newRoom] = password
-		s.RoomPasswordsMutex.Unlock()
-		logger.Info("Room password set", zap.String("room", newRoom))
+	if err := s.verifyRoomPassword(client, newRoom, password); err != nil {
+		logger.Warn("Password verification failed",
+			zap.String("room", newRoom),
+			zap.String("error", err.Error()))
+		return "", err
 	}
-
-	// 發送離開訊息
-	if !isSwitchingFromGame {
-		leaveMsg := models.Message{
-			Type:      "leave",
-			Room:      oldRoom,
-			Content:   client.Nickname + " 離開了聊天室",
-			Timestamp: time.Now().Format("15:04"),
+	if isNewRoom && password != "" {
+		// 新房間設置密碼（只保存雜湊）；既有房間只能由擁有者或管理員以 set_password 變更
+		if err := s.setRoomPassword(newRoom, password); err != nil {
+			return "", err
 		}
-		s.Broadcast <- leaveMsg
+		logger.Info("Room password set", zap.String("room", newRoom))
 	}
 
-	// 從舊房間移除並加入新房間
+	// 從舊房間移除並加入新房間；檢查到加入之間可能有其他人進入，在寫入鎖內再次確認人數
+	maxMembers := s.roomCapacity(newRoom)
 	s.RoomsMutex.Lock()
+	if roomFullLocked(s.Rooms[newRoom], presenceKey(client), maxMembers) {
+		s.RoomsMutex.Unlock()
+		logger.Warn("Room access denied",
+			zap.String("room", newRoom),
+			zap.String("nickname", client.Nickname),
+			zap.Error(apperrors.ErrRoomFull))
+		return "", apperrors.ErrRoomFull
+	}
 	delete(s.Rooms[oldRoom], client)
 	if len(s.Rooms[oldRoom]) == 0 {
 		delete(s.Rooms, oldRoom)
 		s.metrics.DecrementRooms()
 
-		// 清理空房間的密碼
-		s.RoomPasswordsMutex.Lock()
-		delete(s.RoomPasswords, oldRoom)
-		s.RoomPasswordsMutex.Unlock()
+		// 清理空房間的密碼（永久房間保留）
+		if !s.isPersistentRoom(oldRoom) {
+			s.RoomPasswordsMutex.Lock()
+			delete(s.RoomPasswords, oldRoom)
+			s.RoomPasswordsMutex.Unlock()
+		}
+		s.deleteRoomMeta(oldRoom)
 	}
 
 	client.Room = newRoom
 	if s.Rooms[newRoom] == nil {
 		s.Rooms[newRoom] = make(map[*models.Client]bool)
 		s.metrics.IncrementRooms()
+		s.createRoomMeta(newRoom, client)
 	}
 	s.Rooms[newRoom][client] = true
 	s.RoomsMutex.Unlock()
 
+	// 發送離開訊息（同一使用者在舊房間還有其他分頁時不發送）
+	s.AnnounceLeave(client, oldRoom)
+	s.markRoomRead(client, oldRoom)
+
 	// 更新房間列表和在線人數
 	if !isSwitchingFromGame || !isSwitchingToGame {
 		s.BroadcastRoomList()
@@ -274,21 +464,30 @@ func (s *StateServiceV2) SwitchRoom(client *models.Client, newRoom, password str
 		zap.String("to", newRoom),
 		zap.Bool("new_room", isNewRoom))
 
+	// 已進入其他房間就不再排隊，並讓等候舊房間的使用者進入
+	s.LeaveWaitlist(client)
+	s.admitWaitlisted(oldRoom)
+
 	return oldRoom, nil
 }
 
-// AddHistory 添加歷史記錄
-func (s *StateServiceV2) AddHistory(msg models.Message) {
+// AddHistory 添加歷史記錄，回傳分配了 ID 的訊息
+func (s *StateServiceV2) AddHistory(msg models.Message) models.Message {
 	s.HistoryMutex.Lock()
-	defer s.HistoryMutex.Unlock()
-
+	msg.ID = s.lastMessageID.Add(1)
 	s.History[msg.Room] = append(s.History[msg.Room], msg)
 
 	// 限制歷史記錄大小
-	maxSize := s.config.Storage.HistoryMaxSize
+	maxSize := int(s.historyMaxSize.Load())
 	if len(s.History[msg.Room]) > maxSize {
 		s.History[msg.Room] = s.History[msg.Room][len(s.History[msg.Room])-maxSize:]
 	}
+	repo := s.historyRepo
+	s.HistoryMutex.Unlock()
+
+	// 在鎖外寫入儲存，避免磁碟延遲阻塞其他房間
+	s.persistHistory(repo, msg, maxSize)
+	return msg
 }
 
 // SendHistory 發送歷史記錄
@@ -300,50 +499,53 @@ func (s *StateServiceV2) SendHistory(client *models.Client) {
 	for _, msg := range history {
 		s.safeWriteJSON(client, msg)
 	}
+	s.markRoomRead(client, client.Room)
 
 	logger.Debug("History sent",
 		zap.String("room", client.Room),
 		zap.Int("count", len(history)))
 }
 
-// CheckRateLimitexceeded 檢查限流
-func (s *StateServiceV2) CheckRateLimit(clientID string) bool {
-	if !s.rateLimiter.Allow(clientID) {
-		s.metrics.IncrementRateLimitErrors()
-		logger.Warn("Rate limit exceeded", zap.String("client_id", clientID))
-		return false
+// SendHistorySince 只發送 ID 大於 afterID 的歷史記錄
+func (s *StateServiceV2) SendHistorySince(client *models.Client, afterID int64) int {
+	s.HistoryMutex.RLock()
+	history := s.History[client.Room]
+	missed := make([]models.Message, 0)
+	for _, msg := range history {
+		if msg.ID > afterID {
+			missed = append(missed, msg)
+		}
 	}
-	return true
+	s.HistoryMutex.RUnlock()
+
+	for _, msg := range missed {
+		s.safeWriteJSON(client, msg)
+	}
+
+	logger.Debug("Missed history sent",
+		zap.String("room", client.Room),
+		zap.Int64("after_id", afterID),
+		zap.Int("count", len(missed)))
+
+	return len(missed)
 }
 
 // BroadcastRoomList 廣播房間列表
 func (s *StateServiceV2) BroadcastRoomList() {
-	// 先收集房間資訊，避免長時間持有鎖
-	roomInfo := make(map[string]bool)
-
-	// 確保聊天大廳始終在列表中
-	roomInfo["聊天大廳"] = false
-
-	s.RoomsMutex.RLock()
-	roomNames := make([]string, 0, len(s.Rooms))
-	for roomName := range s.Rooms {
-		if !strings.HasPrefix(roomName, "_") {
-			roomNames = append(roomNames, roomName)
-		}
-	}
-	s.RoomsMutex.RUnlock()
+	// 先收集房間資訊（含聊天大廳與沒有人的永久房間），避免長時間持有鎖
+	summaries := s.roomSummaries()
 
-	// 檢查每個房間是否有密碼
-	s.RoomPasswordsMutex.RLock()
-	for _, roomName := range roomNames {
-		roomInfo[roomName] = s.RoomPasswords[roomName] != ""
+	// roomInfo 保留給舊版客戶端：房間名稱 -> 是否有密碼
+	roomInfo := make(map[string]bool, len(summaries))
+	for _, summary := range summaries {
+		roomInfo[summary.Name] = summary.Locked
 	}
-	s.RoomPasswordsMutex.RUnlock()
 
 	// 建立訊息
 	msg := models.Message{
 		Type:     "room_list",
 		RoomInfo: roomInfo,
+		Rooms:    summaries,
 	}
 
 	// 廣播給所有非遊戲房間的客戶端
@@ -358,9 +560,11 @@ func (s *StateServiceV2) BroadcastRoomList() {
 	}
 	s.RoomsMutex.RUnlock()
 
-	// 發送訊息
+	// 發送訊息，附上每位使用者各自的未讀數
 	for _, client := range allClients {
-		s.safeWriteJSON(client, msg)
+		clientMsg := msg
+		clientMsg.Unread = s.UnreadCounts(client)
+		s.safeWriteJSON(client, clientMsg)
 	}
 }
 
@@ -369,10 +573,11 @@ func (s *StateServiceV2) BroadcastOnlineCount() {
 	s.RoomsMutex.RLock()
 	defer s.RoomsMutex.RUnlock()
 
+	// 以不重複的使用者計算，同一使用者的多個分頁只算一人
 	roomCounts := make(map[string]int)
 	for room, clients := range s.Rooms {
 		if !strings.HasPrefix(room, "_") {
-			roomCounts[room] = len(clients)
+			roomCounts[room] = countUsersInRoom(clients)
 		}
 	}
 
@@ -391,19 +596,16 @@ func (s *StateServiceV2) BroadcastOnlineCount() {
 	}
 }
 
-// UpdateLeaderboard 更新排行榜
-func (s *StateServiceV2) UpdateLeaderboard(score models.GameScore) {
-	if err := s.leaderboardRepo.Add(score); err != nil {
-		logger.Error("Failed to update leaderboard", zap.Error(err))
+// UpdateLeaderboard 記錄猜數字的成績並在大廳公告
+func (s *StateServiceV2) UpdateLeaderboard(room string, score models.GameScore) {
+	if err := s.RecordScore(repository.BoardGuessNumber, room, score); err != nil {
 		return
 	}
 
-	s.broadcastLeaderboard()
-
 	// 發送系統公告
 	announceMsg := models.Message{
 		Type:      "chat",
-		Room:      "聊天大廳",
+		Room:      s.lobbyRoom(),
 		Nickname:  "🏆 系統",
 		Avatar:    "🏆",
 		Content:   fmt.Sprintf("%s 在猜數字遊戲中獲勝了 (猜 %d 次, %d 秒)！", score.Nickname, score.Tries, score.Time),
@@ -417,32 +619,17 @@ func (s *StateServiceV2) UpdateLeaderboard(score models.GameScore) {
 		zap.Int("time", score.Time))
 }
 
-// broadcastLeaderboard 廣播排行榜
-func (s *StateServiceV2) broadcastLeaderboard() {
-	scores := s.leaderboardRepo.GetAll()
-	scoresJSON, err := json.Marshal(scores)
-	if err != nil {
-		logger.Error("Failed to marshal leaderboard", zap.Error(err))
-		return
-	}
-
-	msg := models.Message{
-		Type:    "leaderboard_update",
-		Content: string(scoresJSON),
-		Room:    "_game_",
-	}
-
-	s.BroadcastToRoom(msg)
-}
-
 // BroadcastToRoom 廣播到指定房間
 func (s *StateServiceV2) BroadcastToRoom(msg models.Message) {
 	s.broadcastMessage(msg)
 }
 
-// GetLeaderboardJSON 獲取排行榜 JSON
+// GetLeaderboardJSON 獲取猜數字總榜 JSON
 func (s *StateServiceV2) GetLeaderboardJSON() ([]byte, error) {
-	scores := s.leaderboardRepo.GetAll()
+	scores, err := s.Leaderboard(repository.Scope{Board: repository.BoardGuessNumber})
+	if err != nil {
+		return nil, err
+	}
 	return json.Marshal(scores)
 }
 
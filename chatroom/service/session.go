@@ -0,0 +1,185 @@
+package service
+
+import (
+	"chatroom/logger"
+	"chatroom/models"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// session 可恢復的連線狀態
+type session struct {
+	client *models.Client
+	timer  *time.Timer // 非 nil 表示連線已中斷，正在等待恢復
+}
+
+// newSessionToken 產生隨機的 session token
+func newSessionToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand 失敗時退回時間戳，仍可唯一識別
+		return hex.EncodeToString([]byte(time.Now().Format(time.RFC3339Nano)))
+	}
+	return hex.EncodeToString(b)
+}
+
+// CreateSession 為客戶端建立可恢復的 session，回傳 token
+func (s *StateServiceV2) CreateSession(client *models.Client) string {
+	token := newSessionToken()
+
+	s.SessionsMutex.Lock()
+	s.sessions[token] = &session{client: client}
+	s.SessionsMutex.Unlock()
+
+	client.SessionToken = token
+	return token
+}
+
+// DetachClient 連線中斷時保留客戶端的房間成員身分，等待寬限期內恢復。
+// conn 為中斷的連線；若客戶端已改用新連線則不處理。
+// 回傳 false 表示無法保留，呼叫端應改用 UnregisterClient。
+func (s *StateServiceV2) DetachClient(client *models.Client, conn *websocket.Conn) bool {
+	grace := s.config.WebSocket.ResumeGrace
+	if grace <= 0 || client.SessionToken == "" || s.IsDraining() {
+		return false
+	}
+
+	s.SessionsMutex.Lock()
+	defer s.SessionsMutex.Unlock()
+
+	sess, ok := s.sessions[client.SessionToken]
+	if !ok || sess.client != client {
+		return false
+	}
+
+	client.Mu.Lock()
+	current := client.Conn
+	client.Mu.Unlock()
+	if current != conn {
+		// 舊連線的讀取循環晚於恢復才結束，session 已屬於新連線
+		return true
+	}
+
+	if sess.timer != nil {
+		sess.timer.Stop()
+	}
+	token := client.SessionToken
+	sess.timer = time.AfterFunc(grace, func() {
+		s.expireSession(token)
+	})
+
+	logger.Info("Client detached, waiting for resume",
+		zap.String("nickname", client.Nickname),
+		zap.String("room", client.Room),
+		zap.Duration("grace", grace))
+	return true
+}
+
+// ResumeSession 以 token 恢復 session，將客戶端切換到新連線。
+// 只能恢復已中斷的 session：舊連線仍在時（例如兩個分頁共用 token，或舊的讀取循環還沒發現斷線）拒絕，
+// 避免兩個讀取循環同時操作同一個客戶端。回傳恢復的客戶端與是否成功。
+func (s *StateServiceV2) ResumeSession(token string, conn *websocket.Conn, lastID int64) (*models.Client, bool) {
+	if token == "" {
+		return nil, false
+	}
+
+	s.SessionsMutex.Lock()
+	sess, ok := s.sessions[token]
+	switch {
+	case !ok:
+		s.SessionsMutex.Unlock()
+		return nil, false
+	case sess.timer == nil:
+		// 舊連線仍在使用中
+		s.SessionsMutex.Unlock()
+		logger.Warn("Resume refused, session still attached",
+			zap.String("nickname", sess.client.Nickname))
+		return nil, false
+	case !sess.timer.Stop():
+		// 寬限期已到，正在清除中
+		s.SessionsMutex.Unlock()
+		return nil, false
+	}
+	sess.timer = nil
+	s.SessionsMutex.Unlock()
+
+	client := sess.client
+	client.Mu.Lock()
+	client.Conn = conn
+	if lastID > client.LastAckID {
+		client.LastAckID = lastID
+	}
+	client.Mu.Unlock()
+
+	logger.Info("Session resumed",
+		zap.String("nickname", client.Nickname),
+		zap.String("room", client.Room),
+		zap.Int64("last_ack_id", client.LastAckID))
+
+	return client, true
+}
+
+// AckMessage 記錄客戶端已確認收到的訊息 ID
+func (s *StateServiceV2) AckMessage(client *models.Client, id int64) {
+	client.Mu.Lock()
+	if id > client.LastAckID {
+		client.LastAckID = id
+	}
+	client.Mu.Unlock()
+}
+
+// ReplayMissed 發送客戶端最後確認之後的歷史訊息
+func (s *StateServiceV2) ReplayMissed(client *models.Client) int {
+	client.Mu.Lock()
+	lastID := client.LastAckID
+	client.Mu.Unlock()
+
+	return s.SendHistorySince(client, lastID)
+}
+
+// EndSession 刪除客戶端的 session（正常離線時使用）
+func (s *StateServiceV2) EndSession(client *models.Client) {
+	if client.SessionToken == "" {
+		return
+	}
+
+	s.SessionsMutex.Lock()
+	if sess, ok := s.sessions[client.SessionToken]; ok && sess.client == client {
+		if sess.timer != nil {
+			sess.timer.Stop()
+		}
+		delete(s.sessions, client.SessionToken)
+	}
+	s.SessionsMutex.Unlock()
+}
+
+// expireSession 寬限期結束仍未恢復：正式移除客戶端並發送離開訊息
+func (s *StateServiceV2) expireSession(token string) {
+	s.SessionsMutex.Lock()
+	sess, ok := s.sessions[token]
+	if ok {
+		delete(s.sessions, token)
+	}
+	s.SessionsMutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	client := sess.client
+	room := s.UnregisterClient(client)
+
+	s.AnnounceLeave(client, room)
+	if !strings.HasPrefix(room, "_") {
+		go s.BroadcastOnlineCount()
+	}
+
+	logger.Info("Session expired",
+		zap.String("nickname", client.Nickname),
+		zap.String("room", room))
+}
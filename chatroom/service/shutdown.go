@@ -0,0 +1,124 @@
+package service
+
+import (
+	"chatroom/logger"
+	"chatroom/models"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// BeginShutdown 進入關機流程：通知所有客戶端伺服器即將重啟，並停止接受新訊息
+func (s *StateServiceV2) BeginShutdown(retryAfter time.Duration) {
+	if !s.draining.CompareAndSwap(false, true) {
+		return
+	}
+
+	notice := models.Message{
+		Type:       "server_restarting",
+		Content:    fmt.Sprintf("伺服器即將重新啟動，請於 %d 秒後重新連線", int(retryAfter.Seconds())),
+		Timestamp:  time.Now().Format("15:04:05"),
+		RetryAfter: retryAfter.Milliseconds(),
+	}
+
+	clients := s.allClients()
+	for _, client := range clients {
+		s.safeWriteJSON(client, notice)
+	}
+
+	logger.Info("Shutdown notice broadcast", zap.Int("clients", len(clients)))
+}
+
+// IsDraining 是否正在關機（不再接受新的訊息與連線）
+func (s *StateServiceV2) IsDraining() bool {
+	return s.draining.Load()
+}
+
+// WaitLoopStopped 等待訊息循環結束；循環從未啟動時立即返回
+func (s *StateServiceV2) WaitLoopStopped(ctx context.Context) error {
+	if !s.loopStarted.Load() {
+		return nil
+	}
+
+	select {
+	case <-s.loopDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DrainPending 同步處理 Broadcast 中剩餘的訊息，供 worker pool 停止後使用
+func (s *StateServiceV2) DrainPending() int {
+	return s.drainBroadcast(s.ProcessMessage)
+}
+
+// drainBroadcast 取出 Broadcast 中所有已排隊的訊息，不會阻塞
+func (s *StateServiceV2) drainBroadcast(handle func(models.Message)) int {
+	count := 0
+	for {
+		select {
+		case msg, ok := <-s.Broadcast:
+			if !ok {
+				return count
+			}
+			handle(msg)
+			count++
+		default:
+			return count
+		}
+	}
+}
+
+// FlushStorage 將記憶體中的資料寫回儲存（聊天記錄在新增時已寫入儲存）
+func (s *StateServiceV2) FlushStorage() error {
+	if err := s.leaderboards.Load().Flush(); err != nil {
+		return fmt.Errorf("flush leaderboards: %w", err)
+	}
+	return nil
+}
+
+// CloseAllClients 對所有連線送出 WebSocket close frame，並附上重新連線的建議等待時間
+func (s *StateServiceV2) CloseAllClients(retryAfter time.Duration) int {
+	reason := fmt.Sprintf("server restarting; retry-after=%d", int(retryAfter.Seconds()))
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, reason)
+
+	closed := 0
+	for _, client := range s.allClients() {
+		client.Mu.Lock()
+		err := client.Conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(s.writeWait()))
+		client.Mu.Unlock()
+
+		if err == nil {
+			closed++
+		}
+	}
+
+	logger.Info("Close frames sent", zap.Int("clients", closed))
+	return closed
+}
+
+// allClients 收集所有房間中的客戶端
+func (s *StateServiceV2) allClients() []*models.Client {
+	s.RoomsMutex.RLock()
+	defer s.RoomsMutex.RUnlock()
+
+	clients := make([]*models.Client, 0)
+	for _, roomClients := range s.Rooms {
+		for client := range roomClients {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// writeWait 寫入逾時時間
+func (s *StateServiceV2) writeWait() time.Duration {
+	if s.config.WebSocket.WriteWait > 0 {
+		return s.config.WebSocket.WriteWait
+	}
+	return 10 * time.Second
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"chatroom/models"
+	"strings"
+	"time"
+)
+
+// typingState 使用者在某房間的輸入狀態
+type typingState struct {
+	lastSent time.Time
+	expires  time.Time
+	timer    *time.Timer
+}
+
+// typingKey 輸入狀態的鍵：房間 + 使用者
+func typingKey(room string, client *models.Client) string {
+	return room + "\x00" + presenceKey(client)
+}
+
+// HandleTyping 處理輸入提示：節流廣播，並在一段時間沒有更新後自動過期。
+// 輸入提示只會即時推送給房間其他成員，不會寫入歷史記錄。
+func (s *StateServiceV2) HandleTyping(client *models.Client) {
+	room := client.Room
+	if strings.HasPrefix(room, "_") {
+		return
+	}
+
+	ttl := s.config.Presence.TypingTTL
+	if ttl <= 0 {
+		ttl = 5 * time.Second
+	}
+	throttle := s.config.Presence.TypingThrottle
+	key := typingKey(room, client)
+	now := time.Now()
+
+	s.TypingMutex.Lock()
+	state, exists := s.typing[key]
+	if !exists {
+		state = &typingState{}
+		s.typing[key] = state
+	}
+	shouldSend := !exists || now.Sub(state.lastSent) >= throttle
+	if shouldSend {
+		state.lastSent = now
+	}
+	state.expires = now.Add(ttl)
+	if state.timer != nil {
+		state.timer.Stop()
+	}
+	state.timer = time.AfterFunc(ttl, func() {
+		s.stopTyping(room, client, true)
+	})
+	s.TypingMutex.Unlock()
+
+	if shouldSend {
+		s.sendToRoomExcept(models.Message{
+			Type:     "typing",
+			Room:     room,
+			UserId:   client.UserID,
+			Nickname: client.Nickname,
+		}, client)
+	}
+}
+
+// StopTyping 使用者停止輸入（送出訊息或清空輸入框）
+func (s *StateServiceV2) StopTyping(client *models.Client) {
+	s.stopTyping(client.Room, client, false)
+}
+
+// stopTyping 清除輸入狀態並通知房間；expired 為 true 時只在確實過期後才清除
+func (s *StateServiceV2) stopTyping(room string, client *models.Client, expired bool) {
+	key := typingKey(room, client)
+
+	s.TypingMutex.Lock()
+	state, exists := s.typing[key]
+	if exists && expired && time.Now().Before(state.expires) {
+		// 計時器觸發前又收到新的輸入提示
+		exists = false
+	} else if exists {
+		if state.timer != nil {
+			state.timer.Stop()
+		}
+		delete(s.typing, key)
+	}
+	s.TypingMutex.Unlock()
+
+	if !exists {
+		return
+	}
+
+	s.sendToRoomExcept(models.Message{
+		Type:     "typing_stop",
+		Room:     room,
+		UserId:   client.UserID,
+		Nickname: client.Nickname,
+	}, client)
+}
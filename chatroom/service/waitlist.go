@@ -0,0 +1,100 @@
+package service
+
+import (
+	apperrors "chatroom/errors"
+	"chatroom/logger"
+	"chatroom/models"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// waitlistEntry 等候進入已滿房間的連線
+type waitlistEntry struct {
+	client   *models.Client
+	password string // 進入時需要的房間密碼
+}
+
+// WaitlistEnabled 是否啟用房間等候名單
+func (s *StateServiceV2) WaitlistEnabled() bool {
+	return s.config.Room.Waitlist
+}
+
+// JoinWaitlist 將連線加入房間的等候名單，回傳目前順位（從 1 開始）。
+// 同一連線只會在一個等候名單中。
+func (s *StateServiceV2) JoinWaitlist(client *models.Client, room, password string) int {
+	s.WaitlistMutex.Lock()
+	defer s.WaitlistMutex.Unlock()
+
+	s.removeFromWaitlistsLocked(client)
+	s.waitlists[room] = append(s.waitlists[room], waitlistEntry{client: client, password: password})
+	position := len(s.waitlists[room])
+
+	logger.Info("Client waitlisted",
+		zap.String("nickname", client.Nickname),
+		zap.String("room", room),
+		zap.Int("position", position))
+	return position
+}
+
+// LeaveWaitlist 將連線從所有等候名單移除
+func (s *StateServiceV2) LeaveWaitlist(client *models.Client) {
+	s.WaitlistMutex.Lock()
+	s.removeFromWaitlistsLocked(client)
+	s.WaitlistMutex.Unlock()
+}
+
+// removeFromWaitlistsLocked 呼叫端需持有 WaitlistMutex
+func (s *StateServiceV2) removeFromWaitlistsLocked(client *models.Client) {
+	for room, entries := range s.waitlists {
+		for i, entry := range entries {
+			if entry.client == client {
+				entries = append(entries[:i:i], entries[i+1:]...)
+				break
+			}
+		}
+		if len(entries) == 0 {
+			delete(s.waitlists, room)
+		} else {
+			s.waitlists[room] = entries
+		}
+	}
+}
+
+// admitWaitlisted 房間有空位時，依序讓等候中的連線進入
+func (s *StateServiceV2) admitWaitlisted(room string) {
+	for {
+		s.WaitlistMutex.Lock()
+		entries := s.waitlists[room]
+		if len(entries) == 0 {
+			s.WaitlistMutex.Unlock()
+			return
+		}
+		entry := entries[0]
+		s.waitlists[room] = entries[1:]
+		if len(s.waitlists[room]) == 0 {
+			delete(s.waitlists, room)
+		}
+		s.WaitlistMutex.Unlock()
+
+		oldRoom, err := s.SwitchRoom(entry.client, room, entry.password)
+		if errors.Is(err, apperrors.ErrRoomFull) {
+			// 仍然沒有空位，放回名單最前面
+			s.WaitlistMutex.Lock()
+			s.waitlists[room] = append([]waitlistEntry{entry}, s.waitlists[room]...)
+			s.WaitlistMutex.Unlock()
+			return
+		}
+		if err != nil {
+			// 等候期間被封鎖或密碼已變更，略過此連線
+			s.safeWriteJSON(entry.client, models.Message{Type: err.Error(), Room: room})
+			continue
+		}
+
+		s.EnterRoom(entry.client, oldRoom)
+		logger.Info("Waitlisted client admitted",
+			zap.String("nickname", entry.client.Nickname),
+			zap.String("room", room))
+		return
+	}
+}
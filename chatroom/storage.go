@@ -0,0 +1,70 @@
+package main
+
+import (
+	"chatroom/config"
+	"chatroom/repository"
+	"fmt"
+)
+
+// storage 依配置開啟的儲存；檔案儲存只保存排行榜與房間，history 與 profiles 為 nil
+type storage struct {
+	leaderboard repository.LeaderboardRepository // 猜數字總榜
+	boards      repository.LeaderboardStore      // 其他排行榜
+	rooms       repository.RoomRepository
+	history     repository.HistoryRepository
+	profiles    repository.ProfileRepository
+	db          *repository.BoltStore
+}
+
+// openStorage 依 storage.backend 開啟儲存
+func openStorage(cfg *config.Config) (*storage, error) {
+	path := cfg.Storage.Path
+	if cfg.Storage.Backend != config.StorageBolt {
+		// 排行榜損毀且無法從備份復原時拒絕啟動，避免以空白排行榜覆蓋原本的資料
+		leaderboard, err := repository.OpenFileLeaderboardRepository(
+			path(cfg.Storage.LeaderboardFile), cfg.Storage.LeaderboardSize, cfg.Storage.LeaderboardBackups)
+		if err != nil {
+			return nil, fmt.Errorf("leaderboard: %w", err)
+		}
+		return &storage{
+			leaderboard: leaderboard,
+			boards:      repository.NewFileLeaderboardStore(path(cfg.Storage.LeaderboardsDir), cfg.Storage.LeaderboardBackups),
+			rooms:       repository.NewFileRoomRepository(path(cfg.Storage.RoomsFile)),
+		}, nil
+	}
+
+	// 第一次建立資料庫時匯入原本的 JSON 檔案
+	db, err := repository.OpenBoltStore(path(cfg.Storage.DatabaseFile), repository.BoltOptions{
+		LegacyLeaderboardFile: path(cfg.Storage.LeaderboardFile),
+		LegacyRoomsFile:       path(cfg.Storage.RoomsFile),
+	})
+	if err != nil {
+		return nil, err
+	}
+	leaderboard, err := db.Leaderboard(cfg.Storage.LeaderboardSize)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("leaderboard: %w", err)
+	}
+	return &storage{
+		leaderboard: leaderboard,
+		boards:      db.Leaderboards(),
+		rooms:       db.Rooms(),
+		history:     db.History(),
+		profiles:    db.Profiles(),
+		db:          db,
+	}, nil
+}
+
+// Leaderboards 所有排行榜
+func (s *storage) Leaderboards(cfg *config.Config) *repository.Leaderboards {
+	return repository.NewLeaderboards(repository.DefaultBoards(cfg.Storage.LeaderboardSize), s.leaderboard, s.boards)
+}
+
+// Close 關閉資料庫（檔案儲存不需要關閉）
+func (s *storage) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,116 @@
+package transport
+
+import (
+	"chatroom/config"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	// errServerFull 全站連線數已達上限
+	errServerFull = errors.New("server full")
+
+	// errTooManyConnections 單一 IP 或使用者的連線數已達上限
+	errTooManyConnections = errors.New("too many connections")
+
+	// errUserIDMismatch 查詢字串與初始訊息的使用者 ID 不一致
+	errUserIDMismatch = errors.New("user id mismatch")
+)
+
+// admission 在 WebSocket Upgrade 之前控管連線數：全站、每個 IP、每個使用者
+type admission struct {
+	mu         sync.Mutex
+	maxTotal   int
+	maxPerIP   int
+	maxPerUser int
+	total      int
+	perIP      map[string]int
+	perUser    map[string]int
+}
+
+// newAdmission 依配置建立連線數控管
+func newAdmission(cfg config.WSConfig) *admission {
+	return &admission{
+		maxTotal:   cfg.MaxConnections,
+		maxPerIP:   cfg.MaxConnsPerIP,
+		maxPerUser: cfg.MaxConnsPerUser,
+		perIP:      make(map[string]int),
+		perUser:    make(map[string]int),
+	}
+}
+
+// admit 為新連線保留全站與 IP 名額，成功後須呼叫 release
+func (a *admission) admit(ip string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.maxTotal > 0 && a.total >= a.maxTotal {
+		return errServerFull
+	}
+	if a.maxPerIP > 0 && a.perIP[ip] >= a.maxPerIP {
+		return errTooManyConnections
+	}
+	a.total++
+	a.perIP[ip]++
+	return nil
+}
+
+// release 釋放 admit 保留的名額
+func (a *admission) release(ip string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.total--
+	if a.perIP[ip]--; a.perIP[ip] <= 0 {
+		delete(a.perIP, ip)
+	}
+}
+
+// admitUser 為使用者保留名額，成功後須呼叫 releaseUser
+func (a *admission) admitUser(userID string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.maxPerUser > 0 && a.perUser[userID] >= a.maxPerUser {
+		return errTooManyConnections
+	}
+	a.perUser[userID]++
+	return nil
+}
+
+// releaseUser 釋放 admitUser 保留的名額
+func (a *admission) releaseUser(userID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.perUser[userID]--; a.perUser[userID] <= 0 {
+		delete(a.perUser, userID)
+	}
+}
+
+// clientIP 取得客戶端 IP；位於 proxyHops 層反向代理之後時使用 X-Forwarded-For 從右數第 proxyHops 個位址。
+// 左側的位址由客戶端自行填寫，不能用來判斷 IP；位址不足 proxyHops 個時取最左邊的位址
+func clientIP(r *http.Request, trustProxy bool, proxyHops int) string {
+	if trustProxy {
+		var addrs []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, addr := range strings.Split(header, ",") {
+				if addr = strings.TrimSpace(addr); addr != "" {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+		if len(addrs) > 0 {
+			return addrs[max(len(addrs)-proxyHops, 0)]
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
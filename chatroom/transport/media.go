@@ -0,0 +1,224 @@
+package transport
+
+import (
+	"chatroom/config"
+	"chatroom/imaging"
+	"chatroom/logger"
+	"chatroom/repository"
+	"chatroom/service"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MediaURLPrefix 提供上傳檔案的網址前綴
+const MediaURLPrefix = "/media/"
+
+// 上傳請求
+const (
+	uploadFileField    = "file"
+	uploadTokenHeader  = "X-Session-Token"
+	uploadFormOverhead = 64 * 1024 // multipart 邊界與標頭的額外長度
+)
+
+// mediaSniffTypes 依檔案內容判斷的類型（http.DetectContentType）與儲存的類型；
+// 不採用客戶端宣告的 Content-Type
+var mediaSniffTypes = map[string]string{
+	"image/png":       "image/png",
+	"image/jpeg":      "image/jpeg",
+	"image/gif":       "image/gif",
+	"video/webm":      "audio/webm", // 瀏覽器 MediaRecorder 錄製的語音
+	"application/ogg": "audio/ogg",
+	"audio/mpeg":      "audio/mpeg",
+	"audio/wave":      "audio/wav",
+	"video/mp4":       "audio/mp4", // Safari 錄製的語音
+}
+
+// MediaHandler 處理圖片與語音的上傳與下載
+type MediaHandler struct {
+	Service *service.StateServiceV2
+	config  *config.Config
+}
+
+// NewMediaHandler 建立媒體處理器，檔案儲存由 Service.SetBlobStore 設定
+func NewMediaHandler(s *service.StateServiceV2, cfg *config.Config) *MediaHandler {
+	return &MediaHandler{Service: s, config: cfg}
+}
+
+// HandleUpload 處理 POST /upload：以 session token 驗證上傳者，檢查大小與檔案類型後儲存，
+// 回傳檔案的網址（圖片另外附上縮圖）；kind 查詢參數（image 或 voice）指定時檔案類型必須相符
+func (h *MediaHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
+	store := h.Service.Blobs()
+	if store == nil {
+		http.Error(w, "uploads are disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	client, ok := h.Service.SessionClient(r.Header.Get(uploadTokenHeader))
+	if !ok {
+		http.Error(w, "invalid session token", http.StatusUnauthorized)
+		return
+	}
+	if result := h.Service.CheckRateLimit(client, "upload"); !result.Allowed() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+		http.Error(w, "too many uploads", http.StatusTooManyRequests)
+		return
+	}
+
+	maxSize := h.config.Storage.MediaMaxSize
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+uploadFormOverhead)
+	data, err := readUploadFile(r, maxSize)
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.Is(err, errUploadTooLarge) || errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	contentType, ok := mediaSniffTypes[http.DetectContentType(data)]
+	if !ok {
+		http.Error(w, "unsupported file type", http.StatusUnsupportedMediaType)
+		return
+	}
+	if kind := r.URL.Query().Get("kind"); kind != "" && kind != service.MediaMessageType(contentType) {
+		http.Error(w, "file type does not match "+kind, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// 圖片一律經過處理後重新編碼，語音原樣儲存
+	var resp uploadResponse
+	if service.MediaMessageType(contentType) == "image" {
+		var thumbnail repository.Blob
+		resp.Blob, thumbnail, err = h.Service.StoreImage(data)
+		if status := imageErrorStatus(err); status != 0 {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		resp.Thumbnail = &thumbnail
+	} else {
+		resp.Blob, err = store.Put(data, contentType)
+	}
+	if err != nil {
+		logger.Error("Failed to store upload", zap.String("user_id", client.UserID), zap.Error(err))
+		http.Error(w, "failed to store file", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("Media uploaded",
+		zap.String("user_id", client.UserID),
+		zap.String("key", resp.Key),
+		zap.Int64("size", resp.Size))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// uploadResponse 上傳結果，圖片另外附上縮圖
+type uploadResponse struct {
+	repository.Blob
+	Thumbnail *repository.Blob `json:"thumbnail,omitempty"`
+}
+
+// imageErrorStatus 圖片處理錯誤對應的 HTTP 狀態碼，不是圖片的問題時回傳 0
+func imageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, imaging.ErrTooManyPixels):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, imaging.ErrInvalidImage):
+		return http.StatusBadRequest
+	}
+	return 0
+}
+
+// errUploadTooLarge 檔案超過 storage.media_max_size
+var errUploadTooLarge = errors.New("file too large")
+
+// readUploadFile 從 multipart 表單讀取 file 欄位，超過 maxSize 時回傳 errUploadTooLarge
+func readUploadFile(r *http.Request, maxSize int64) ([]byte, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("missing file field")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() != uploadFileField {
+			continue
+		}
+		return readPart(part, maxSize)
+	}
+}
+
+// readPart 讀取表單欄位內容，最多 maxSize 位元組
+func readPart(part *multipart.Part, maxSize int64) ([]byte, error) {
+	defer part.Close()
+
+	data, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errUploadTooLarge
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty file")
+	}
+	return data, nil
+}
+
+// HandleMedia 處理 GET /media/{key}：內容定址的檔案不會變動，允許長期快取；
+// 禁止瀏覽器猜測內容類型或執行檔案中的指令碼
+func (h *MediaHandler) HandleMedia(w http.ResponseWriter, r *http.Request) {
+	store := h.Service.Blobs()
+	if store == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	key := r.PathValue("key")
+	file, blob, err := store.Open(key)
+	if errors.Is(err, repository.ErrBlobNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to open media", zap.String("key", key), zap.Error(err))
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	hash := strings.TrimSuffix(blob.Key, path.Ext(blob.Key))
+	w.Header().Set("Content-Type", blob.ContentType)
+	w.Header().Set("Cache-Control", cacheImmutable)
+	w.Header().Set("ETag", `"`+hash[:staticETagLength]+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+
+	// 本機檔案支援 Range 請求（語音可以拖曳播放位置）
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", time.Time{}, seeker)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(blob.Size, 10))
+	io.Copy(w, file)
+}
@@ -0,0 +1,160 @@
+package transport
+
+import (
+	"bytes"
+	"chatroom/config"
+	"chatroom/models"
+	"chatroom/repository"
+	"chatroom/service"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newMediaServer 在測試服務上建立上傳與下載的 HTTP 伺服器
+func newMediaServer(t *testing.T, cfg *config.Config) (string, string) {
+	t.Helper()
+
+	svc, wsURL := newTestServer(t, cfg)
+	store, err := repository.NewLocalBlobStore(t.TempDir(), MediaURLPrefix)
+	if err != nil {
+		t.Fatalf("NewLocalBlobStore failed: %v", err)
+	}
+	svc.SetBlobStore(store)
+
+	handler := NewMediaHandler(svc, cfg)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /upload", handler.HandleUpload)
+	mux.HandleFunc("GET "+MediaURLPrefix+"{key}", handler.HandleMedia)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts.URL, wsURL
+}
+
+// upload 以 multipart 表單上傳檔案
+func upload(t *testing.T, baseURL, query, token string, data []byte) *http.Response {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "upload.bin")
+	part.Write(data)
+	form.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/upload"+query, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if token != "" {
+		req.Header.Set("X-Session-Token", token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestMediaUpload(t *testing.T) {
+	cfg := config.Load()
+	cfg.RateLimit.Enabled = false
+	cfg.Storage.MediaMaxSize = 4096
+	baseURL, wsURL := newMediaServer(t, cfg)
+
+	alice := dial(t, wsURL, models.Message{Nickname: "Alice", Room: "media_room", UserId: "ALIC0001"})
+	session := readUntil(t, alice, "session", "")
+	token := session[len(session)-1].Token
+
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+
+	rejected := []struct {
+		name   string
+		query  string
+		token  string
+		data   []byte
+		status int
+	}{
+		{"no session", "", "", pngData.Bytes(), http.StatusUnauthorized},
+		{"html", "", token, []byte("<html><script>alert(1)</script></html>"), http.StatusUnsupportedMediaType},
+		{"wrong kind", "?kind=voice", token, pngData.Bytes(), http.StatusUnsupportedMediaType},
+		{"too large", "", token, bytes.Repeat([]byte{0}, 5000), http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range rejected {
+		if resp := upload(t, baseURL, tc.query, tc.token, tc.data); resp.StatusCode != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.status, resp.StatusCode)
+		}
+	}
+
+	resp := upload(t, baseURL, "?kind=image", token, pngData.Bytes())
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+	var blob uploadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&blob); err != nil || blob.ContentType != "image/png" || blob.Thumbnail == nil {
+		t.Fatalf("Unexpected upload response %+v: %v", blob, err)
+	}
+
+	media, err := http.Get(baseURL + blob.URL)
+	if err != nil {
+		t.Fatalf("Get media failed: %v", err)
+	}
+	content, _ := io.ReadAll(media.Body)
+	media.Body.Close()
+	if int64(len(content)) != blob.Size || media.Header.Get("Content-Type") != "image/png" ||
+		media.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("Unexpected media response %d %v", media.StatusCode, media.Header)
+	}
+	if _, err := png.Decode(bytes.NewReader(content)); err != nil {
+		t.Errorf("Stored image should be a valid PNG: %v", err)
+	}
+
+	// 不是圖片的內容即使開頭像 PNG 也無法通過解碼
+	if resp := upload(t, baseURL, "", token, append([]byte("\x89PNG\r\n\x1a\n"), "not really"...)); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a broken PNG, got %d", resp.StatusCode)
+	}
+
+	// 訊息只能攜帶已上傳檔案的網址
+	alice.WriteJSON(models.Message{Type: "image", Content: "data:image/png;base64,AAAA"})
+	readUntil(t, alice, "invalid_media", "")
+	alice.WriteJSON(models.Message{Type: "voice", Content: blob.URL})
+	readUntil(t, alice, "invalid_media", "")
+	alice.WriteJSON(models.Message{Type: "chat", Content: "hi", Thumbnail: blob.Thumbnail.URL})
+	readUntil(t, alice, "invalid_media", "")
+	alice.WriteJSON(models.Message{Type: "image", Content: blob.URL, Thumbnail: blob.Thumbnail.URL})
+	seen := readUntil(t, alice, "image", blob.URL)
+	if msg := seen[len(seen)-1]; msg.Thumbnail != blob.Thumbnail.URL {
+		t.Errorf("Expected the thumbnail to be broadcast, got %q", msg.Thumbnail)
+	}
+}
+
+func TestCustomAvatarIsStored(t *testing.T) {
+	cfg := config.Load()
+	_, wsURL := newMediaServer(t, cfg)
+
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 200, 120)))
+	avatar := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngData.Bytes())
+
+	alice := dial(t, wsURL, models.Message{Nickname: "Alice", Room: "avatar_room", Avatar: avatar})
+	readUntil(t, alice, "session", "")
+	alice.WriteJSON(models.Message{Type: "chat", Content: "hello"})
+	seen := readUntil(t, alice, "chat", "hello")
+	if got := seen[len(seen)-1].Avatar; !strings.HasPrefix(got, MediaURLPrefix) {
+		t.Errorf("Expected the avatar to be replaced with a media URL, got %.40q", got)
+	}
+
+	bob := dial(t, wsURL, models.Message{Nickname: "Bob", Room: "avatar_room", Avatar: "data:text/html;base64,PHNjcmlwdD4="})
+	readUntil(t, bob, "session", "")
+	bob.WriteJSON(models.Message{Type: "chat", Content: "hey"})
+	seen = readUntil(t, bob, "chat", "hey")
+	if got := seen[len(seen)-1].Avatar; got != service.DefaultAvatar {
+		t.Errorf("Expected the default avatar for an invalid data URL, got %.40q", got)
+	}
+}
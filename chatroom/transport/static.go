@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// 快取策略：頭像檔案不會變動，其餘檔案每次以 ETag 確認是否更新
+const (
+	cacheImmutable   = "public, max-age=31536000, immutable"
+	cacheRevalidate  = "no-cache"
+	immutablePrefix  = "avatars/"
+	staticIndexFile  = "index.html"
+	staticETagLength = 16
+)
+
+// StaticHandler 提供靜態檔案並附上 ETag 與 Cache-Control
+type StaticHandler struct {
+	fsys      fs.FS
+	files     http.Handler
+	immutable bool // 內嵌檔案在執行期間不會變動，ETag 可以快取
+
+	mu    sync.RWMutex
+	etags map[string]string
+}
+
+// NewStaticHandler 建立靜態檔案處理器。
+// immutable 為 true 時（內嵌於執行檔的檔案）ETag 依內容計算並快取，頭像允許長期快取；
+// 為 false 時（從磁碟讀取，前端開發用）ETag 依修改時間與大小計算，所有檔案都需要重新確認。
+func NewStaticHandler(fsys fs.FS, immutable bool) *StaticHandler {
+	return &StaticHandler{
+		fsys:      fsys,
+		files:     http.FileServer(http.FS(fsys)),
+		immutable: immutable,
+		etags:     make(map[string]string),
+	}
+}
+
+// ServeHTTP 設定快取標頭後交給 http.FileServer，If-None-Match 符合時回傳 304
+func (h *StaticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+		name = path.Join(name, staticIndexFile)
+	}
+
+	if etag, err := h.etag(name); err == nil {
+		w.Header().Set("ETag", etag)
+		if h.immutable && strings.HasPrefix(name, immutablePrefix) {
+			w.Header().Set("Cache-Control", cacheImmutable)
+		} else {
+			w.Header().Set("Cache-Control", cacheRevalidate)
+		}
+	}
+	h.files.ServeHTTP(w, r)
+}
+
+// etag 檔案的 ETag，檔案不存在或是目錄時回傳錯誤
+func (h *StaticHandler) etag(name string) (string, error) {
+	if h.immutable {
+		h.mu.RLock()
+		etag, ok := h.etags[name]
+		h.mu.RUnlock()
+		if ok {
+			return etag, nil
+		}
+	}
+
+	file, err := h.fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", name)
+	}
+
+	if !h.immutable {
+		return fmt.Sprintf(`W/"%x-%x"`, info.ModTime().UnixNano(), info.Size()), nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil))[:staticETagLength] + `"`
+
+	h.mu.Lock()
+	h.etags[name] = etag
+	h.mu.Unlock()
+	return etag, nil
+}
@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStaticHandler(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":      {Data: []byte("<html>chat</html>"), ModTime: time.Unix(1700000000, 0)},
+		"avatars/cat.png": {Data: []byte("png"), ModTime: time.Unix(1700000000, 0)},
+	}
+
+	get := func(h http.Handler, path, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Embedded", func(t *testing.T) {
+		h := NewStaticHandler(files, true)
+
+		rec := get(h, "/", "")
+		etag := rec.Header().Get("ETag")
+		if rec.Code != http.StatusOK || etag == "" || rec.Header().Get("Cache-Control") != cacheRevalidate {
+			t.Fatalf("index: code=%d etag=%q cache=%q", rec.Code, etag, rec.Header().Get("Cache-Control"))
+		}
+		if rec := get(h, "/", etag); rec.Code != http.StatusNotModified {
+			t.Errorf("Expected 304 for matching ETag, got %d", rec.Code)
+		}
+
+		rec = get(h, "/avatars/cat.png", "")
+		if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != cacheImmutable {
+			t.Errorf("avatar: code=%d cache=%q", rec.Code, rec.Header().Get("Cache-Control"))
+		}
+
+		if rec := get(h, "/missing.js", ""); rec.Code != http.StatusNotFound || rec.Header().Get("ETag") != "" {
+			t.Errorf("missing file: code=%d etag=%q", rec.Code, rec.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("Disk", func(t *testing.T) {
+		h := NewStaticHandler(files, false)
+
+		rec := get(h, "/avatars/cat.png", "")
+		if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != cacheRevalidate {
+			t.Errorf("Disk files should always revalidate: code=%d cache=%q", rec.Code, rec.Header().Get("Cache-Control"))
+		}
+		if rec := get(h, "/avatars/cat.png", rec.Header().Get("ETag")); rec.Code != http.StatusNotModified {
+			t.Errorf("Expected 304 for matching ETag, got %d", rec.Code)
+		}
+	})
+}
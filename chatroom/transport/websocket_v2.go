@@ -2,12 +2,20 @@ package transport
 
 import (
 	"chatroom/config"
+	apperrors "chatroom/errors"
 	"chatroom/logger"
 	"chatroom/models"
+	"chatroom/repository"
 	"chatroom/service"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
@@ -15,9 +23,13 @@ import (
 
 // WebsocketHandlerV2 增強版 WebSocket 處理器
 type WebsocketHandlerV2 struct {
-	Service  *service.StateServiceV2
-	config   *config.Config
-	upgrader websocket.Upgrader
+	Service   *service.StateServiceV2
+	config    *config.Config
+	upgrader  websocket.Upgrader
+	admission *admission
+
+	// 連線 ID 產生器（限流用）
+	lastConnID atomic.Uint64
 }
 
 // NewWebsocketHandlerWithConfig 創建帶配置的 WebSocket 處理器
@@ -30,11 +42,38 @@ func NewWebsocketHandlerWithConfig(s *service.StateServiceV2, cfg *config.Config
 			ReadBufferSize:  cfg.WebSocket.ReadBufferSize,
 			WriteBufferSize: cfg.WebSocket.WriteBufferSize,
 		},
+		admission: newAdmission(cfg.WebSocket),
 	}
 }
 
 // HandleConnections 處理 WebSocket 連線
 func (h *WebsocketHandlerV2) HandleConnections(w http.ResponseWriter, r *http.Request) {
+	// 關機中不再接受新連線
+	if h.Service.IsDraining() {
+		retryAfter := int(h.config.Server.RestartRetryAfter.Seconds())
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, "server restarting", http.StatusServiceUnavailable)
+		return
+	}
+
+	// 連線數控管：在 Upgrade 之前拒絕超出上限的連線
+	ip := clientIP(r, h.config.WebSocket.TrustProxy, h.config.WebSocket.ProxyHops)
+	if err := h.admission.admit(ip); err != nil {
+		h.rejectConnection(w, ip, err)
+		return
+	}
+	defer h.admission.release(ip)
+
+	// 使用者 ID 可以放在查詢字串中提前檢查，否則在收到初始訊息後檢查
+	userID := r.URL.Query().Get("userId")
+	if userID != "" {
+		if err := h.admission.admitUser(userID); err != nil {
+			h.rejectConnection(w, ip, err)
+			return
+		}
+		defer h.admission.releaseUser(userID)
+	}
+
 	ws, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logger.Error("Upgrade error", zap.Error(err))
@@ -45,50 +84,171 @@ func (h *WebsocketHandlerV2) HandleConnections(w http.ResponseWriter, r *http.Re
 	// 設置讀取限制
 	ws.SetReadLimit(h.config.WebSocket.MaxMessageSize)
 
-	// 讀取初始訊息
+	// 讀取初始訊息：pong_wait 內未送達時關閉連線，避免閒置連線佔用名額
 	var initMsg models.Message
+	ws.SetReadDeadline(time.Now().Add(h.config.WebSocket.PongWait))
 	err = ws.ReadJSON(&initMsg)
 	if err != nil {
 		logger.Error("Init message read error", zap.Error(err))
 		return
 	}
 
+	// 查詢字串與初始訊息的使用者 ID 必須一致，否則連線名額會記在另一個使用者上
+	if initMsg.UserId == "" {
+		initMsg.UserId = userID
+	} else if userID != "" && initMsg.UserId != userID {
+		logger.Warn("Connection rejected, user ID mismatch",
+			zap.String("query_user_id", userID),
+			zap.String("user_id", initMsg.UserId))
+		h.rejectInit(ws, errUserIDMismatch)
+		return
+	}
+
+	// 只在初始訊息帶使用者 ID 時，在此計入使用者連線數；恢復 session 的連線同樣計入
+	if userID == "" && initMsg.UserId != "" {
+		if err := h.admission.admitUser(initMsg.UserId); err != nil {
+			logger.Warn("Connection rejected, too many connections for user",
+				zap.String("user_id", initMsg.UserId))
+			h.rejectInit(ws, err)
+			return
+		}
+		defer h.admission.releaseUser(initMsg.UserId)
+	}
+
+	// 恢復中斷的 session：保留房間成員身分，只補發錯過的訊息
+	if initMsg.Type == "resume" {
+		// 其他使用者的 token 視同無效
+		if h.sessionOwnedBy(initMsg.Token, initMsg.UserId) {
+			if client, ok := h.Service.ResumeSession(initMsg.Token, ws, initMsg.LastID); ok {
+				client.IP = ip
+				h.resumeClient(client, ws)
+				return
+			}
+		}
+
+		// token 無效、已過期或屬於其他使用者，改以新連線處理
+		ws.WriteJSON(models.Message{Type: "resume_failed"})
+	}
+
+	// 自訂頭像（data URL）裁切縮放並移除中繼資料後，改用儲存後的網址
+	if strings.HasPrefix(initMsg.Avatar, "data:") {
+		avatar, err := h.Service.StoreAvatar(initMsg.Avatar)
+		if err != nil {
+			logger.Warn("Invalid custom avatar, using the default",
+				zap.String("nickname", initMsg.Nickname),
+				zap.Error(err))
+			avatar = service.DefaultAvatar
+		}
+		initMsg.Avatar = avatar
+	}
+
 	// 創建客戶端
 	client := &models.Client{
 		Conn:     ws,
 		Nickname: initMsg.Nickname,
 		Room:     initMsg.Room,
 		Avatar:   initMsg.Avatar,
+		Level:    initMsg.Level,
+		Title:    initMsg.Title,
+		UserID:   initMsg.UserId,
+		ConnID:   strconv.FormatUint(h.lastConnID.Add(1), 10),
+		IP:       ip,
+	}
+
+	// 註冊客戶端（全站人數已滿時拒絕）
+	denied, err := h.Service.RegisterClient(client, initMsg.Password)
+	if err != nil {
+		ws.WriteJSON(models.Message{Type: err.Error(), Room: client.Room, Content: "聊天室人數已滿，請稍後再試"})
+		return
 	}
 
-	// 註冊客戶端
-	h.Service.RegisterClient(client)
+	// 建立可恢復的 session
+	token := h.Service.CreateSession(client)
+	h.writeJSON(client, models.Message{Type: "session", Token: token, Room: client.Room})
+
+	// 無法進入指定的房間：先告知已改到大廳，再說明原因（例如需要密碼）
+	if denied != nil {
+		h.writeJSON(client, models.Message{Type: "switch_success", Room: client.Room, Content: initMsg.Room})
+		h.writeJSON(client, h.roomDeniedMessage(client, initMsg.Room, denied))
+	}
 
 	// 發送歷史記錄
 	if !strings.HasPrefix(client.Room, "_") {
 		h.Service.SendHistory(client)
+		h.Service.SendRoomMembers(client)
 
-		// 發送加入訊息
-		joinMsg := models.Message{
-			Type:      "join",
-			Room:      client.Room,
-			Content:   client.Nickname + " 加入了聊天室",
-			Timestamp: time.Now().Format("15:04"),
-		}
-		h.Service.Broadcast <- joinMsg
+		// 發送加入訊息（同一使用者的其他分頁已在房間時不發送）
+		h.Service.AnnounceJoin(client)
 		go h.Service.BroadcastOnlineCount()
 	}
 
 	// 啟動讀取循環和心跳檢測
-	h.readLoopWithHeartbeat(client)
+	h.readLoopWithHeartbeat(client, ws)
+}
+
+// rejectConnection 以 HTTP 狀態碼拒絕連線：全站已滿回傳 503，單一 IP 或使用者過多回傳 429
+func (h *WebsocketHandlerV2) rejectConnection(w http.ResponseWriter, ip string, err error) {
+	h.Service.Metrics().IncrementRejectedConnections()
+
+	status := http.StatusTooManyRequests
+	if errors.Is(err, errServerFull) {
+		status = http.StatusServiceUnavailable
+	}
+
+	logger.Warn("Connection rejected",
+		zap.String("ip", ip),
+		zap.Int("status", status),
+		zap.Error(err))
+
+	retryAfter := int(h.config.WebSocket.AdmissionRetryAfter.Seconds())
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	http.Error(w, err.Error(), status)
+}
+
+// rejectInit 升級之後才能判斷的拒絕：以 policy violation 關閉連線
+func (h *WebsocketHandlerV2) rejectInit(ws *websocket.Conn, err error) {
+	h.Service.Metrics().IncrementRejectedConnections()
+	ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()),
+		time.Now().Add(time.Second))
+}
+
+// sessionOwnedBy session 是否屬於指定使用者；未指定使用者時不檢查
+func (h *WebsocketHandlerV2) sessionOwnedBy(token, userID string) bool {
+	if userID == "" {
+		return true
+	}
+	client, ok := h.Service.SessionClient(token)
+	return !ok || client.UserID == userID
+}
+
+// resumeClient 恢復 session 後補發錯過的訊息，不廣播加入/離開訊息
+func (h *WebsocketHandlerV2) resumeClient(client *models.Client, ws *websocket.Conn) {
+	h.writeJSON(client, models.Message{
+		Type:   "resumed",
+		Room:   client.Room,
+		Token:  client.SessionToken,
+		LastID: client.LastAckID,
+	})
+
+	replayed := h.Service.ReplayMissed(client)
+	if !strings.HasPrefix(client.Room, "_") {
+		h.Service.SendRoomMembers(client)
+	}
+	logger.Info("Client resumed",
+		zap.String("nickname", client.Nickname),
+		zap.String("room", client.Room),
+		zap.Int("replayed", replayed))
+
+	h.readLoopWithHeartbeat(client, ws)
 }
 
-// readLoopWithHeartbeat 帶心跳檢測的讀取循環
-func (h *WebsocketHandlerV2) readLoopWithHeartbeat(client *models.Client) {
+// readLoopWithHeartbeat 帶心跳檢測的讀取循環，ws 為此循環負責的連線
+func (h *WebsocketHandlerV2) readLoopWithHeartbeat(client *models.Client, ws *websocket.Conn) {
 	// 設置 pong 處理器
-	client.Conn.SetReadDeadline(time.Now().Add(h.config.WebSocket.PongWait))
-	client.Conn.SetPongHandler(func(string) error {
-		client.Conn.SetReadDeadline(time.Now().Add(h.config.WebSocket.PongWait))
+	ws.SetReadDeadline(time.Now().Add(h.config.WebSocket.PongWait))
+	ws.SetPongHandler(func(string) error {
+		ws.SetReadDeadline(time.Now().Add(h.config.WebSocket.PongWait))
 		return nil
 	})
 
@@ -106,7 +266,7 @@ func (h *WebsocketHandlerV2) readLoopWithHeartbeat(client *models.Client) {
 			select {
 			case <-ticker.C:
 				client.Mu.Lock()
-				err := client.Conn.WriteControl(
+				err := ws.WriteControl(
 					websocket.PingMessage,
 					[]byte{},
 					time.Now().Add(h.config.WebSocket.WriteWait),
@@ -128,14 +288,21 @@ func (h *WebsocketHandlerV2) readLoopWithHeartbeat(client *models.Client) {
 	// 讀取循環
 	for {
 		var msg models.Message
-		err := client.Conn.ReadJSON(&msg)
+		err := ws.ReadJSON(&msg)
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				logger.Warn("Unexpected close",
 					zap.String("nickname", client.Nickname),
 					zap.Error(err))
 			}
+
+			// 保留 session 等待恢復；無法保留時才正式移除
+			if h.Service.DetachClient(client, ws) {
+				break
+			}
+			h.Service.EndSession(client)
 			roomToUpdate := h.Service.UnregisterClient(client)
+			h.Service.AnnounceLeave(client, roomToUpdate)
 
 			// 廣播在線人數更新
 			if !strings.HasPrefix(roomToUpdate, "_") {
@@ -143,24 +310,29 @@ func (h *WebsocketHandlerV2) readLoopWithHeartbeat(client *models.Client) {
 			}
 			break
 		}
+		// 關機中：丟棄新收到的訊息
+		if h.Service.IsDraining() {
+			continue
+		}
 
 		// 限流檢查
-		if msg.UserId != "" && !h.Service.CheckRateLimit(msg.UserId) {
-			warningMsg := models.Message{
-				Type:    "error",
-				Content: "發送訊息過於頻繁，請稍後再試",
-			}
-			client.Mu.Lock()
-			client.Conn.WriteJSON(warningMsg)
-			client.Mu.Unlock()
+		if result := h.Service.CheckRateLimit(client, msg.Type); !result.Allowed() {
+			h.handleRateLimited(client, ws, result)
 			continue
 		}
 
+		// 記錄活動（閒置狀態會自動恢復）
+		if msg.Type != "ack" {
+			h.Service.Touch(client)
+		}
+
 		// 處理訊息
 		msg.Avatar = client.Avatar
 		msg.Nickname = client.Nickname
+		msg.UserId = client.UserID
 
-		if msg.Type != "switch" {
+		// 切換、建立房間與查詢排行榜時房間由客戶端指定
+		if msg.Type != "switch" && msg.Type != "create_room" && msg.Type != "get_leaderboard" {
 			msg.Room = client.Room
 		}
 
@@ -169,13 +341,100 @@ func (h *WebsocketHandlerV2) readLoopWithHeartbeat(client *models.Client) {
 	}
 }
 
+// handleRateLimited 告知客戶端何時可以再發送；重複違規達上限時中斷連線
+func (h *WebsocketHandlerV2) handleRateLimited(client *models.Client, ws *websocket.Conn, result service.RateLimitResult) {
+	content := "發送訊息過於頻繁，請稍後再試"
+	switch result.Penalty {
+	case service.PenaltyMute:
+		content = "發送訊息過於頻繁，已被暫時禁止發言"
+	case service.PenaltyDisconnect:
+		content = "發送訊息過於頻繁，連線已中斷"
+	}
+
+	h.writeJSON(client, models.Message{
+		Type:       "rate_limited",
+		Content:    content,
+		RetryAfter: result.RetryAfter.Milliseconds(),
+		Remaining:  result.Remaining,
+	})
+
+	if result.Penalty != service.PenaltyDisconnect {
+		return
+	}
+
+	// 不保留 session，避免以恢復連線繞過斷線；讀取循環會照一般離線流程移除客戶端
+	h.Service.EndSession(client)
+	client.Mu.Lock()
+	ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limited"),
+		time.Now().Add(h.config.WebSocket.WriteWait))
+	client.Mu.Unlock()
+	ws.Close()
+}
+
+// controlMessageTypes 不會廣播到房間的訊息類型，被禁言時仍可使用；
+// 其他類型（包含未知類型）都會出現在房間中，一律經過禁言檢查
+var controlMessageTypes = map[string]bool{
+	"switch":          true,
+	"create_room":     true,
+	"create_invite":   true,
+	"revoke_invite":   true,
+	"join_invite":     true,
+	"leave_waitlist":  true,
+	"ack":             true,
+	"typing_stop":     true,
+	"presence":        true,
+	"room_members":    true,
+	"mark_read":       true,
+	"get_leaderboard": true,
+}
+
 // handleMessage 處理不同類型的訊息
 func (h *WebsocketHandlerV2) handleMessage(client *models.Client, msg models.Message) {
+	// 被禁言時不廣播（輸入中提示直接忽略，不回應錯誤）
+	if !controlMessageTypes[msg.Type] && !service.IsModerationCommand(msg.Type) {
+		if remaining := h.Service.MutedFor(client); remaining > 0 {
+			if msg.Type != "typing" {
+				h.writeJSON(client, models.Message{
+					Type:       apperrors.ErrMuted.Error(),
+					Room:       client.Room,
+					Content:    "你已被禁言",
+					RetryAfter: remaining.Milliseconds(),
+				})
+			}
+			return
+		}
+	}
+
 	switch msg.Type {
 	case "switch":
 		h.handleSwitchRoom(client, msg)
+	case "create_room":
+		h.handleCreateRoom(client, msg)
+	case "create_invite":
+		h.handleCreateInvite(client, msg)
+	case "revoke_invite":
+		h.handleRevokeInvite(client, msg)
+	case "join_invite":
+		h.handleJoinInvite(client, msg)
+	case "leave_waitlist":
+		h.Service.LeaveWaitlist(client)
+	case "ack":
+		h.Service.AckMessage(client, msg.ID)
+	case "typing":
+		h.Service.HandleTyping(client)
+	case "typing_stop":
+		h.Service.StopTyping(client)
+	case "presence":
+		if err := h.Service.SetStatus(client, msg.Status); err != nil {
+			h.writeJSON(client, models.Message{Type: "error", Content: "無效的狀態"})
+		}
+	case "room_members":
+		h.Service.SendRoomMembers(client)
+	case "mark_read":
+		h.Service.MarkRead(client, client.Room, msg.ID)
 	case "get_leaderboard":
-		h.handleGetLeaderboard(client)
+		h.handleGetLeaderboard(client, msg)
 	case "game_win":
 		h.handleGameWin(msg)
 	case "vote":
@@ -183,7 +442,35 @@ func (h *WebsocketHandlerV2) handleMessage(client *models.Client, msg models.Mes
 	case "quiz":
 		h.handleQuiz(msg)
 	default:
-		// 其他訊息直接廣播
+		if service.IsModerationCommand(msg.Type) {
+			h.handleModeration(client, msg)
+			return
+		}
+
+		// 送出訊息即視為停止輸入
+		h.Service.StopTyping(client)
+
+		if utf8.RuneCountInString(msg.Content) > h.config.WebSocket.MaxContentLength {
+			h.writeJSON(client, models.Message{
+				Type:    apperrors.ErrMessageTooLong.Error(),
+				Room:    client.Room,
+				Content: fmt.Sprintf("訊息不可超過 %d 字", h.config.WebSocket.MaxContentLength),
+			})
+			return
+		}
+
+		// 圖片與語音只能引用已上傳的檔案，不接受內嵌的 base64
+		if err := h.Service.CheckMedia(msg); err != nil {
+			h.writeJSON(client, models.Message{
+				Type:    err.Error(),
+				Room:    client.Room,
+				Content: "圖片或語音需先上傳",
+			})
+			return
+		}
+
+		// 其他訊息直接廣播（密碼欄位不可外流）
+		msg.Password = ""
 		if msg.Timestamp == "" {
 			msg.Timestamp = time.Now().Format("15:04:05")
 		}
@@ -195,45 +482,59 @@ func (h *WebsocketHandlerV2) handleMessage(client *models.Client, msg models.Mes
 		zap.String("from", client.Nickname))
 }
 
+// writeJSON 在客戶端鎖內寫入訊息
+func (h *WebsocketHandlerV2) writeJSON(client *models.Client, msg models.Message) {
+	client.Mu.Lock()
+	client.Conn.WriteJSON(msg)
+	client.Mu.Unlock()
+}
+
+// roomDeniedMessage 無法進入房間時發送給客戶端的錯誤訊息
+func (h *WebsocketHandlerV2) roomDeniedMessage(client *models.Client, room string, err error) models.Message {
+	content := "密碼驗證失敗"
+	var retryAfter int64
+	switch {
+	case errors.Is(err, apperrors.ErrBanned):
+		content = "你已被此房間封鎖"
+	case errors.Is(err, apperrors.ErrInviteOnly):
+		content = "此房間僅限受邀成員"
+	case errors.Is(err, apperrors.ErrRoomFull):
+		content = "房間人數已滿"
+	case errors.Is(err, apperrors.ErrPasswordTooLong):
+		content = "密碼過長"
+	case errors.Is(err, apperrors.ErrPasswordLockedOut):
+		content = "密碼錯誤次數過多，請稍後再試"
+		retryAfter = h.Service.PasswordLockedFor(client, room).Milliseconds()
+	}
+	return models.Message{
+		Type:       err.Error(), // 例如 "password_required"、"banned"、"room_full"
+		Room:       room,        // 包含房間名稱
+		Content:    content,
+		RetryAfter: retryAfter,
+	}
+}
+
 // handleSwitchRoom 處理切換房間
 func (h *WebsocketHandlerV2) handleSwitchRoom(client *models.Client, msg models.Message) {
 	oldRoom, err := h.Service.SwitchRoom(client, msg.Room, msg.Password)
-	if err != nil {
-		// 發送錯誤訊息給客戶端
-		errorMsg := models.Message{
-			Type:    err.Error(), // "password_required" 或 "wrong_password"
-			Room:    msg.Room,    // 包含房間名稱
-			Content: "密碼驗證失敗",
-		}
-		client.Mu.Lock()
-		client.Conn.WriteJSON(errorMsg)
-		client.Mu.Unlock()
+	if errors.Is(err, apperrors.ErrRoomFull) && h.Service.WaitlistEnabled() {
+		// 房間已滿：排隊等候空位，輪到時會自動切換並收到 switch_success
+		position := h.Service.JoinWaitlist(client, msg.Room, msg.Password)
+		h.writeJSON(client, models.Message{
+			Type:     "waitlisted",
+			Room:     msg.Room,
+			Content:  "房間人數已滿，已加入等候名單",
+			Position: position,
+		})
 		return
 	}
-
-	// 發送切換成功確認訊息給客戶端
-	confirmMsg := models.Message{
-		Type:    "switch_success",
-		Room:    msg.Room,
-		Content: oldRoom, // 舊房間名稱
+	if err != nil {
+		h.writeJSON(client, h.roomDeniedMessage(client, msg.Room, err))
+		return
 	}
-	client.Mu.Lock()
-	client.Conn.WriteJSON(confirmMsg)
-	client.Mu.Unlock()
-
-	// 發送歷史訊息
-	h.Service.SendHistory(client)
 
-	// 發送加入訊息
-	if !strings.HasPrefix(msg.Room, "_") {
-		joinMsg := models.Message{
-			Type:      "join",
-			Room:      msg.Room,
-			Content:   client.Nickname + " 加入了聊天室",
-			Timestamp: time.Now().Format("15:04"),
-		}
-		h.Service.Broadcast <- joinMsg
-	}
+	// 發送切換確認、歷史訊息、成員列表與加入訊息
+	h.Service.EnterRoom(client, oldRoom)
 
 	logger.Info("Room switched",
 		zap.String("nickname", client.Nickname),
@@ -241,32 +542,135 @@ func (h *WebsocketHandlerV2) handleSwitchRoom(client *models.Client, msg models.
 		zap.String("to", msg.Room))
 }
 
-// handleGetLeaderboard 處理獲取排行榜請求
-func (h *WebsocketHandlerV2) handleGetLeaderboard(client *models.Client) {
-	scoresJSON, err := h.Service.GetLeaderboardJSON()
+// handleCreateRoom 建立永久房間並讓建立者進入
+func (h *WebsocketHandlerV2) handleCreateRoom(client *models.Client, msg models.Message) {
+	var settings models.RoomSettings
+	if msg.Settings != nil {
+		settings = *msg.Settings
+	}
+
+	name := strings.TrimSpace(msg.Room)
+	if err := h.Service.CreateRoom(client, name, msg.Password, settings); err != nil {
+		h.writeJSON(client, models.Message{
+			Type:    err.Error(), // "room_exists"、"invalid_room_name" 或 "password_too_long"
+			Room:    msg.Room,
+			Content: "建立房間失敗",
+		})
+		return
+	}
+
+	if client.Room != name {
+		h.handleSwitchRoom(client, models.Message{Room: name, Password: msg.Password})
+	}
+}
+
+// handleCreateInvite 建立邀請連結，只回覆給建立者
+func (h *WebsocketHandlerV2) handleCreateInvite(client *models.Client, msg models.Message) {
+	ttl := time.Duration(msg.Duration) * time.Second
+	invite, err := h.Service.CreateInvite(client, ttl, msg.MaxUses)
 	if err != nil {
-		logger.Error("Error marshalling leaderboard", zap.Error(err))
+		h.writeJSON(client, models.Message{Type: err.Error(), Room: client.Room, Content: "建立邀請連結失敗"})
 		return
 	}
 
-	resp := models.Message{
-		Type:    "leaderboard_update",
-		Content: string(scoresJSON),
+	h.writeJSON(client, models.Message{
+		Type:    "invite_created",
+		Room:    invite.Room,
+		Token:   invite.Token,
+		Content: "/invite/" + invite.Token,
+		MaxUses: invite.MaxUses,
+	})
+}
+
+// handleRevokeInvite 撤銷邀請連結
+func (h *WebsocketHandlerV2) handleRevokeInvite(client *models.Client, msg models.Message) {
+	if err := h.Service.RevokeInvite(client, msg.Token); err != nil {
+		h.writeJSON(client, models.Message{Type: err.Error(), Room: client.Room, Token: msg.Token, Content: "撤銷邀請連結失敗"})
+		return
 	}
+	h.writeJSON(client, models.Message{Type: "invite_revoked", Room: client.Room, Token: msg.Token, Content: "邀請連結已撤銷"})
+}
 
-	client.Mu.Lock()
-	client.Conn.WriteJSON(resp)
-	client.Mu.Unlock()
+// handleJoinInvite 使用邀請連結進入房間
+func (h *WebsocketHandlerV2) handleJoinInvite(client *models.Client, msg models.Message) {
+	room, err := h.Service.RedeemInvite(client, msg.Token)
+	if err != nil {
+		h.writeJSON(client, models.Message{Type: err.Error(), Token: msg.Token, Content: "邀請連結無效"})
+		return
+	}
+
+	if client.Room != room {
+		h.handleSwitchRoom(client, models.Message{Room: room})
+	}
+}
+
+// HandleInvite 處理 /invite/{token}：連結有效時導向聊天室並自動使用邀請
+func (h *WebsocketHandlerV2) HandleInvite(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+	if _, err := h.Service.LookupInvite(token); err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, apperrors.ErrInviteExpired) || errors.Is(err, apperrors.ErrInviteExhausted) {
+			status = http.StatusGone
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	http.Redirect(w, r, "/?invite="+url.QueryEscape(token), http.StatusFound)
+}
+
+// handleModeration 處理房間管理指令，失敗時以錯誤文字作為訊息類型回覆
+func (h *WebsocketHandlerV2) handleModeration(client *models.Client, msg models.Message) {
+	if err := h.Service.Moderate(client, msg); err != nil {
+		h.writeJSON(client, models.Message{
+			Type:     err.Error(),
+			Room:     client.Room,
+			TargetId: msg.TargetId,
+			Content:  "管理指令執行失敗",
+		})
+	}
+}
+
+// handleGetLeaderboard 處理獲取排行榜請求：board 預設為猜數字，period 預設為 all_time，
+// room 空白表示全站排行榜，指定時只能是目前所在的房間
+func (h *WebsocketHandlerV2) handleGetLeaderboard(client *models.Client, msg models.Message) {
+	if msg.Room != "" && msg.Room != client.Room {
+		h.writeJSON(client, models.Message{Type: "error", Content: "只能查看目前所在房間的排行榜"})
+		return
+	}
+
+	board := msg.Board
+	if board == "" {
+		board = repository.BoardGuessNumber
+	}
+	resp, err := h.Service.LeaderboardMessage(repository.Scope{
+		Board:  board,
+		Period: repository.Period(msg.Period),
+		Room:   msg.Room,
+	})
+	if errors.Is(err, repository.ErrUnknownBoard) || errors.Is(err, repository.ErrUnknownPeriod) {
+		h.writeJSON(client, models.Message{Type: "error", Content: "未知的排行榜"})
+		return
+	}
+	if err != nil {
+		logger.Error("Error loading leaderboard", zap.String("board", board), zap.Error(err))
+		return
+	}
+
+	resp.Room = msg.Room
+	h.writeJSON(client, resp)
 }
 
 // handleGameWin 處理遊戲勝利
 func (h *WebsocketHandlerV2) handleGameWin(msg models.Message) {
 	score := models.GameScore{
+		UserID:   msg.UserId,
 		Nickname: msg.Nickname,
+		Avatar:   msg.Avatar,
 		Tries:    msg.Tries,
 		Time:     msg.Time,
 	}
-	h.Service.UpdateLeaderboard(score)
+	h.Service.UpdateLeaderboard(msg.Room, score)
 }
 
 // handleVote 處理投票
@@ -0,0 +1,925 @@
+package transport
+
+import (
+	"chatroom/config"
+	"chatroom/metrics"
+	"chatroom/models"
+	"chatroom/pool"
+	"chatroom/ratelimit"
+	"chatroom/repository"
+	"chatroom/service"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer 建立使用 V2 服務的測試伺服器
+func newTestServer(t *testing.T, cfg *config.Config) (*service.StateServiceV2, string) {
+	t.Helper()
+
+	repo := repository.NewFileLeaderboardRepository(filepath.Join(t.TempDir(), "leaderboard.json"))
+	wp := pool.NewWorkerPool(2, 10)
+	wp.Start()
+	rl := ratelimit.NewMessageLimiter(cfg.RateLimit)
+	broadcastChan := make(chan models.Message, 100)
+
+	svc := service.NewStateServiceWithDeps(broadcastChan, repo, wp, rl, metrics.GetMetrics(), cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	go svc.HandleMessageLoopWithContext(ctx)
+
+	ts := httptest.NewServer(http.HandlerFunc(NewWebsocketHandlerWithConfig(svc, cfg).HandleConnections))
+	t.Cleanup(func() {
+		ts.Close()
+		cancel()
+		wp.Stop()
+	})
+
+	return svc, "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+// dial 建立連線並送出初始訊息
+func dial(t *testing.T, url string, init models.Message) *websocket.Conn {
+	t.Helper()
+
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err := ws.WriteJSON(init); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// readUntil 讀取訊息直到出現指定類型，回傳途中收到的所有訊息
+func readUntil(t *testing.T, ws *websocket.Conn, msgType, content string) []models.Message {
+	t.Helper()
+
+	var seen []models.Message
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+
+	for {
+		var msg models.Message
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatalf("Timeout waiting for %s (%q): %v", msgType, content, err)
+		}
+		seen = append(seen, msg)
+		if msg.Type == msgType && strings.Contains(msg.Content, content) {
+			return seen
+		}
+	}
+}
+
+func TestResumeSession(t *testing.T) {
+	cfg := config.Load()
+	cfg.WebSocket.ResumeGrace = 5 * time.Second
+	_, url := newTestServer(t, cfg)
+
+	alice := dial(t, url, models.Message{Nickname: "Alice", Room: "resume_room", UserId: "ALIC0001"})
+	session := readUntil(t, alice, "session", "")
+	token := session[len(session)-1].Token
+	if token == "" {
+		t.Fatal("Expected a session token")
+	}
+
+	bob := dial(t, url, models.Message{Nickname: "Bob", Room: "resume_room", UserId: "BOBB0001"})
+	readUntil(t, bob, "join", "Bob")
+
+	// 連線仍在時不能以同一個 token 接手
+	tab := dial(t, url, models.Message{Type: "resume", Token: token, Nickname: "Alice", Room: "resume_room", UserId: "ALIC0001"})
+	readUntil(t, tab, "resume_failed", "")
+	tab.Close()
+	bob.WriteJSON(models.Message{Type: "chat", Content: "still here"})
+	readUntil(t, alice, "chat", "still here")
+
+	// Alice 斷線，Bob 在期間發言
+	alice.Close()
+	time.Sleep(100 * time.Millisecond)
+	bob.WriteJSON(models.Message{Type: "chat", Content: "while you were away"})
+	readUntil(t, bob, "chat", "while you were away")
+
+	// Alice 在寬限期內恢復連線
+	resumed := dial(t, url, models.Message{Type: "resume", Token: token})
+	readUntil(t, resumed, "resumed", "")
+	readUntil(t, resumed, "chat", "while you were away")
+
+	// Bob 不應看到離開或重新加入的訊息
+	bob.WriteJSON(models.Message{Type: "chat", Content: "welcome back"})
+	for _, msg := range readUntil(t, bob, "chat", "welcome back") {
+		if msg.Type == "leave" || msg.Type == "join" {
+			t.Errorf("Unexpected %s message during resume: %q", msg.Type, msg.Content)
+		}
+	}
+	readUntil(t, resumed, "chat", "welcome back")
+}
+
+func TestResumeReplaysOnlyUnacked(t *testing.T) {
+	cfg := config.Load()
+	cfg.RateLimit.Enabled = false
+	cfg.WebSocket.ResumeGrace = 5 * time.Second
+	_, url := newTestServer(t, cfg)
+
+	alice := dial(t, url, models.Message{Nickname: "Alice", Room: "ack_room", UserId: "ALIC0001"})
+	session := readUntil(t, alice, "session", "")
+	token := session[len(session)-1].Token
+
+	bob := dial(t, url, models.Message{Nickname: "Bob", Room: "ack_room", UserId: "BOBB0001"})
+	readUntil(t, bob, "join", "Bob")
+
+	// Alice 收到並確認第一則訊息後斷線
+	bob.WriteJSON(models.Message{Type: "chat", Content: "already seen"})
+	seen := readUntil(t, alice, "chat", "already seen")
+	alice.WriteJSON(models.Message{Type: "ack", ID: seen[len(seen)-1].ID})
+	time.Sleep(100 * time.Millisecond)
+	alice.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	bob.WriteJSON(models.Message{Type: "chat", Content: "missed"})
+	readUntil(t, bob, "chat", "missed")
+
+	// 未帶 lastId 恢復時以伺服器記錄的確認位置為準，只補發未確認的訊息
+	resumed := dial(t, url, models.Message{Type: "resume", Token: token})
+	readUntil(t, resumed, "resumed", "")
+	for _, msg := range readUntil(t, resumed, "chat", "missed") {
+		if msg.Content == "already seen" {
+			t.Error("Acknowledged message should not be replayed")
+		}
+	}
+}
+
+func TestResumeWithUnknownToken(t *testing.T) {
+	cfg := config.Load()
+	_, url := newTestServer(t, cfg)
+
+	ws := dial(t, url, models.Message{Type: "resume", Token: "bogus", Nickname: "Carol", Room: "resume_room"})
+	readUntil(t, ws, "resume_failed", "")
+	readUntil(t, ws, "session", "")
+}
+
+func TestMultiTabPresence(t *testing.T) {
+	cfg := config.Load()
+	cfg.WebSocket.ResumeGrace = 0
+	_, url := newTestServer(t, cfg)
+
+	observer := dial(t, url, models.Message{Nickname: "Observer", Room: "tabs_room", UserId: "OBSV0001"})
+	readUntil(t, observer, "join", "Observer")
+
+	tab1 := dial(t, url, models.Message{Nickname: "Dana", Room: "tabs_room", UserId: "DANA0001"})
+	readUntil(t, observer, "join", "Dana")
+	readUntil(t, tab1, "session", "")
+
+	// 同一使用者開第二個分頁：不應再次廣播加入，人數仍為 2
+	tab2 := dial(t, url, models.Message{Nickname: "Dana", Room: "tabs_room", UserId: "DANA0001"})
+	readUntil(t, tab2, "online_count", "")
+
+	// 關閉一個分頁：不應廣播離開
+	tab1.Close()
+	time.Sleep(100 * time.Millisecond)
+	observer.WriteJSON(models.Message{Type: "chat", Content: "still two"})
+	for _, msg := range readUntil(t, observer, "chat", "still two") {
+		if msg.Type == "join" || msg.Type == "leave" {
+			t.Errorf("Unexpected %s message for extra tab: %q", msg.Type, msg.Content)
+		}
+		if msg.Type == "online_count" && msg.Content != "2" {
+			t.Errorf("Expected online count 2 distinct users, got %s", msg.Content)
+		}
+	}
+
+	// 關閉最後一個分頁：廣播離開
+	tab2.Close()
+	readUntil(t, observer, "leave", "Dana")
+}
+
+func TestMessageContentLimit(t *testing.T) {
+	cfg := config.Load()
+	cfg.WebSocket.MaxContentLength = 5
+	_, url := newTestServer(t, cfg)
+
+	ws := dial(t, url, models.Message{Nickname: "Long", Room: "limit_room", UserId: "LONG0001"})
+	readUntil(t, ws, "join", "Long")
+
+	// 字數以字元計算，不是位元組
+	ws.WriteJSON(models.Message{Type: "chat", Content: "太長的訊息了"})
+	readUntil(t, ws, "message_too_long", "")
+	ws.WriteJSON(models.Message{Type: "chat", Content: "剛好五個字"})
+	readUntil(t, ws, "chat", "剛好五個字")
+}
+
+func TestEmptyRoomJoinsLobby(t *testing.T) {
+	cfg := config.Load()
+	cfg.Room.LobbyName = "一樓大廳"
+	_, url := newTestServer(t, cfg)
+
+	// 客戶端不需要事先知道大廳名稱
+	ws := dial(t, url, models.Message{Nickname: "Newcomer", UserId: "NEWC0001"})
+	session := readUntil(t, ws, "session", "")
+	if room := session[len(session)-1].Room; room != "一樓大廳" {
+		t.Errorf("Expected the configured lobby, got %q", room)
+	}
+	readUntil(t, ws, "join", "Newcomer")
+}
+
+func TestTypingAndPresence(t *testing.T) {
+	cfg := config.Load()
+	cfg.Presence.TypingTTL = 200 * time.Millisecond
+	cfg.Presence.TypingThrottle = time.Second
+	_, url := newTestServer(t, cfg)
+
+	erin := dial(t, url, models.Message{Nickname: "Erin", Room: "typing_room", UserId: "ERIN0001"})
+	readUntil(t, erin, "join", "Erin")
+	frank := dial(t, url, models.Message{Nickname: "Frank", Room: "typing_room", UserId: "FRNK0001"})
+	readUntil(t, erin, "join", "Frank")
+
+	// 輸入提示會推送給其他人，並在 TTL 後自動過期
+	frank.WriteJSON(models.Message{Type: "typing"})
+	frank.WriteJSON(models.Message{Type: "typing"}) // 節流期間不重複廣播
+	seen := readUntil(t, erin, "typing_stop", "")
+	typingCount := 0
+	for _, msg := range seen {
+		if msg.Type == "typing" {
+			typingCount++
+			if msg.Nickname != "Frank" {
+				t.Errorf("Expected typing from Frank, got %s", msg.Nickname)
+			}
+		}
+	}
+	if typingCount != 1 {
+		t.Errorf("Expected 1 throttled typing message, got %d", typingCount)
+	}
+
+	// 狀態變更
+	frank.WriteJSON(models.Message{Type: "presence", Status: "busy"})
+	seen = readUntil(t, erin, "presence", "")
+	if status := seen[len(seen)-1].Status; status != "busy" {
+		t.Errorf("Expected busy status, got %s", status)
+	}
+
+	// 成員列表包含狀態
+	erin.WriteJSON(models.Message{Type: "room_members"})
+	seen = readUntil(t, erin, "room_members", "")
+	members := seen[len(seen)-1].Members
+	if len(members) != 2 {
+		t.Fatalf("Expected 2 members, got %d", len(members))
+	}
+	for _, m := range members {
+		if m.Nickname == "Frank" && m.Status != "busy" {
+			t.Errorf("Expected Frank to be busy, got %s", m.Status)
+		}
+		if m.Nickname == "Erin" && m.Status != "online" {
+			t.Errorf("Expected Erin to be online, got %s", m.Status)
+		}
+	}
+
+	// 輸入提示不會出現在歷史記錄中
+	late := dial(t, url, models.Message{Nickname: "Gina", Room: "typing_room", UserId: "GINA0001"})
+	for _, msg := range readUntil(t, late, "online_count", "") {
+		if msg.Type == "typing" || msg.Type == "typing_stop" {
+			t.Errorf("Typing indicator should never be replayed from history")
+		}
+	}
+}
+
+func TestRoomMemberRoster(t *testing.T) {
+	cfg := config.Load()
+	cfg.WebSocket.ResumeGrace = 0
+	_, url := newTestServer(t, cfg)
+
+	hank := dial(t, url, models.Message{Nickname: "Hank", Room: "roster_room", UserId: "HANK0001", Level: 3, Title: "新手"})
+	seen := readUntil(t, hank, "room_members", "")
+	if members := seen[len(seen)-1].Members; len(members) != 1 || members[0].Level != 3 {
+		t.Fatalf("Expected snapshot with only Hank at level 3, got %+v", members)
+	}
+
+	ivy := dial(t, url, models.Message{Nickname: "Ivy", Room: "roster_room", UserId: "IVYY0001", Level: 12, Title: "冠軍"})
+	seen = readUntil(t, ivy, "room_members", "")
+	if members := seen[len(seen)-1].Members; len(members) != 2 {
+		t.Errorf("Expected snapshot with 2 members, got %d", len(members))
+	}
+
+	seen = readUntil(t, hank, "member_joined", "")
+	joined := seen[len(seen)-1].Members
+	if len(joined) != 1 || joined[0].Nickname != "Ivy" || joined[0].Title != "冠軍" || joined[0].Level != 12 {
+		t.Errorf("Unexpected member_joined payload: %+v", joined)
+	}
+
+	ivy.Close()
+	seen = readUntil(t, hank, "member_left", "")
+	if left := seen[len(seen)-1].Members; len(left) != 1 || left[0].UserId != "IVYY0001" {
+		t.Errorf("Unexpected member_left payload: %+v", left)
+	}
+}
+
+func TestUnreadCountsAndReadReceipts(t *testing.T) {
+	cfg := config.Load()
+	_, url := newTestServer(t, cfg)
+
+	jack := dial(t, url, models.Message{Nickname: "Jack", Room: "unread_a", UserId: "JACK0001"})
+	readUntil(t, jack, "join", "Jack")
+	kim := dial(t, url, models.Message{Nickname: "Kim", Room: "unread_a", UserId: "KIMM0001"})
+	readUntil(t, jack, "join", "Kim")
+
+	// 已讀回條：小房間中 Jack 標記已讀，Kim 會收到
+	kim.WriteJSON(models.Message{Type: "chat", Content: "hello jack"})
+	seen := readUntil(t, jack, "chat", "hello jack")
+	jack.WriteJSON(models.Message{Type: "mark_read", ID: seen[len(seen)-1].ID})
+	seen = readUntil(t, kim, "read_receipt", "")
+	if receipt := seen[len(seen)-1]; receipt.Nickname != "Jack" || receipt.ID == 0 {
+		t.Errorf("Unexpected read receipt: %+v", receipt)
+	}
+
+	// Jack 切換到其他房間後，Kim 繼續發言
+	jack.WriteJSON(models.Message{Type: "switch", Room: "unread_b"})
+	readUntil(t, jack, "switch_success", "")
+	kim.WriteJSON(models.Message{Type: "chat", Content: "one"})
+	kim.WriteJSON(models.Message{Type: "chat", Content: "two"})
+	readUntil(t, kim, "chat", "two")
+
+	// 有人加入時會廣播房間列表，附上 Jack 的未讀數
+	dial(t, url, models.Message{Nickname: "Liam", Room: "unread_b", UserId: "LIAM0001"})
+	for {
+		seen = readUntil(t, jack, "room_list", "")
+		if unread := seen[len(seen)-1].Unread; unread["unread_a"] > 0 {
+			if unread["unread_a"] != 2 {
+				t.Errorf("Expected 2 unread in unread_a, got %d", unread["unread_a"])
+			}
+			break
+		}
+	}
+}
+
+func TestRoomModeration(t *testing.T) {
+	cfg := config.Load()
+	cfg.RateLimit.Enabled = false
+	_, url := newTestServer(t, cfg)
+
+	// 第一個進入房間的人成為擁有者
+	owner := dial(t, url, models.Message{Nickname: "Owner", Room: "mod_room", UserId: "OWNR0001"})
+	readUntil(t, owner, "join", "Owner")
+	bob := dial(t, url, models.Message{Nickname: "Bob", Room: "mod_room", UserId: "BOBB0003"})
+	readUntil(t, bob, "join", "Bob")
+	readUntil(t, owner, "join", "Bob")
+
+	// 一般成員沒有權限
+	bob.WriteJSON(models.Message{Type: "kick", TargetId: "OWNR0001"})
+	readUntil(t, bob, "permission_denied", "")
+
+	// 禁言後發言會被拒絕並附上剩餘時間
+	owner.WriteJSON(models.Message{Type: "mute", TargetId: "BOBB0003", Duration: 60})
+	readUntil(t, bob, "system", "禁言")
+	bob.WriteJSON(models.Message{Type: "chat", Content: "can you hear me"})
+	muted := readUntil(t, bob, "muted", "")
+	if retry := muted[len(muted)-1].RetryAfter; retry <= 0 || retry > 60000 {
+		t.Errorf("Expected retryAfter within mute duration, got %d", retry)
+	}
+
+	// 投票、搶答與遊戲結果同樣會出現在房間中，也受禁言限制
+	for _, msgType := range []string{"vote", "quiz", "game_win"} {
+		bob.WriteJSON(models.Message{Type: msgType, Content: "sneaky"})
+		readUntil(t, bob, "muted", "")
+	}
+	owner.WriteJSON(models.Message{Type: "chat", Content: "quiet now"})
+	for _, msg := range readUntil(t, owner, "chat", "quiet now") {
+		if msg.Nickname == "Bob" {
+			t.Errorf("Muted user's %s message was broadcast", msg.Type)
+		}
+	}
+
+	// 封鎖後被移到大廳，且無法再進入
+	owner.WriteJSON(models.Message{Type: "ban", TargetId: "BOBB0003"})
+	readUntil(t, bob, "banned", "")
+	readUntil(t, bob, "switch_success", "mod_room")
+	readUntil(t, owner, "system", "封鎖")
+
+	bob.WriteJSON(models.Message{Type: "switch", Room: "mod_room"})
+	readUntil(t, bob, "banned", "")
+
+	// 解除封鎖後可以再進入
+	owner.WriteJSON(models.Message{Type: "unban", TargetId: "BOBB0003"})
+	readUntil(t, owner, "system", "解除封鎖")
+	bob.WriteJSON(models.Message{Type: "switch", Room: "mod_room"})
+	readUntil(t, bob, "switch_success", "聊天大廳")
+}
+
+func TestModeratorCannotTargetOwner(t *testing.T) {
+	cfg := config.Load()
+	_, url := newTestServer(t, cfg)
+
+	owner := dial(t, url, models.Message{Nickname: "Owner", Room: "mod_room2", UserId: "OWNR0002"})
+	readUntil(t, owner, "join", "Owner")
+	mod := dial(t, url, models.Message{Nickname: "Mod", Room: "mod_room2", UserId: "MODD0001"})
+	readUntil(t, mod, "join", "Mod")
+
+	owner.WriteJSON(models.Message{Type: "add_moderator", TargetId: "MODD0001"})
+	readUntil(t, mod, "system", "管理員")
+
+	mod.WriteJSON(models.Message{Type: "kick", TargetId: "OWNR0002"})
+	readUntil(t, mod, "permission_denied", "")
+
+	// 管理員不能任命其他管理員
+	mod.WriteJSON(models.Message{Type: "add_moderator", TargetId: "OWNR0002"})
+	readUntil(t, mod, "permission_denied", "")
+}
+
+func TestPersistentRooms(t *testing.T) {
+	cfg := config.Load()
+	svc, url := newTestServer(t, cfg)
+	roomRepo := repository.NewFileRoomRepository(filepath.Join(t.TempDir(), "rooms.json"))
+	if err := svc.SetRoomRepository(roomRepo); err != nil {
+		t.Fatalf("SetRoomRepository failed: %v", err)
+	}
+
+	owner := dial(t, url, models.Message{Nickname: "Owner", Room: "聊天大廳", UserId: "OWNR0003"})
+	readUntil(t, owner, "join", "Owner")
+
+	owner.WriteJSON(models.Message{
+		Type:     "create_room",
+		Room:     "團隊頻道",
+		Settings: &models.RoomSettings{Topic: "每日站會", Icon: "🚀", MaxMembers: 1, InviteOnly: true},
+	})
+	readUntil(t, owner, "switch_success", "聊天大廳")
+
+	// 滿員與僅限受邀
+	bob := dial(t, url, models.Message{Nickname: "Bob", Room: "聊天大廳", UserId: "BOBB0004"})
+	readUntil(t, bob, "join", "Bob")
+	bob.WriteJSON(models.Message{Type: "switch", Room: "團隊頻道"})
+	readUntil(t, bob, "invite_only", "")
+
+	owner.WriteJSON(models.Message{Type: "invite", TargetId: "BOBB0004"})
+	readUntil(t, owner, "system", "邀請")
+	bob.WriteJSON(models.Message{Type: "switch", Room: "團隊頻道"})
+	readUntil(t, bob, "room_full", "")
+
+	// 擁有者離開後房間仍保留在列表中
+	owner.WriteJSON(models.Message{Type: "switch", Room: "聊天大廳"})
+	var summary *models.RoomSummary
+	for summary == nil {
+		msgs := readUntil(t, bob, "room_list", "")
+		for _, r := range msgs[len(msgs)-1].Rooms {
+			if r.Name == "團隊頻道" && r.Online == 0 {
+				summary = &r
+			}
+		}
+	}
+	if summary.Topic != "每日站會" || summary.Icon != "🚀" || !summary.Persistent {
+		t.Errorf("Unexpected room summary: %+v", summary)
+	}
+
+	// 受邀成員在有空位時可以進入
+	bob.WriteJSON(models.Message{Type: "switch", Room: "團隊頻道"})
+	readUntil(t, bob, "switch_success", "聊天大廳")
+
+	saved := roomRepo.GetAll()
+	if len(saved) != 1 || !saved[0].Invited["BOBB0004"] || saved[0].Owner != "OWNR0003" {
+		t.Errorf("Room not persisted correctly: %+v", saved)
+	}
+}
+
+func TestEmptyPersistentRoomPasswordUnchanged(t *testing.T) {
+	cfg := config.Load()
+	svc, url := newTestServer(t, cfg)
+
+	owner := dial(t, url, models.Message{Nickname: "Owner", Room: "聊天大廳", UserId: "OWNR0007"})
+	readUntil(t, owner, "join", "Owner")
+	owner.WriteJSON(models.Message{Type: "create_room", Room: "開放頻道"})
+	readUntil(t, owner, "switch_success", "聊天大廳")
+	owner.WriteJSON(models.Message{Type: "switch", Room: "聊天大廳"})
+	readUntil(t, owner, "switch_success", "開放頻道")
+
+	// 非擁有者進入沒有成員的永久房間時附帶密碼，不能替房間加上密碼
+	mallory := dial(t, url, models.Message{Nickname: "Mallory", Room: "聊天大廳", UserId: "MALL0002"})
+	readUntil(t, mallory, "join", "Mallory")
+	mallory.WriteJSON(models.Message{Type: "switch", Room: "開放頻道", Password: "locked"})
+	readUntil(t, mallory, "switch_success", "聊天大廳")
+
+	// 其他成員不需要密碼即可進入
+	bob := dial(t, url, models.Message{Nickname: "Bob", Room: "聊天大廳", UserId: "BOBB0007"})
+	readUntil(t, bob, "join", "Bob")
+	bob.WriteJSON(models.Message{Type: "switch", Room: "開放頻道"})
+	readUntil(t, bob, "switch_success", "聊天大廳")
+
+	svc.RoomPasswordsMutex.RLock()
+	_, locked := svc.RoomPasswords["開放頻道"]
+	svc.RoomPasswordsMutex.RUnlock()
+	if locked {
+		t.Error("Joining an empty persistent room must not set its password")
+	}
+}
+
+func TestInviteLinks(t *testing.T) {
+	cfg := config.Load()
+	svc, url := newTestServer(t, cfg)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /invite/{token}", NewWebsocketHandlerWithConfig(svc, cfg).HandleInvite)
+	inviteStatus := func(token string) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/invite/"+token, nil))
+		return rec.Code
+	}
+
+	owner := dial(t, url, models.Message{Nickname: "Owner", Room: "聊天大廳", UserId: "OWNR0004"})
+	readUntil(t, owner, "join", "Owner")
+	owner.WriteJSON(models.Message{
+		Type:     "create_room",
+		Room:     "私人房間",
+		Settings: &models.RoomSettings{InviteOnly: true},
+	})
+	readUntil(t, owner, "switch_success", "聊天大廳")
+
+	owner.WriteJSON(models.Message{Type: "create_invite", MaxUses: 1, Duration: 60})
+	created := readUntil(t, owner, "invite_created", "/invite/")
+	token := created[len(created)-1].Token
+
+	if code := inviteStatus(token); code != http.StatusFound {
+		t.Errorf("Expected redirect for valid invite, got %d", code)
+	}
+
+	// 受邀者可以進入僅限受邀房間
+	bob := dial(t, url, models.Message{Nickname: "Bob", Room: "聊天大廳", UserId: "BOBB0005"})
+	readUntil(t, bob, "join", "Bob")
+	bob.WriteJSON(models.Message{Type: "join_invite", Token: token})
+	readUntil(t, bob, "switch_success", "聊天大廳")
+
+	// 使用次數已滿
+	carol := dial(t, url, models.Message{Nickname: "Carol", Room: "聊天大廳", UserId: "CARL0001"})
+	readUntil(t, carol, "join", "Carol")
+	carol.WriteJSON(models.Message{Type: "join_invite", Token: token})
+	readUntil(t, carol, "invite_exhausted", "")
+	// 用完的連結在被發現時即刪除
+	if code := inviteStatus(token); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for deleted invite, got %d", code)
+	}
+
+	// 只有擁有者可以撤銷
+	owner.WriteJSON(models.Message{Type: "create_invite"})
+	created = readUntil(t, owner, "invite_created", "/invite/")
+	token = created[len(created)-1].Token
+
+	bob.WriteJSON(models.Message{Type: "revoke_invite", Token: token})
+	readUntil(t, bob, "permission_denied", "")
+	owner.WriteJSON(models.Message{Type: "revoke_invite", Token: token})
+	readUntil(t, owner, "invite_revoked", "")
+
+	carol.WriteJSON(models.Message{Type: "join_invite", Token: token})
+	readUntil(t, carol, "invite_invalid", "")
+	if code := inviteStatus(token); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for revoked invite, got %d", code)
+	}
+}
+
+func TestInitIntoPasswordRoom(t *testing.T) {
+	cfg := config.Load()
+	_, url := newTestServer(t, cfg)
+
+	owner := dial(t, url, models.Message{Nickname: "Owner", Room: "聊天大廳", UserId: "OWNR0001"})
+	readUntil(t, owner, "session", "")
+	owner.WriteJSON(models.Message{Type: "switch", Room: "locked_room", Password: "hunter2"})
+	readUntil(t, owner, "switch_success", "")
+
+	// 初始訊息直接指定密碼房間但沒有密碼：改到大廳並要求密碼
+	eve := dial(t, url, models.Message{Nickname: "Eve", Room: "locked_room", UserId: "EVEE0001"})
+	readUntil(t, eve, "switch_success", "locked_room")
+	readUntil(t, eve, "password_required", "")
+	eve.WriteJSON(models.Message{Type: "chat", Content: "from the lobby"})
+	seen := readUntil(t, eve, "chat", "from the lobby")
+	if room := seen[len(seen)-1].Room; room != "聊天大廳" {
+		t.Errorf("Expected Eve to be redirected to the lobby, got %q", room)
+	}
+
+	// 帶正確密碼時直接進入
+	bob := dial(t, url, models.Message{Nickname: "Bob", Room: "locked_room", UserId: "BOBB0001", Password: "hunter2"})
+	readUntil(t, owner, "join", "Bob")
+	bob.WriteJSON(models.Message{Type: "chat", Content: "inside"})
+	readUntil(t, owner, "chat", "inside")
+}
+
+func TestRoomCapacityAndWaitlist(t *testing.T) {
+	cfg := config.Load()
+	cfg.Room.MaxMembers = 1
+	cfg.Room.MaxTotalMembers = 3
+	cfg.Room.Waitlist = true
+	_, url := newTestServer(t, cfg)
+
+	alice := dial(t, url, models.Message{Nickname: "Alice", Room: "cap_room", UserId: "ALIC0003"})
+	readUntil(t, alice, "join", "Alice")
+
+	// 房間已滿時加入等候名單
+	bob := dial(t, url, models.Message{Nickname: "Bob", Room: "聊天大廳", UserId: "BOBB0006"})
+	readUntil(t, bob, "join", "Bob")
+	bob.WriteJSON(models.Message{Type: "switch", Room: "cap_room"})
+	waitlisted := readUntil(t, bob, "waitlisted", "")
+	if pos := waitlisted[len(waitlisted)-1].Position; pos != 1 {
+		t.Errorf("Expected waitlist position 1, got %d", pos)
+	}
+
+	// 同一使用者的其他分頁不佔用名額
+	aliceTab := dial(t, url, models.Message{Nickname: "Alice", Room: "cap_room", UserId: "ALIC0003"})
+	readUntil(t, aliceTab, "room_members", "")
+
+	// 全站上限
+	carol := dial(t, url, models.Message{Nickname: "Carol", Room: "聊天大廳", UserId: "CARL0002"})
+	readUntil(t, carol, "join", "Carol")
+	dave := dial(t, url, models.Message{Nickname: "Dave", Room: "聊天大廳", UserId: "DAVE0001"})
+	readUntil(t, dave, "room_full", "")
+
+	// Alice 離開後，Bob 自動進入
+	alice.WriteJSON(models.Message{Type: "switch", Room: "聊天大廳"})
+	aliceTab.WriteJSON(models.Message{Type: "switch", Room: "聊天大廳"})
+	readUntil(t, bob, "switch_success", "聊天大廳")
+}
+
+func TestRoomCapacityUnderConcurrentJoins(t *testing.T) {
+	cfg := config.Load()
+	cfg.Room.MaxMembers = 2
+	svc, url := newTestServer(t, cfg)
+
+	// 同時有多人進入時，每次加入都在寫入鎖內確認人數，不會超過上限
+	conns := make([]*websocket.Conn, 8)
+	for i := range conns {
+		conns[i] = dial(t, url, models.Message{
+			Nickname: "Racer",
+			Room:     "race_room",
+			UserId:   "RACE000" + string(rune('0'+i)),
+		})
+	}
+	for _, ws := range conns {
+		readUntil(t, ws, "session", "")
+	}
+	if members := svc.RoomMembers("race_room"); len(members) > 2 {
+		t.Errorf("Expected at most 2 members, got %d", len(members))
+	}
+}
+
+func TestConnectionAdmission(t *testing.T) {
+	cfg := config.Load()
+	cfg.WebSocket.MaxConnections = 3
+	cfg.WebSocket.MaxConnsPerIP = 2
+	cfg.WebSocket.MaxConnsPerUser = 1
+	cfg.WebSocket.AdmissionRetryAfter = 7 * time.Second
+	_, url := newTestServer(t, cfg)
+
+	expectRejected := func(target string, status int) {
+		t.Helper()
+		ws, resp, err := websocket.DefaultDialer.Dial(target, nil)
+		if err == nil {
+			ws.Close()
+			t.Fatalf("Expected connection to %s to be rejected", target)
+		}
+		if resp == nil || resp.StatusCode != status {
+			t.Fatalf("Expected status %d, got %v", status, resp)
+		}
+		if got := resp.Header.Get("Retry-After"); got != "7" {
+			t.Errorf("Expected Retry-After 7, got %q", got)
+		}
+	}
+
+	// 同一使用者只能有一個連線
+	tab1 := dial(t, url+"?userId=ADMT0001", models.Message{Nickname: "Tab1", Room: "聊天大廳", UserId: "ADMT0001"})
+	expectRejected(url+"?userId=ADMT0001", http.StatusTooManyRequests)
+
+	// 同一 IP 最多兩個連線
+	other := dial(t, url, models.Message{Nickname: "Other", Room: "聊天大廳", UserId: "ADMT0002"})
+	readUntil(t, other, "join", "Other")
+	expectRejected(url, http.StatusTooManyRequests)
+
+	// 連線關閉後名額釋放
+	other.Close()
+	time.Sleep(100 * time.Millisecond)
+	again := dial(t, url, models.Message{Nickname: "Again", Room: "聊天大廳", UserId: "ADMT0003"})
+	session := readUntil(t, again, "session", "")
+	token := session[len(session)-1].Token
+	readUntil(t, again, "join", "Again")
+
+	// 不帶查詢字串以 resume 連線，仍計入使用者連線數
+	tab1.Close()
+	time.Sleep(100 * time.Millisecond)
+	resumed := dial(t, url, models.Message{Type: "resume", Token: token, Nickname: "Again", Room: "聊天大廳", UserId: "ADMT0003"})
+	resumed.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := resumed.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("Expected the resume to be rejected by the per-user limit, got %v", err)
+	}
+}
+
+func TestUserIDMismatchRejected(t *testing.T) {
+	cfg := config.Load()
+	cfg.WebSocket.ResumeGrace = 5 * time.Second
+	_, url := newTestServer(t, cfg)
+
+	// 以其他使用者 ID 送出初始訊息，連線名額會記錯使用者
+	ws := dial(t, url+"?userId=MISM0001", models.Message{Nickname: "Mallory", Room: "聊天大廳", UserId: "MISM0002"})
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := ws.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("Expected a policy violation close, got %v", err)
+	}
+
+	// 只帶查詢字串時沿用查詢字串的使用者 ID；其他使用者無法恢復這個 session
+	alice := dial(t, url+"?userId=MISM0003", models.Message{Nickname: "Alice", Room: "聊天大廳"})
+	session := readUntil(t, alice, "session", "")
+	token := session[len(session)-1].Token
+
+	other := dial(t, url+"?userId=MISM0004", models.Message{Type: "resume", Token: token, Nickname: "Eve", Room: "聊天大廳"})
+	readUntil(t, other, "resume_failed", "")
+}
+
+func TestInitMessageDeadline(t *testing.T) {
+	cfg := config.Load()
+	cfg.WebSocket.PingInterval = 100 * time.Millisecond
+	cfg.WebSocket.PongWait = 200 * time.Millisecond
+	_, url := newTestServer(t, cfg)
+
+	// 連線後不送初始訊息，伺服器應在 pong_wait 後關閉連線
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer ws.Close()
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = ws.ReadMessage()
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatal("Expected the server to close an idle connection before the init message")
+	}
+}
+
+func TestAdmissionGlobalLimit(t *testing.T) {
+	a := newAdmission(config.WSConfig{MaxConnections: 1})
+	if err := a.admit("10.0.0.1"); err != nil {
+		t.Fatalf("First connection should be admitted: %v", err)
+	}
+	if err := a.admit("10.0.0.2"); err != errServerFull {
+		t.Errorf("Expected errServerFull, got %v", err)
+	}
+	a.release("10.0.0.1")
+	if err := a.admit("10.0.0.2"); err != nil {
+		t.Errorf("Connection should be admitted after release: %v", err)
+	}
+}
+
+func TestClientIPUsesTrustedHops(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.RemoteAddr = "10.0.0.9:4321"
+	// 客戶端自行填寫的位址在左側，代理附加的位址在右側
+	r.Header.Add("X-Forwarded-For", "6.6.6.6, 203.0.113.7")
+	r.Header.Add("X-Forwarded-For", "10.0.0.2")
+
+	cases := []struct {
+		trust bool
+		hops  int
+		want  string
+	}{
+		{false, 1, "10.0.0.9"},
+		{true, 1, "10.0.0.2"},
+		{true, 2, "203.0.113.7"},
+		{true, 5, "6.6.6.6"},
+	}
+	for _, tc := range cases {
+		if got := clientIP(r, tc.trust, tc.hops); got != tc.want {
+			t.Errorf("clientIP(trust=%v, hops=%d) = %q, want %q", tc.trust, tc.hops, got, tc.want)
+		}
+	}
+}
+
+func TestRateLimitEscalation(t *testing.T) {
+	cfg := config.Load()
+	cfg.RateLimit = config.RateLimitConfig{
+		Enabled:         true,
+		MaxMessages:     1,
+		TimeWindow:      time.Hour,
+		Burst:           2,
+		IPMaxMessages:   100,
+		IPBurst:         100,
+		ViolationWindow: time.Minute,
+		MuteAfter:       2,
+		MuteDuration:    time.Minute,
+		DisconnectAfter: 4,
+	}
+	_, url := newTestServer(t, cfg)
+
+	ws := dial(t, url, models.Message{Nickname: "Spammer", Room: "spam_room", UserId: "SPAM0001"})
+	readUntil(t, ws, "join", "Spammer")
+
+	for i := 0; i < 2; i++ {
+		ws.WriteJSON(models.Message{Type: "chat", Content: "hi"})
+		readUntil(t, ws, "chat", "hi")
+	}
+
+	// 第一次違規：只拒絕此訊息並告知何時可以再發送
+	ws.WriteJSON(models.Message{Type: "chat", Content: "spam"})
+	limited := readUntil(t, ws, "rate_limited", "")
+	if retry := limited[len(limited)-1].RetryAfter; retry <= 0 || retry > time.Hour.Milliseconds() {
+		t.Errorf("Expected retryAfter within the refill time, got %d", retry)
+	}
+
+	// 第二次違規：暫時禁言
+	ws.WriteJSON(models.Message{Type: "chat", Content: "spam"})
+	muted := readUntil(t, ws, "rate_limited", "禁止發言")
+	if retry := muted[len(muted)-1].RetryAfter; retry <= 0 || retry > time.Minute.Milliseconds() {
+		t.Errorf("Expected retryAfter within mute duration, got %d", retry)
+	}
+
+	// 不計費的訊息禁言期間仍然允許
+	ws.WriteJSON(models.Message{Type: "ack"})
+
+	// 禁言期間繼續發送，達到上限後中斷連線
+	ws.WriteJSON(models.Message{Type: "chat", Content: "spam"})
+	readUntil(t, ws, "rate_limited", "禁止發言")
+	ws.WriteJSON(models.Message{Type: "chat", Content: "spam"})
+	readUntil(t, ws, "rate_limited", "中斷")
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg models.Message
+		err := ws.ReadJSON(&msg)
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			t.Errorf("Expected policy violation close, got %v", err)
+		}
+		break
+	}
+
+	// 違規記錄在 violation_window 內保留：換使用者 ID 重新連線後仍在禁言中，再次發送立即中斷
+	again := dial(t, url, models.Message{Nickname: "Spammer", Room: "spam_room", UserId: "SPAM0002"})
+	readUntil(t, again, "join", "Spammer")
+	again.WriteJSON(models.Message{Type: "chat", Content: "spam"})
+	readUntil(t, again, "rate_limited", "中斷")
+}
+
+func TestNamedLeaderboards(t *testing.T) {
+	cfg := config.Load()
+	cfg.RateLimit.Enabled = false // quiz_start 的成本會用完配額
+	_, url := newTestServer(t, cfg)
+
+	alice := dial(t, url, models.Message{Nickname: "Alice", Room: "quiz_room", UserId: "ALIC0001"})
+	readUntil(t, alice, "session", "")
+
+	alice.WriteJSON(models.Message{Type: "quiz_start", Question: "1+1?", Answer: "2"})
+	readUntil(t, alice, "quiz_start", "")
+	alice.WriteJSON(models.Message{Type: "quiz_answer", Answer: "2"})
+
+	// 答對後廣播房間的搶答總榜
+	updates := readUntil(t, alice, "leaderboard_update", "Alice")
+	if update := updates[len(updates)-1]; update.Board != "quiz" || update.Room != "quiz_room" {
+		t.Errorf("Expected the quiz_room quiz board, got board=%q room=%q", update.Board, update.Room)
+	}
+
+	alice.WriteJSON(models.Message{Type: "get_leaderboard", Board: "quiz", Period: "daily", Room: "quiz_room"})
+	updates = readUntil(t, alice, "leaderboard_update", "ALIC0001")
+	if update := updates[len(updates)-1]; update.Period != "daily" || !strings.Contains(update.Content, `"score":1`) {
+		t.Errorf("Unexpected daily quiz board %+v", update)
+	}
+
+	alice.WriteJSON(models.Message{Type: "get_leaderboard", Board: "quiz", Room: "elsewhere"})
+	readUntil(t, alice, "error", "目前所在房間")
+	alice.WriteJSON(models.Message{Type: "get_leaderboard", Board: "chess"})
+	readUntil(t, alice, "error", "未知的排行榜")
+}
+
+func TestPersonalBest(t *testing.T) {
+	cfg := config.Load()
+	cfg.RateLimit.Enabled = false
+	_, url := newTestServer(t, cfg)
+
+	bob := dial(t, url, models.Message{Nickname: "Bob", Room: "_game_", UserId: "BOBB0001"})
+	readUntil(t, bob, "session", "")
+	alice := dial(t, url, models.Message{Nickname: "Alice", Room: "_game_", UserId: "ALIC0001"})
+	readUntil(t, alice, "session", "")
+
+	bestOf := func(ws *websocket.Conn) *models.PersonalBest {
+		t.Helper()
+		seen := readUntil(t, ws, "personal_best", "")
+		msg := seen[len(seen)-1]
+		if msg.Board != "guess_number" || msg.Best == nil {
+			t.Fatalf("Unexpected personal_best %+v", msg)
+		}
+		return msg.Best
+	}
+
+	bob.WriteJSON(models.Message{Type: "game_score", Tries: 3, Time: 10})
+	if best := bestOf(bob); best.Rank != 1 || !best.NewBest {
+		t.Errorf("Expected Bob's first game to be a new best at rank 1, got %+v", best)
+	}
+
+	// 較差的成績不會取代最佳成績
+	alice.WriteJSON(models.Message{Type: "game_score", Tries: 5, Time: 20})
+	bestOf(alice)
+	alice.WriteJSON(models.Message{Type: "game_score", Tries: 8, Time: 20})
+	best := bestOf(alice)
+	if best.Rank != 2 || best.NewBest || best.Score.Tries != 5 {
+		t.Errorf("Expected Alice to keep 5 tries at rank 2, got %+v", best)
+	}
+	if len(best.Around) != 2 || best.AroundFrom != 1 || best.Around[0].UserID != "BOBB0001" {
+		t.Errorf("Unexpected players around Alice: from=%d %+v", best.AroundFrom, best.Around)
+	}
+}